@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/StalkR/switchman/leakcheck"
+	"github.com/StalkR/switchman/mullvadapp"
+	"github.com/StalkR/switchman/openvpn"
+	"github.com/StalkR/switchman/wgshow"
+)
+
+// wireGuardStatusable is implemented by backends using a WireGuard interface.
+type wireGuardStatusable interface {
+	// Status returns the live state of the WireGuard interface.
+	Status() (*wgshow.Device, error)
+}
+
+// openVPNStatusable is implemented by backends using the OpenVPN management interface.
+type openVPNStatusable interface {
+	// Status returns the connection state from the management interface.
+	Status() (*openvpn.Status, error)
+}
+
+// mullvadAppStatusable is implemented by backends using the Mullvad app daemon.
+type mullvadAppStatusable interface {
+	// Status returns the connection state of the daemon.
+	Status() (*mullvadapp.State, error)
+}
+
+// status returns the live state of the connection, or nil if the backend
+// does not report it.
+func status(s Switchable) (any, error) {
+	switch v := s.(type) {
+	case wireGuardStatusable:
+		return v.Status()
+	case openVPNStatusable:
+		return v.Status()
+	case mullvadAppStatusable:
+		return v.Status()
+	}
+	return nil, nil
+}
+
+type apiStatus struct {
+	Backend     string            `json:"backend"`
+	Current     string            `json:"current"`
+	Servers     []string          `json:"servers"`
+	Status      any               `json:"status,omitempty"`
+	StatusError string            `json:"status_error,omitempty"`
+	Exit        *exitCheck        `json:"exit,omitempty"`
+	Leak        *leakcheck.Result `json:"leak,omitempty"`
+	Failover    *failoverReport   `json:"failover,omitempty"`
+}
+
+// apiStatusOf returns the status of the server, as served by the API.
+func apiStatusOf(s *server) (*apiStatus, error) {
+	current, err := s.Current()
+	if err != nil {
+		return nil, err
+	}
+	servers, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(servers)
+	resp := &apiStatus{
+		Backend: backendName(s.Switchable),
+		Current: current,
+		Servers: servers,
+	}
+	st, err := status(s.Switchable)
+	if err != nil {
+		resp.StatusError = err.Error()
+	} else if st != nil {
+		resp.Status = st
+	}
+	if s.exits != nil {
+		resp.Exit = s.exits.Last()
+	}
+	if s.failover != nil {
+		resp.Failover = s.failover.report()
+	}
+	if s.leaks != nil {
+		resp.Leak = s.leaks.Last()
+	}
+	return resp, nil
+}
+
+func (s *server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	resp, err := apiStatusOf(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An origin is who or what requested a change, for the audit log and hooks.
+type origin struct {
+	Action string // switch, next, route
+	Remote string // IP address of the client
+	User   string // authenticated user, if any
+}
+
+// requestOrigin returns the origin of an HTTP request. The user comes from
+// the credentials of the client over the unix socket, or from a trusted
+// reverse proxy which authenticated it (basic auth or X-Forwarded-User).
+// Otherwise it is empty: clients could claim any user. Through trusted
+// proxies, the remote is the client they forwarded for (X-Forwarded-For).
+func (s *server) requestOrigin(r *http.Request, action string) origin {
+	o := origin{Action: action}
+	if user, ok := r.Context().Value(peerUserKey{}).(string); ok {
+		o.Remote, o.User = "unix socket", user
+		return o
+	}
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if remote == "" || remote == "@" {
+		remote = "unix socket"
+	}
+	o.Remote = remote
+	if s.trustedProxy(remote) {
+		user, _, ok := r.BasicAuth()
+		if !ok {
+			user = r.Header.Get("X-Forwarded-User")
+		}
+		o.User = user
+		o.Remote = s.forwardedFor(r, remote)
+	}
+	return o
+}
+
+// forwardedFor returns the client of a request from a trusted proxy: the last
+// hop of X-Forwarded-For not a trusted proxy, as earlier ones could be forged
+// by the client, or the proxy if none.
+func (s *server) forwardedFor(r *http.Request, proxy string) string {
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, e := range strings.Split(h, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				hops = append(hops, e)
+			}
+		}
+	}
+	client := proxy
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = hops[i]
+		if !s.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+// trustedProxy returns whether a remote address is a trusted reverse proxy.
+func (s *server) trustedProxy(remote string) bool {
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return false
+	}
+	for _, p := range s.proxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerUserKey is the context key of the user of a unix socket client.
+type peerUserKey struct{}
+
+// peerContext records the user of a unix socket client in the context of its
+// connection, from its credentials, as a name or uid if unknown.
+func peerContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	uid, ok := peerUID(uc)
+	if !ok {
+		return ctx
+	}
+	name := strconv.Itoa(uid)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	return context.WithValue(ctx, peerUserKey{}, name)
+}
+
+// A change is a switch or routing change, as recorded in the audit log and
+// sent to hooks.
+type change struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Remote   string    `json:"remote,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Backend  string    `json:"backend"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Duration float64   `json:"duration"` // seconds
+	Error    string    `json:"error,omitempty"`
+	Vetoed   bool      `json:"vetoed,omitempty"` // by the pre-switch hook, not attempted
+}
+
+// An auditLog records state changes as JSON lines in a file.
+// The file is opened for each entry so it can be rotated by logrotate
+// without signaling or truncating.
+type auditLog struct {
+	path string
+	m    sync.Mutex // serializes writes
+}
+
+func newAuditLog(path string) *auditLog {
+	return &auditLog{path: path}
+}
+
+// newChange returns a change requested by an origin, which took d.
+func newChange(o origin, backend, from, to string, d time.Duration, err error) *change {
+	c := &change{
+		Time:     time.Now(),
+		Action:   o.Action,
+		Remote:   o.Remote,
+		User:     o.User,
+		Backend:  backend,
+		From:     from,
+		To:       to,
+		Duration: d.Seconds(),
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// record appends a change to the log. Failures are logged but do not fail
+// the change, which already happened.
+func (a *auditLog) record(c *change) {
+	if err := a.write(c); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+func (a *auditLog) write(c *change) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("action", c.Action),
+		slog.String("remote", c.Remote),
+		slog.String("user", c.User),
+		slog.String("backend", c.Backend),
+		slog.String("from", c.From),
+		slog.String("to", c.To),
+		slog.Float64("duration", c.Duration),
+	}
+	if c.Error != "" {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", c.Error))
+	}
+	if c.Vetoed {
+		attrs = append(attrs, slog.Bool("vetoed", true))
+	}
+	slog.New(slog.NewJSONHandler(f, nil)).LogAttrs(context.Background(), level, "audit", attrs...)
+	return f.Close()
+}
+
+// An auditFilter selects entries of the audit log.
+type auditFilter struct {
+	Action string
+	Remote string
+	User   string
+	Server string // either from or to
+	Errors bool   // only failed changes
+	Since  time.Time
+	Limit  int
+}
+
+// parseAuditFilter parses a filter from query parameters: action, remote,
+// user, server, errors, since (duration ago or RFC 3339 time) and limit.
+func parseAuditFilter(q url.Values) (auditFilter, error) {
+	f := auditFilter{
+		Action: q.Get("action"),
+		Remote: q.Get("remote"),
+		User:   q.Get("user"),
+		Server: q.Get("server"),
+		Errors: q.Get("errors") != "",
+		Limit:  100,
+	}
+	if v := q.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			f.Since = t
+		} else {
+			return f, err
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, err
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+func (f auditFilter) match(c *change) bool {
+	switch {
+	case f.Action != "" && c.Action != f.Action:
+	case f.Remote != "" && c.Remote != f.Remote:
+	case f.User != "" && c.User != f.User:
+	case f.Server != "" && !strings.Contains(c.From, f.Server) && !strings.Contains(c.To, f.Server):
+	case f.Errors && c.Error == "":
+	case !f.Since.IsZero() && c.Time.Before(f.Since):
+	default:
+		return true
+	}
+	return false
+}
+
+// read returns the matching entries, newest first, from the log and its
+// last rotation (.1) if any.
+func (a *auditLog) read(f auditFilter) ([]*change, error) {
+	var entries []*change
+	for _, path := range []string{a.path + ".1", a.path} {
+		b, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parseAudit(bytes.NewReader(b), f)...)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+	return entries, nil
+}
+
+// parseAudit parses the matching entries, skipping invalid lines.
+func parseAudit(r io.Reader, f auditFilter) []*change {
+	var entries []*change
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e change
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if f.match(&e) {
+			entries = append(entries, &e)
+		}
+	}
+	return entries
+}
+
+var auditTmpl = template.Must(template.New("").Parse(`<form action="audit">
+  <input name="action" placeholder="action" value="{{.Filter.Action}}">
+  <input name="server" placeholder="server" value="{{.Filter.Server}}">
+  <input name="remote" placeholder="remote" value="{{.Filter.Remote}}">
+  <input name="user" placeholder="user" value="{{.Filter.User}}">
+  <input name="since" placeholder="since (e.g. 24h)" value="{{.Since}}">
+  <label><input type="checkbox" name="errors" value="1"{{if .Filter.Errors}} checked{{end}}> errors only</label>
+  <input type="submit" value="filter">
+</form>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Time</th>
+      <th align="left">Action</th>
+      <th align="left">Remote</th>
+      <th align="left">User</th>
+      <th align="left">Backend</th>
+      <th align="left">From</th>
+      <th align="left">To</th>
+      <th align="left">Duration</th>
+      <th align="left">Error</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Entries}}
+    <tr>
+      <td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+      <td>{{.Action}}</td>
+      <td>{{.Remote}}</td>
+      <td>{{.User}}</td>
+      <td>{{.Backend}}</td>
+      <td>{{.From}}</td>
+      <td>{{.To}}</td>
+      <td>{{printf "%.1fs" .Duration}}</td>
+      <td><span style="color: red;">{{.Error}}</span></td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>`))
+
+// handleAudit shows the audit log, or returns it as JSON for non-browsers.
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/audit" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.audit == nil {
+		http.Error(w, "audit log not enabled", http.StatusNotFound)
+		return
+	}
+	f, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := s.audit.read(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !acceptsHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	var content bytes.Buffer
+	if err := auditTmpl.Execute(&content, struct {
+		Filter  auditFilter
+		Since   string
+		Entries []*change
+	}{
+		Filter:  f,
+		Since:   r.URL.Query().Get("since"),
+		Entries: entries,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	if err := page(w, s, content.String()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
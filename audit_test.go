@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "audit.log")
+	a := newAuditLog(path)
+	a.record(newChange(origin{Action: "switch", Remote: "192.0.2.1", User: "alice"}, "mullvad", "se1", "se2", time.Second, nil))
+	// rotated by logrotate: recent entries go to a new file
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	a.record(newChange(origin{Action: "next", Remote: "192.0.2.2"}, "mullvad", "se2", "se3", 2*time.Second, errors.New("timeout")))
+
+	for _, tt := range []struct {
+		query string
+		want  []string // to of the entries
+	}{
+		{"", []string{"se3", "se2"}},
+		{"user=alice", []string{"se2"}},
+		{"action=next", []string{"se3"}},
+		{"server=se2", []string{"se3", "se2"}},
+		{"remote=192.0.2.3", nil},
+		{"errors=1", []string{"se3"}},
+		{"since=1h", []string{"se3", "se2"}},
+		{"since=2000-01-01T00:00:00Z&limit=1", []string{"se3"}},
+	} {
+		q, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parseAuditFilter(q)
+		if err != nil {
+			t.Fatalf("parseAuditFilter(%q): %v", tt.query, err)
+		}
+		entries, err := a.read(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.To)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("read(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	entries, err := a.read(auditFilter{Action: "next"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("read: got %d entries; want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Remote != "192.0.2.2" || e.Backend != "mullvad" || e.From != "se2" || e.Duration != 2 || e.Error != "timeout" || e.Time.IsZero() {
+		t.Errorf("read: got %+v", e)
+	}
+}
+
+func TestRequestOrigin(t *testing.T) {
+	s := newServer(&fakeSwitchable{})
+	s.proxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	for _, tt := range []struct {
+		remote string
+		header string
+		want   origin
+	}{
+		{"192.0.2.1:1234", "alice", origin{Action: "switch", Remote: "192.0.2.1", User: "alice"}},
+		{"[::ffff:192.0.2.1]:1234", "alice", origin{Action: "switch", Remote: "::ffff:192.0.2.1", User: "alice"}},
+		// not a trusted proxy: the user could be forged
+		{"198.51.100.1:1234", "alice", origin{Action: "switch", Remote: "198.51.100.1"}},
+	} {
+		r := httptest.NewRequest("GET", "/switch", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("X-Forwarded-User", tt.header)
+		if got := s.requestOrigin(r, "switch"); got != tt.want {
+			t.Errorf("requestOrigin(%v) = %+v; want %+v", tt.remote, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"192.0.2.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		// the last hop not a trusted proxy, earlier ones could be forged
+		{"192.0.2.1:1234", []string{"10.0.0.1, 203.0.113.7", "192.0.2.2"}, "203.0.113.7"},
+		// all trusted proxies
+		{"192.0.2.1:1234", []string{"192.0.2.3, 192.0.2.2"}, "192.0.2.3"},
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		// not a trusted proxy: the client could be forged
+		{"198.51.100.1:1234", []string{"203.0.113.7"}, "198.51.100.1"},
+	} {
+		r := httptest.NewRequest("GET", "/switch", nil)
+		r.RemoteAddr = tt.remote
+		for _, e := range tt.xff {
+			r.Header.Add("X-Forwarded-For", e)
+		}
+		if got := s.requestOrigin(r, "switch"); got.Remote != tt.want {
+			t.Errorf("requestOrigin(%v, X-Forwarded-For %q) remote = %v; want %v", tt.remote, tt.xff, got.Remote, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/switch", nil)
+	r = r.WithContext(context.WithValue(r.Context(), peerUserKey{}, "bob"))
+	r.Header.Set("X-Forwarded-User", "alice")
+	want := origin{Action: "switch", Remote: "unix socket", User: "bob"}
+	if got := s.requestOrigin(r, "switch"); got != want {
+		t.Errorf("requestOrigin(unix socket) = %+v; want %+v", got, want)
+	}
+}
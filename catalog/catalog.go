@@ -0,0 +1,85 @@
+// Package catalog switches a WireGuard config between the relays of a VPN
+// provider publishing its relay list: it fetches and caches the list, finds
+// the relays of a server, rewrites the peer of the config and shows the
+// relays in an index. A provider adapter fetches the relays and computes the
+// peer settings of a relay; JSONList is one for any JSON relay list.
+package catalog
+
+import (
+  "sync"
+  "time"
+)
+
+// fetchInterval is how often the relay list is fetched again.
+const fetchInterval = 24 * time.Hour
+
+// A Relay is a WireGuard server of a provider, with its metadata.
+type Relay struct {
+  ID           string // short name, e.g. se-got-wg-001
+  Hostname     string // of the endpoint
+  Port         int    // of the endpoint
+  Active       bool
+  Owned        bool // by the provider, rather than rented
+  Country      string
+  City         string
+  Provider     string // hosting the relay
+  PublicKey    string
+  MultihopPort int // port of the entry relays to exit through this one, 0 if none
+}
+
+// Peer is the settings of the [Peer] section of the config to connect to a
+// server.
+type Peer struct {
+  Endpoint  string // host:port
+  PublicKey string
+}
+
+// A Provider is an adapter for a VPN provider.
+type Provider interface {
+  // Fetch fetches the relays of the provider.
+  Fetch() ([]Relay, error)
+  // Peer returns the peer settings to connect to the relays of a server:
+  // one, or the entry then the exit if multi-hop.
+  Peer(relays []Relay) Peer
+}
+
+// New creates a new Server switching the WireGuard config of a device
+// between the relays of the provider. Fetching starts with FetchPeriodically.
+func New(config, device string, provider Provider) *Server {
+  return &Server{
+    config:   config,
+    device:   device,
+    provider: provider,
+  }
+}
+
+// A Server implements the ability to switch a WireGuard config between the
+// relays of a provider.
+// It implements the Switchable and Indexable interfaces.
+type Server struct {
+  config   string
+  device   string
+  provider Provider
+
+  write sync.Mutex // serializes config changes
+
+  m       sync.Mutex // protects below
+  relays  []Relay
+  error   error
+  fetched time.Time // last successful fetch
+}
+
+// Config returns the path of the WireGuard config.
+func (s *Server) Config() string {
+  return s.config
+}
+
+// LockConfig locks the config against other changes, until UnlockConfig.
+func (s *Server) LockConfig() {
+  s.write.Lock()
+}
+
+// UnlockConfig unlocks the config.
+func (s *Server) UnlockConfig() {
+  s.write.Unlock()
+}
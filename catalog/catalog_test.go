@@ -0,0 +1,144 @@
+package catalog
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+// fakeProvider has relays with multi-hop like Mullvad, and the exit key.
+type fakeProvider struct{}
+
+var testRelays = []Relay{
+  {ID: "se-got-wg-001", Hostname: "se-got-wg-001.example", Port: 51820, Active: true, Country: "Sweden", City: "Gothenburg", PublicKey: "key1", MultihopPort: 3001},
+  {ID: "ch-zrh-wg-001", Hostname: "ch-zrh-wg-001.example", Port: 51820, Active: false, Country: "Switzerland", City: "Zurich", PublicKey: "key2", MultihopPort: 3002},
+  {ID: "us-nyc-wg-001", Hostname: "us-nyc-wg-001.example", Port: 51820, Active: true, Country: "USA", City: "New York", PublicKey: "key3"},
+}
+
+func (fakeProvider) Fetch() ([]Relay, error) {
+  return testRelays, nil
+}
+
+func (fakeProvider) Peer(relays []Relay) Peer {
+  entry, exit := relays[0], relays[len(relays)-1]
+  port := entry.Port
+  if len(relays) > 1 {
+    port = exit.MultihopPort
+  }
+  return Peer{Endpoint: fmt.Sprintf("%s:%d", entry.Hostname, port), PublicKey: exit.PublicKey}
+}
+
+const testConfig = `[Interface]
+PrivateKey = private
+
+[Peer]
+PublicKey = key1
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = se-got-wg-001.example:51820
+`
+
+func newTestServer(t *testing.T) (*Server, *[]string) {
+  config := filepath.Join(t.TempDir(), "wg0.conf")
+  if err := os.WriteFile(config, []byte(testConfig), 0600); err != nil {
+    t.Fatal(err)
+  }
+  var restarts []string
+  prev := restart
+  t.Cleanup(func() { restart = prev })
+  restart = func(device string) error {
+    restarts = append(restarts, device)
+    return nil
+  }
+  s := New(config, "wg0", fakeProvider{})
+  relays, _ := fakeProvider{}.Fetch()
+  s.SetRelays(relays)
+  return s, &restarts
+}
+
+func TestFind(t *testing.T) {
+  s, _ := newTestServer(t)
+  for _, tt := range []struct {
+    server string
+    ids    []string
+  }{
+    {"us-nyc-wg-001.example:51820", []string{"us-nyc-wg-001"}},
+    {"se-got-wg-001.example:3002", []string{"se-got-wg-001", "ch-zrh-wg-001"}},
+  } {
+    relays, err := s.Find(tt.server)
+    if err != nil {
+      t.Errorf("Find(%v) = %v", tt.server, err)
+      continue
+    }
+    var ids []string
+    for _, r := range relays {
+      ids = append(ids, r.ID)
+    }
+    if !reflect.DeepEqual(ids, tt.ids) {
+      t.Errorf("Find(%v) = %v; want %v", tt.server, ids, tt.ids)
+    }
+  }
+  for _, server := range []string{"us-nyc-wg-001.example", "unknown.example:51820", "unknown.example:3001", "us-nyc-wg-001.example:0"} {
+    if relays, err := s.Find(server); err == nil {
+      t.Errorf("Find(%v) = %+v; want error", server, relays)
+    }
+  }
+  if active, err := s.Active("se-got-wg-001.example:3002"); err != nil || active {
+    t.Errorf("Active(multi-hop via inactive exit) = %v, %v; want false", active, err)
+  }
+  want := []string{"se-got-wg-001.example:51820", "ch-zrh-wg-001.example:51820", "us-nyc-wg-001.example:51820"}
+  if got, err := s.List(); err != nil || !reflect.DeepEqual(got, want) {
+    t.Errorf("List() = %v, %v; want %v", got, err, want)
+  }
+}
+
+func TestSwitch(t *testing.T) {
+  s, restarts := newTestServer(t)
+  if err := s.Switch("se-got-wg-001.example:3002"); err != nil {
+    t.Fatal(err)
+  }
+  b, err := os.ReadFile(s.Config())
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := strings.NewReplacer("PublicKey = key1", "PublicKey = key2", "51820", "3002").Replace(testConfig)
+  if string(b) != want {
+    t.Errorf("config =\n%s\nwant\n%s", b, want)
+  }
+  if got, err := s.Current(); err != nil || got != "se-got-wg-001.example:3002" {
+    t.Errorf("Current() = %v, %v", got, err)
+  }
+  if !reflect.DeepEqual(*restarts, []string{"wg0"}) {
+    t.Errorf("restarts = %v; want [wg0]", *restarts)
+  }
+
+  // already there
+  if err := s.Switch("se-got-wg-001.example:3002"); err != nil || len(*restarts) != 1 {
+    t.Errorf("Switch(current) = %v, %d restarts; want nil, no restart", err, len(*restarts))
+  }
+  if err := s.Switch("unknown.example:51820"); err == nil {
+    t.Errorf("Switch(unknown) = nil; want error")
+  }
+}
+
+func TestIndex(t *testing.T) {
+  s, _ := newTestServer(t)
+  var b strings.Builder
+  if err := s.Index(&b); err != nil {
+    t.Fatal(err)
+  }
+  for _, want := range []string{"Current server: se-got-wg-001.example:51820", `<option value="3002">`, "switch?server=us-nyc-wg-001.example:51820"} {
+    if !strings.Contains(b.String(), want) {
+      t.Errorf("Index() does not contain %q", want)
+    }
+  }
+  if strings.Contains(b.String(), `<option value="0">`) {
+    t.Errorf("Index() lists a relay without multi-hop as exit")
+  }
+  // the cached relays are not reordered
+  if relays, _ := s.Relays(); relays[0].ID != "se-got-wg-001" || relays[1].ID != "ch-zrh-wg-001" {
+    t.Errorf("Relays() reordered by Index()")
+  }
+}
@@ -0,0 +1,127 @@
+package catalog
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "os/exec"
+  "regexp"
+  "strings"
+  "time"
+
+  "github.com/StalkR/switchman/wgshow"
+)
+
+var (
+  endpointRE  = regexp.MustCompile("(?m)^(Endpoint = .*)$")
+  publicKeyRE = regexp.MustCompile("(?m)^(PublicKey = .*)$")
+)
+
+// Endpoint returns the endpoint of the peer of a WireGuard config.
+func Endpoint(config string) (string, error) {
+  f, err := os.Open(config)
+  if err != nil {
+    return "", err
+  }
+  defer f.Close()
+
+  var current string
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    f := strings.Split(scanner.Text(), " ")
+    if len(f) < 3 || f[0] != "Endpoint" {
+      continue
+    }
+    current = f[2]
+  }
+
+  if err := scanner.Err(); err != nil {
+    return "", err
+  }
+  return current, nil
+}
+
+// Current returns the current server.
+func (s *Server) Current() (string, error) {
+  return Endpoint(s.config)
+}
+
+// Switch switches to the specified server.
+func (s *Server) Switch(server string) error {
+  s.write.Lock()
+  defer s.write.Unlock()
+  current, err := s.Current()
+  if err != nil {
+    return err
+  }
+  if server == current {
+    return nil // not an error, just nothing to do
+  }
+  relays, err := s.Find(server)
+  if err != nil {
+    return err
+  }
+  peer := s.provider.Peer(relays)
+
+  b, err := os.ReadFile(s.config)
+  if err != nil {
+    return err
+  }
+  b = endpointRE.ReplaceAll(b, []byte(fmt.Sprintf("Endpoint = %s", peer.Endpoint)))
+  b = publicKeyRE.ReplaceAll(b, []byte(fmt.Sprintf("PublicKey = %s", peer.PublicKey)))
+  if err := os.WriteFile(s.config, b, 0644); err != nil {
+    return err
+  }
+
+  return s.Restart()
+}
+
+// Restart restarts the device with wg-quick, for config changes to apply.
+// The config must be locked.
+func (s *Server) Restart() error {
+  return restart(s.device)
+}
+
+// restart restarts a device, replaced in tests.
+var restart = func(device string) error {
+  // check if running before stop or it will fail
+  if up(device) {
+    if out, err := exec.Command("wg-quick", "down", device).CombinedOutput(); err != nil {
+      return fmt.Errorf("could not stop wg: %v - %v", err, string(out))
+    }
+  }
+  for ; ; time.Sleep(time.Second) {
+    if err := exec.Command("ip", "link", "list", "dev", device).Run(); err != nil {
+      break
+    }
+  }
+  if out, err := exec.Command("wg-quick", "up", device).CombinedOutput(); err != nil {
+    return fmt.Errorf("could not start wg: %v - %v", err, string(out))
+  }
+  return nil
+}
+
+// Up returns whether the device is up.
+func (s *Server) Up() bool {
+  return up(s.device)
+}
+
+func up(device string) bool {
+  return exec.Command("wg", "show", device).Run() == nil
+}
+
+// Status returns the live state of the WireGuard interface.
+func (s *Server) Status() (*wgshow.Device, error) {
+  return wgshow.Show(s.device)
+}
+
+// Device returns the network device of the tunnel.
+func (s *Server) Device() (string, error) {
+  return s.device, nil
+}
+
+// Endpoints returns the endpoints of a server: the server itself, which is
+// the entry relay if multi-hop.
+func (s *Server) Endpoints(server string) ([]string, error) {
+  return []string{server}, nil
+}
@@ -0,0 +1,24 @@
+package catalog
+
+import (
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for a WireGuard config switched between the relays of a
+// JSON relay list, which must be configured: it is not found on the host.
+// An explicit relay list scores above a generic WireGuard config.
+func Detect(source, config, device string) *detect.Result {
+  r := detect.New("catalog")
+  if source == "" {
+    return r.Score(0, "no relay list configured")
+  }
+  r.Binary("wg-quick")
+  tunnel := r.Interface(device)
+  if !r.File(config) {
+    return r.Score(0, "no %v", config)
+  }
+  if tunnel {
+    return r.Score(70, "relay list %v, %v, %v up", source, config, device)
+  }
+  return r.Score(50, "relay list %v, %v, %v down", source, config, device)
+}
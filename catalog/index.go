@@ -1,32 +1,26 @@
-package mullvad
+package catalog
 
 import (
   "html/template"
   "io"
-  "sort"
+  "slices"
+
+  "github.com/StalkR/switchman/wgshow"
 )
 
-var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="UTF-8">
-  <meta name="viewport" content="width=device-width" />
-  <title>switchman</title>
-  <script>
-  document.addEventListener('DOMContentLoaded', () => {
-    const elEntry = document.getElementById('entry');
-    const elExit = document.getElementById('exit');
-    const elSwitch = document.getElementById('switch');
-    function updateSwitch(event) {
-      if (!elEntry.value || !elExit.value) return;
-      elSwitch.href = 'switch?server=' + encodeURIComponent(elEntry.value + ':' + elExit.value);
-    }
-    elEntry.addEventListener('change', updateSwitch);
-    elExit.addEventListener('change', updateSwitch);
-  });
-  </script>
-</head>
-<body>
+var indexTmpl = template.Must(template.New("").Parse(`<script>
+document.addEventListener('DOMContentLoaded', () => {
+  const elEntry = document.getElementById('entry');
+  const elExit = document.getElementById('exit');
+  const elSwitch = document.getElementById('switch');
+  function updateSwitch(event) {
+    if (!elEntry.value || !elExit.value) return;
+    elSwitch.href = 'switch?server=' + encodeURIComponent(elEntry.value + ':' + elExit.value);
+  }
+  elEntry.addEventListener('change', updateSwitch);
+  elExit.addEventListener('change', updateSwitch);
+});
+</script>
 <p>Current server: {{.Current}}</p>
 {{if eq (len .CurrentRelays) 2}}
 <ul>
@@ -54,9 +48,26 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
   </li>
 </ul>
 {{end}}
+{{with .Status}}
+<p>Interface {{.Name}}{{if .ListenPort}} (listen port {{.ListenPort}}){{end}}</p>
+<ul>
+  {{range .Peers}}
+  <li>
+    peer {{.Endpoint}}:
+    {{if .LatestHandshake.IsZero}}<span style="color: red;">no handshake</span>{{else}}latest handshake
+      {{if .Stale}}<span style="color: red;">{{.HandshakeAge}} ago</span>{{else}}{{.HandshakeAge}} ago{{end}}{{end}},
+    {{.RxBytes}} bytes received, {{.TxBytes}} bytes sent
+  </li>
+  {{end}}
+</ul>
+{{end}}
+{{if .StatusError}}
+<p>Interface down: {{.StatusError}}</p>
+{{end}}
 {{if .LastError}}
 <p>Error fetching server list: {{.LastError}}</p>
 {{end}}
+{{if .Multihop}}
 <form>
   Multihop:
   entry <select id="entry" name="entry">
@@ -67,12 +78,13 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
   </select>
   exit <select id="exit" name="exit">
     <option value="">-</option>
-    {{range .Relays}}
+    {{range .Relays}}{{if .MultihopPort}}
     <option value="{{.MultihopPort}}">{{.ID}} ({{.Country}}, {{.City}}, {{if .Owned}}owned{{else}}rented{{end}}, {{if .Active}}active{{else}}inactive{{end}})</option>
-    {{end}}
+    {{end}}{{end}}
   </select>
   <a id="switch" href="#">switch</a>
 </form>
+{{end}}
 <p>
 Servers ({{len .Relays}})
 </p>
@@ -82,6 +94,7 @@ Servers ({{len .Relays}})
       <th align="left">ID</th>
       <th align="left">Country</th>
       <th align="left">City</th>
+      <th align="left">Hosted by</th>
       <th align="left">Ownership</th>
       <th align="left">Active</th>
       <th align="left">Switch</th>
@@ -93,44 +106,44 @@ Servers ({{len .Relays}})
       <td>{{.ID}}</td>
       <td>{{.Country}}</td>
       <td>{{.City}}</td>
+      <td>{{.Provider}}</td>
       <td>{{if .Owned}}owned{{else}}rented{{end}}</td>
       <td>{{if .Active}}active{{else}}<span style="color: red;">inactive</span>{{end}}</td>
       <td><a href="switch?server={{.Hostname}}:{{.Port}}">switch</a></td>
     </tr>
     {{end}}
   </tbody>
-</table>
-</body>
-</html>`))
+</table>`))
 
-// Index writes an HTML index page to switch the Server.
+// Index writes the body of an HTML index page to switch the Server.
 func (s *Server) Index(w io.Writer) error {
   current, err := s.Current()
   if err != nil {
     return err
   }
-  currentRelays, err := s.findRelays(current)
+  currentRelays, err := s.Find(current)
   if err != nil {
     currentRelays = nil
   }
-  relays, lastError := s.listRelays()
-  sort.Slice(relays, func(i, j int) bool {
-    if relays[i].Country == relays[j].Country {
-      if relays[i].City == relays[j].City {
-        return relays[i].Hostname < relays[j].Hostname
-      }
-      return relays[i].City < relays[j].City
-    }
-    return relays[i].Country < relays[j].Country
-  })
+  relays, lastError := s.Relays()
+  relays = slices.Clone(relays)
+  sortRelays(relays)
+  multihop := slices.ContainsFunc(relays, func(r Relay) bool { return r.MultihopPort != 0 })
+  status, statusError := s.Status()
   return indexTmpl.Execute(w, struct {
     Current       string
-    CurrentRelays []relay
-    Relays        []relay
+    CurrentRelays []Relay
+    Status        *wgshow.Device
+    StatusError   error
+    Multihop      bool
+    Relays        []Relay
     LastError     error
   }{
     Current:       current,
     CurrentRelays: currentRelays,
+    Status:        status,
+    StatusError:   statusError,
+    Multihop:      multihop,
     Relays:        relays,
     LastError:     lastError,
   })
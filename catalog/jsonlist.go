@@ -0,0 +1,205 @@
+package catalog
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net/http"
+  "os"
+  "slices"
+  "strconv"
+  "strings"
+)
+
+// defaultPort is the port of relays whose list has none.
+const defaultPort = 51820
+
+// jsonFields are the fields of a relay which can be mapped to keys of the
+// entries of a JSON relay list, and relays for the list itself.
+var jsonFields = []string{
+  "relays", "id", "hostname", "port", "public_key", "active", "owned",
+  "country", "city", "provider", "multihop_port",
+}
+
+// A JSONList is the adapter for a provider publishing its relays as a JSON
+// list, at a URL or in a file. Keys are dotted paths, e.g. location.city.
+type JSONList struct {
+  source string
+  keys   map[string]string // by field
+}
+
+// NewJSONList creates an adapter for the JSON relay list at source, an
+// http(s) URL or a file path, mapping relay fields to keys of its entries as
+// comma-separated field=key. Unmapped fields are keys of the same name and
+// relays is the key of the list in the document, empty if it is the list.
+func NewJSONList(source, mapping string) (*JSONList, error) {
+  if source == "" {
+    return nil, fmt.Errorf("catalog: no relay list")
+  }
+  l := &JSONList{source: source, keys: map[string]string{}}
+  for _, e := range jsonFields {
+    l.keys[e] = e
+  }
+  l.keys["relays"] = ""
+  for _, e := range strings.Split(mapping, ",") {
+    if strings.TrimSpace(e) == "" {
+      continue
+    }
+    field, key, ok := strings.Cut(strings.TrimSpace(e), "=")
+    if !ok || !slices.Contains(jsonFields, field) || (key == "" && field != "relays") {
+      return nil, fmt.Errorf("catalog: invalid mapping %q, want field=key with field in %v", e, strings.Join(jsonFields, ", "))
+    }
+    l.keys[field] = key
+  }
+  return l, nil
+}
+
+// Fetch fetches the relays of the list.
+func (l *JSONList) Fetch() ([]Relay, error) {
+  b, err := l.read()
+  if err != nil {
+    return nil, err
+  }
+  var doc any
+  d := json.NewDecoder(bytes.NewReader(b))
+  d.UseNumber()
+  if err := d.Decode(&doc); err != nil {
+    return nil, fmt.Errorf("catalog: %v: %v", l.source, err)
+  }
+  list, _ := lookup(doc, l.keys["relays"])
+  entries, ok := list.([]any)
+  if !ok {
+    return nil, fmt.Errorf("catalog: %v: no list of relays at %q", l.source, l.keys["relays"])
+  }
+  var relays []Relay
+  for i, e := range entries {
+    r, err := l.relay(e)
+    if err != nil {
+      return nil, fmt.Errorf("catalog: %v: relay %d: %v", l.source, i, err)
+    }
+    relays = append(relays, r)
+  }
+  if len(relays) == 0 {
+    return nil, fmt.Errorf("catalog: %v: no relays", l.source)
+  }
+  return relays, nil
+}
+
+// read reads the list from its URL or file.
+func (l *JSONList) read() ([]byte, error) {
+  if !strings.HasPrefix(l.source, "http://") && !strings.HasPrefix(l.source, "https://") {
+    return os.ReadFile(l.source)
+  }
+  resp, err := http.Get(l.source)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("catalog: %v: %v", l.source, resp.Status)
+  }
+  return io.ReadAll(resp.Body)
+}
+
+// relay maps an entry of the list to a relay. Hostname and public key are
+// required; the ID defaults to the hostname, the port to 51820 and relays
+// are active unless the list says otherwise.
+func (l *JSONList) relay(entry any) (Relay, error) {
+  r := Relay{Port: defaultPort, Active: true}
+  var err error
+  for _, f := range []struct {
+    field string
+    set   func(v any) error
+  }{
+    {"id", func(v any) error { r.ID, err = toString(v); return err }},
+    {"hostname", func(v any) error { r.Hostname, err = toString(v); return err }},
+    {"port", func(v any) error { r.Port, err = toInt(v); return err }},
+    {"public_key", func(v any) error { r.PublicKey, err = toString(v); return err }},
+    {"active", func(v any) error { r.Active, err = toBool(v); return err }},
+    {"owned", func(v any) error { r.Owned, err = toBool(v); return err }},
+    {"country", func(v any) error { r.Country, err = toString(v); return err }},
+    {"city", func(v any) error { r.City, err = toString(v); return err }},
+    {"provider", func(v any) error { r.Provider, err = toString(v); return err }},
+    {"multihop_port", func(v any) error { r.MultihopPort, err = toInt(v); return err }},
+  } {
+    v, ok := lookup(entry, l.keys[f.field])
+    if !ok || v == nil {
+      continue
+    }
+    if err := f.set(v); err != nil {
+      return r, fmt.Errorf("%v (%v): %v", f.field, l.keys[f.field], err)
+    }
+  }
+  if r.Hostname == "" {
+    return r, fmt.Errorf("no hostname (%v)", l.keys["hostname"])
+  }
+  if r.PublicKey == "" {
+    return r, fmt.Errorf("no public key (%v)", l.keys["public_key"])
+  }
+  if r.ID == "" {
+    r.ID = r.Hostname
+  }
+  return r, nil
+}
+
+// Peer returns the peer settings of the relays of a server: a relay at its
+// port, or the entry relay at the multihop port of the exit, with the key of
+// the exit.
+func (l *JSONList) Peer(relays []Relay) Peer {
+  entry, exit := relays[0], relays[len(relays)-1]
+  port := entry.Port
+  if len(relays) > 1 {
+    port = exit.MultihopPort
+  }
+  return Peer{
+    Endpoint:  fmt.Sprintf("%s:%d", entry.Hostname, port),
+    PublicKey: exit.PublicKey,
+  }
+}
+
+// lookup returns the value at a dotted path of keys, the value itself for
+// an empty path.
+func lookup(v any, path string) (any, bool) {
+  if path == "" {
+    return v, true
+  }
+  for _, key := range strings.Split(path, ".") {
+    m, ok := v.(map[string]any)
+    if !ok {
+      return nil, false
+    }
+    if v, ok = m[key]; !ok {
+      return nil, false
+    }
+  }
+  return v, true
+}
+
+func toString(v any) (string, error) {
+  switch v := v.(type) {
+  case string:
+    return v, nil
+  case json.Number:
+    return v.String(), nil
+  }
+  return "", fmt.Errorf("%v is not a string", v)
+}
+
+func toInt(v any) (int, error) {
+  s, err := toString(v)
+  if err != nil {
+    return 0, fmt.Errorf("%v is not a number", v)
+  }
+  return strconv.Atoi(s)
+}
+
+func toBool(v any) (bool, error) {
+  switch v := v.(type) {
+  case bool:
+    return v, nil
+  case string:
+    return strconv.ParseBool(v)
+  }
+  return false, fmt.Errorf("%v is not a boolean", v)
+}
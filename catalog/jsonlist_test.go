@@ -0,0 +1,124 @@
+package catalog
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+const testList = `{
+  "servers": [
+    {
+      "name": "se1",
+      "host": "se1.vpn.example",
+      "pubkey": "key1",
+      "location": {"country": "Sweden", "city": "Gothenburg"},
+      "online": true
+    },
+    {
+      "name": "ch1",
+      "host": "ch1.vpn.example",
+      "port": "4443",
+      "pubkey": "key2",
+      "location": {"country": "Switzerland"},
+      "online": false
+    }
+  ]
+}`
+
+const testMapping = "relays=servers,id=name,hostname=host,public_key=pubkey,country=location.country,city=location.city,active=online"
+
+func TestJSONList(t *testing.T) {
+  want := []Relay{
+    {ID: "se1", Hostname: "se1.vpn.example", Port: 51820, PublicKey: "key1", Country: "Sweden", City: "Gothenburg", Active: true},
+    {ID: "ch1", Hostname: "ch1.vpn.example", Port: 4443, PublicKey: "key2", Country: "Switzerland"},
+  }
+  file := filepath.Join(t.TempDir(), "relays.json")
+  if err := os.WriteFile(file, []byte(testList), 0644); err != nil {
+    t.Fatal(err)
+  }
+  srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(testList))
+  }))
+  defer srv.Close()
+  for _, source := range []string{file, srv.URL} {
+    l, err := NewJSONList(source, testMapping)
+    if err != nil {
+      t.Fatal(err)
+    }
+    relays, err := l.Fetch()
+    if err != nil {
+      t.Fatalf("Fetch() from %v: %v", source, err)
+    }
+    if !reflect.DeepEqual(relays, want) {
+      t.Errorf("Fetch() from %v = %+v; want %+v", source, relays, want)
+    }
+  }
+}
+
+func TestJSONListErrors(t *testing.T) {
+  file := filepath.Join(t.TempDir(), "relays.json")
+  if err := os.WriteFile(file, []byte(testList), 0644); err != nil {
+    t.Fatal(err)
+  }
+  for _, mapping := range []string{"hostname", "name=host", "id="} {
+    if _, err := NewJSONList(file, mapping); err == nil {
+      t.Errorf("NewJSONList(%q) succeeded; want invalid mapping", mapping)
+    }
+  }
+  for _, mapping := range []string{
+    "",               // the document is not the list
+    "relays=servers", // no hostname
+    "relays=servers,hostname=host,public_key=location", // not a string
+  } {
+    l, err := NewJSONList(file, mapping)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if _, err := l.Fetch(); err == nil {
+      t.Errorf("Fetch() with mapping %q succeeded; want error", mapping)
+    }
+  }
+}
+
+func TestJSONListSwitch(t *testing.T) {
+  file := filepath.Join(t.TempDir(), "relays.json")
+  if err := os.WriteFile(file, []byte(testList), 0644); err != nil {
+    t.Fatal(err)
+  }
+  l, err := NewJSONList(file, testMapping)
+  if err != nil {
+    t.Fatal(err)
+  }
+  s, restarts := newTestServer(t)
+  s.provider = l
+  relays, err := l.Fetch()
+  if err != nil {
+    t.Fatal(err)
+  }
+  s.SetRelays(relays)
+  if err := s.Switch("ch1.vpn.example:4443"); err != nil {
+    t.Fatal(err)
+  }
+  b, err := os.ReadFile(s.Config())
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := `[Interface]
+PrivateKey = private
+
+[Peer]
+PublicKey = key2
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = ch1.vpn.example:4443
+`
+  if string(b) != want {
+    t.Errorf("config = %v; want %v", string(b), want)
+  }
+  if len(*restarts) != 1 {
+    t.Errorf("restarts = %v; want 1", *restarts)
+  }
+}
@@ -0,0 +1,127 @@
+package catalog
+
+import (
+  "fmt"
+  "net"
+  "sort"
+  "strconv"
+  "time"
+)
+
+// FetchPeriodically fetches the relay list, then again every day.
+func (s *Server) FetchPeriodically() {
+  for ; ; time.Sleep(fetchInterval) {
+    relays, err := s.provider.Fetch()
+    s.m.Lock()
+    // if error, keep previous, it's stale but better than nothing
+    if err == nil {
+      s.relays = relays
+      s.fetched = time.Now()
+    }
+    s.error = err
+    s.m.Unlock()
+  }
+}
+
+// SetRelays sets the relay list, as fetched now by the caller.
+func (s *Server) SetRelays(relays []Relay) {
+  s.m.Lock()
+  defer s.m.Unlock()
+  s.relays = relays
+  s.fetched = time.Now()
+}
+
+// RelayListFetched returns when the relay list was last fetched successfully,
+// zero if never, and the error of the last fetch if it failed.
+func (s *Server) RelayListFetched() (time.Time, error) {
+  s.m.Lock()
+  defer s.m.Unlock()
+  return s.fetched, s.error
+}
+
+// Relays returns the relays as of the last fetch, and the error of the last
+// fetch if it failed.
+func (s *Server) Relays() ([]Relay, error) {
+  s.m.Lock()
+  defer s.m.Unlock()
+  return s.relays, s.error
+}
+
+// List lists available servers.
+func (s *Server) List() ([]string, error) {
+  relays, err := s.Relays()
+  if err != nil {
+    return nil, err
+  }
+  var servers []string
+  for _, e := range relays {
+    servers = append(servers, fmt.Sprintf("%s:%d", e.Hostname, e.Port))
+  }
+  return servers, nil
+}
+
+// Find finds the relays of a server.
+// If single-hop, it returns the single relay.
+// If multi-hop, it returns the entry relay then the exit.
+func (s *Server) Find(server string) ([]Relay, error) {
+  host, sport, err := net.SplitHostPort(server)
+  if err != nil {
+    return nil, err
+  }
+  port, err := strconv.Atoi(sport)
+  if err != nil {
+    return nil, err
+  }
+  relays, err := s.Relays()
+  if err != nil {
+    return nil, err
+  }
+  var entry Relay
+  for _, e := range relays {
+    // single-hop
+    if e.Hostname == host && e.Port == port {
+      return []Relay{e}, nil
+    }
+    // multi-hop
+    if e.Hostname == host {
+      entry = e
+    }
+  }
+  for _, e := range relays {
+    if e.MultihopPort != 0 && e.MultihopPort == port {
+      if entry.Hostname == "" {
+        return nil, fmt.Errorf("found exit server (multihop port) but not entry server %v", host)
+      }
+      return []Relay{entry, e}, nil
+    }
+  }
+  return nil, fmt.Errorf("server %v not found", server)
+}
+
+// Active returns whether the relays of the server are active according to
+// the provider, as of the last fetch.
+func (s *Server) Active(server string) (bool, error) {
+  relays, err := s.Find(server)
+  if err != nil {
+    return false, err
+  }
+  for _, r := range relays {
+    if !r.Active {
+      return false, nil
+    }
+  }
+  return true, nil
+}
+
+// sortRelays sorts relays by country, city and hostname.
+func sortRelays(relays []Relay) {
+  sort.Slice(relays, func(i, j int) bool {
+    if relays[i].Country == relays[j].Country {
+      if relays[i].City == relays[j].City {
+        return relays[i].Hostname < relays[j].Hostname
+      }
+      return relays[i].City < relays[j].City
+    }
+    return relays[i].Country < relays[j].Country
+  })
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes of commands.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const commandTimeout = 2 * time.Minute // switching can take a while
+
+// A client runs commands: against a running daemon, or the local backend.
+type client interface {
+	status() (*apiStatus, error)
+	switchServer(server string) error
+	next(group string) error
+}
+
+// runCommand runs a command from the command line, returning the exit code.
+func runCommand(args []string) int {
+	return runCommandTo(os.Stdout, os.Stderr, args, connect)
+}
+
+func runCommandTo(stdout, stderr io.Writer, args []string, connect func(local bool) (client, error)) int {
+	usage := func() {
+		fmt.Fprintf(stderr, "usage: switchman [flags] status [-json]\n")
+		fmt.Fprintf(stderr, "       switchman [flags] list [-filter text] [-names|-json] [-daemon-only]\n")
+		fmt.Fprintf(stderr, "       switchman [flags] switch [-json] <server>\n")
+		fmt.Fprintf(stderr, "       switchman [flags] next [-group group] [-json]\n")
+		fmt.Fprintf(stderr, "       switchman completion bash|zsh|fish\n")
+	}
+	if args[0] == "completion" {
+		if len(args) != 2 {
+			usage()
+			return exitUsage
+		}
+		if err := completion(stdout, args[1]); err != nil {
+			fmt.Fprintf(stderr, "switchman: %v\n", err)
+			return exitUsage
+		}
+		return exitOK
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	jsonOutput := fs.Bool("json", false, "Output JSON.")
+	var filter, group *string
+	var names, daemonOnly *bool
+	switch args[0] {
+	case "status", "switch":
+	case "list":
+		filter = fs.String("filter", "", "Only list servers containing the text.")
+		names = fs.Bool("names", false, "Only output server names, e.g. for completion.")
+		daemonOnly = fs.Bool("daemon-only", false, "Only list the servers of a running daemon, nothing without, e.g. for completion.")
+	case "next":
+		group = fs.String("group", "", "Switch to the next server of the group.")
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage()
+		return exitUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	want := 0
+	if args[0] == "switch" {
+		want = 1
+	}
+	if fs.NArg() != want {
+		usage()
+		return exitUsage
+	}
+
+	c, err := connect(daemonOnly == nil || !*daemonOnly)
+	if errors.Is(err, errNoDaemon) {
+		return exitOK // nothing to list
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "switchman: %v\n", err)
+		return exitError
+	}
+	switch args[0] {
+	case "switch":
+		err = c.switchServer(fs.Arg(0))
+	case "next":
+		err = c.next(*group)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "switchman: %v\n", err)
+		return exitError
+	}
+	st, err := c.status()
+	if err != nil {
+		fmt.Fprintf(stderr, "switchman: %v\n", err)
+		return exitError
+	}
+
+	switch {
+	case args[0] == "list":
+		servers := []string{}
+		for _, e := range st.Servers {
+			if strings.Contains(strings.ToLower(e), strings.ToLower(*filter)) {
+				servers = append(servers, e)
+			}
+		}
+		if *jsonOutput {
+			if code := writeJSON(stdout, stderr, servers); code != exitOK {
+				return code
+			}
+		} else {
+			for _, e := range servers {
+				mark := "  "
+				if *names {
+					mark = ""
+				} else if e == st.Current {
+					mark = "* "
+				}
+				fmt.Fprintf(stdout, "%s%s\n", mark, e)
+			}
+		}
+		if len(servers) == 0 {
+			fmt.Fprintf(stderr, "switchman: no server matches %q\n", *filter)
+			return exitError
+		}
+
+	case *jsonOutput:
+		return writeJSON(stdout, stderr, st)
+
+	default:
+		writeStatus(stdout, st)
+	}
+	return exitOK
+}
+
+func writeJSON(stdout, stderr io.Writer, v any) int {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(stderr, "switchman: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeStatus writes the status as a table.
+func writeStatus(w io.Writer, st *apiStatus) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "backend\t%v\n", st.Backend)
+	fmt.Fprintf(tw, "current\t%v\n", st.Current)
+	fmt.Fprintf(tw, "servers\t%d\n", len(st.Servers))
+	if st.StatusError != "" {
+		fmt.Fprintf(tw, "status\t%v\n", st.StatusError)
+	}
+	if e := st.Exit; e != nil {
+		var ips []string
+		for _, x := range e.Exits {
+			ips = append(ips, x.IP)
+		}
+		fmt.Fprintf(tw, "exit\t%v (%v) %v\n", e.Verdict, strings.Join(ips, ", "), e.Reason)
+	}
+	if l := st.Leak; l != nil {
+		leak := "no leak detected"
+		if l.Leak() {
+			leak = "leak detected: " + strings.Join(l.Leaks, "; ")
+		}
+		fmt.Fprintf(tw, "leak\t%v\n", leak)
+	}
+	if f := st.Failover; f != nil {
+		failover := "healthy"
+		if f.Failures > 0 {
+			failover = fmt.Sprintf("%d failed checks: %v", f.Failures, f.Reason)
+		}
+		fmt.Fprintf(tw, "failover\t%v\n", failover)
+	}
+	tw.Flush()
+}
+
+// errNoDaemon is returned by connect when no daemon is running and the local
+// backend is not wanted.
+var errNoDaemon = errors.New("no daemon running")
+
+// connect returns a client for the daemon: at -daemon if set, otherwise
+// the unix socket then the listen address on localhost, or if no daemon is
+// running, the local backend if local, otherwise errNoDaemon.
+func connect(local bool) (client, error) {
+	if *flagDaemon != "" {
+		return newDaemonClient(*flagDaemon)
+	}
+	var addrs []string
+	if *flagSocket != "" {
+		addrs = append(addrs, *flagSocket)
+	}
+	if _, port, err := net.SplitHostPort(*flagListen); err == nil {
+		addrs = append(addrs, "http://"+net.JoinHostPort("localhost", port))
+	}
+	for _, addr := range addrs {
+		c, err := newDaemonClient(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.status(); !isUnreachable(err) {
+			return c, nil
+		}
+	}
+	if !local {
+		return nil, errNoDaemon
+	}
+	fmt.Fprintf(os.Stderr, "switchman: no daemon running, using the local backend\n")
+	return newLocalClient()
+}
+
+// isUnreachable returns whether an error is from failing to connect.
+func isUnreachable(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// A daemonClient runs commands against a running daemon over HTTP.
+type daemonClient struct {
+	base   string
+	client *http.Client
+}
+
+// newDaemonClient creates a client for a daemon at a unix socket path or
+// an http(s) URL.
+func newDaemonClient(addr string) (*daemonClient, error) {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return &daemonClient{base: strings.TrimSuffix(addr, "/"), client: &http.Client{Timeout: commandTimeout}}, nil
+	}
+	if !strings.HasPrefix(addr, "/") {
+		return nil, fmt.Errorf("daemon %v: want a unix socket path or an http(s) URL", addr)
+	}
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", addr)
+	}
+	return &daemonClient{
+		base:   "http://switchman",
+		client: &http.Client{Timeout: commandTimeout, Transport: &http.Transport{DialContext: dial}},
+	}, nil
+}
+
+// get requests a path, returning the body or the error returned by the daemon.
+func (c *daemonClient) get(path string, query url.Values) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.base+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+func (c *daemonClient) status() (*apiStatus, error) {
+	b, err := c.get("/api/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	var st apiStatus
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (c *daemonClient) switchServer(server string) error {
+	_, err := c.get("/switch", url.Values{"server": {server}})
+	return err
+}
+
+func (c *daemonClient) next(group string) error {
+	q := url.Values{}
+	if group != "" {
+		q.Set("group", group)
+	}
+	_, err := c.get("/next", q)
+	return err
+}
+
+// A localClient runs commands directly on the local backend, recording
+// switches in the audit log. Checks and hooks are only run by the daemon.
+type localClient struct {
+	s *server
+}
+
+func newLocalClient() (*localClient, error) {
+	sw, err := newBackend()
+	if err != nil {
+		return nil, err
+	}
+	s := newServer(sw)
+	if *flagAuditLog != "" {
+		s.audit = newAuditLog(*flagAuditLog)
+	}
+	if s.state, err = loadState(*flagState); err != nil {
+		return nil, err
+	}
+	return &localClient{s: s}, nil
+}
+
+func (c *localClient) origin(action string) origin {
+	o := origin{Action: action, Remote: "local"}
+	if u, err := user.Current(); err == nil {
+		o.User = u.Username
+	}
+	return o
+}
+
+func (c *localClient) status() (*apiStatus, error) {
+	return apiStatusOf(c.s)
+}
+
+func (c *localClient) switchServer(server string) error {
+	server, err := c.s.match(server)
+	if err != nil {
+		return err
+	}
+	return c.s.switchServer(c.origin("switch"), server)
+}
+
+func (c *localClient) next(group string) error {
+	var server string
+	var err error
+	if group != "" {
+		server, err = nextInGroup(c.s, group)
+	} else {
+		server, err = next(c.s)
+	}
+	if err != nil {
+		return err
+	}
+	return c.s.switchServer(c.origin("next"), server)
+}
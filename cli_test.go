@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	fake := &fakeSwitchable{current: "b", servers: []string{"se1", "b", "ch1"}}
+	ts := httptest.NewServer(newServer(fake).handler())
+	defer ts.Close()
+	connect := func(bool) (client, error) { return newDaemonClient(ts.URL) }
+
+	for _, tt := range []struct {
+		args   []string
+		code   int
+		stdout string
+	}{
+		{[]string{"list"}, exitOK, "* b\n  ch1\n  se1\n"},
+		{[]string{"list", "-filter", "SE"}, exitOK, "  se1\n"},
+		{[]string{"list", "-filter", "us"}, exitError, ""},
+		{[]string{"switch", "se1"}, exitOK, "backend  *main.fakeSwitchable\ncurrent  se1\nservers  3\n"},
+		{[]string{"list", "-json"}, exitOK, "[\n  \"b\",\n  \"ch1\",\n  \"se1\"\n]\n"},
+		{[]string{"next"}, exitOK, "backend  *main.fakeSwitchable\ncurrent  b\nservers  3\n"},
+		{[]string{"list", "-filter", "b"}, exitOK, "* b\n"},
+		{[]string{"list", "-names"}, exitOK, "b\nch1\nse1\n"},
+		{[]string{"switch", "ch"}, exitOK, "backend  *main.fakeSwitchable\ncurrent  ch1\nservers  3\n"},
+		{[]string{"switch", "s"}, exitOK, "backend  *main.fakeSwitchable\ncurrent  se1\nservers  3\n"},
+		{[]string{"switch", "nowhere"}, exitError, ""},
+		{[]string{"switch"}, exitUsage, ""},
+		{[]string{"status", "extra"}, exitUsage, ""},
+		{[]string{"status", "-bogus"}, exitUsage, ""},
+		{[]string{"bogus"}, exitUsage, ""},
+		{[]string{"completion"}, exitUsage, ""},
+		{[]string{"completion", "csh"}, exitUsage, ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := runCommandTo(&stdout, &stderr, tt.args, connect)
+		if code != tt.code || stdout.String() != tt.stdout {
+			t.Errorf("%q: code %v, stdout %q (stderr %q); want code %v, stdout %q", tt.args, code, stdout.String(), stderr.String(), tt.code, tt.stdout)
+		}
+	}
+}
+
+func TestRunCommandStatusJSON(t *testing.T) {
+	fake := &fakeSwitchable{current: "b", servers: []string{"a", "b"}}
+	ts := httptest.NewServer(newServer(fake).handler())
+	defer ts.Close()
+	var stdout, stderr bytes.Buffer
+	code := runCommandTo(&stdout, &stderr, []string{"status", "-json"}, func(bool) (client, error) { return newDaemonClient(ts.URL) })
+	if code != exitOK {
+		t.Fatalf("code = %v (stderr %q); want %v", code, stderr.String(), exitOK)
+	}
+	var st apiStatus
+	if err := json.Unmarshal(stdout.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Current != "b" || len(st.Servers) != 2 {
+		t.Errorf("status = %+v; want current b and 2 servers", st)
+	}
+}
+
+func TestDaemonClientSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "switchman.sock")
+	c, err := newDaemonClient(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.status(); !isUnreachable(err) {
+		t.Errorf("status() without daemon = %v; want unreachable", err)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(&fakeSwitchable{current: "a", servers: []string{"a", "b"}})
+	srv.audit = newAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	go unixServer(srv.handler()).Serve(l)
+	defer l.Close()
+	if err := c.switchServer("b"); err != nil {
+		t.Fatal(err)
+	}
+	st, err := c.status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Current != "b" {
+		t.Errorf("current = %v; want b", st.Current)
+	}
+	// the user comes from the credentials of the socket, not from the client
+	entries, err := srv.audit.read(auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := user.Current(); err == nil && (len(entries) != 1 || entries[0].User != u.Username) {
+		t.Errorf("audit = %+v; want a switch by %v", entries, u.Username)
+	}
+	if err := c.switchServer("c"); err == nil || !strings.Contains(err.Error(), "no server matches") {
+		t.Errorf("switchServer(c) = %v; want no match", err)
+	}
+
+	if _, err := newDaemonClient("localhost:8080"); err == nil {
+		t.Errorf("newDaemonClient(localhost:8080) = nil error; want error")
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for shell := range completions {
+		var stdout, stderr bytes.Buffer
+		if code := runCommandTo(&stdout, &stderr, []string{"completion", shell}, nil); code != exitOK {
+			t.Errorf("completion %v: code %v (stderr %q); want %v", shell, code, stderr.String(), exitOK)
+		}
+		if !strings.Contains(stdout.String(), "switchman list -names -daemon-only") {
+			t.Errorf("completion %v: does not complete servers of the daemon", shell)
+		}
+	}
+
+	// without daemon, nothing rather than the local backend
+	var stdout, stderr bytes.Buffer
+	code := runCommandTo(&stdout, &stderr, []string{"list", "-names", "-daemon-only"}, func(local bool) (client, error) {
+		if local {
+			t.Errorf("list -daemon-only: connect(local = true); want no local backend")
+		}
+		return nil, errNoDaemon
+	})
+	if code != exitOK || stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("list -daemon-only without daemon: code %v, stdout %q, stderr %q; want %v, nothing", code, stdout.String(), stderr.String(), exitOK)
+	}
+}
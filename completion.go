@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// completions are shell completion scripts for commands, completing servers
+// from the live list of a running daemon with switchman list -names
+// -daemon-only, not to detect and query a backend on every TAB.
+var completions = map[string]string{
+	"bash": `# bash completion for switchman, install with:
+#   switchman completion bash > /etc/bash_completion.d/switchman
+_switchman() {
+  local cur words cword
+  if declare -F _init_completion >/dev/null; then
+    _init_completion -n : || return
+  else
+    cur=${COMP_WORDS[COMP_CWORD]} words=("${COMP_WORDS[@]}") cword=$COMP_CWORD
+  fi
+  case $cword in
+  1)
+    COMPREPLY=($(compgen -W "status list switch next completion" -- "$cur"))
+    ;;
+  2)
+    case ${words[1]} in
+    switch)
+      local IFS=$'\n'
+      COMPREPLY=($(compgen -W "$(switchman list -names -daemon-only 2>/dev/null)" -- "$cur"))
+      if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+      fi
+      ;;
+    completion)
+      COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+      ;;
+    esac
+    ;;
+  esac
+}
+complete -F _switchman switchman
+`,
+	"zsh": `#compdef switchman
+# zsh completion for switchman, install with:
+#   switchman completion zsh > "${fpath[1]}/_switchman"
+_switchman() {
+  local -a servers
+  case $CURRENT in
+  2)
+    compadd status list switch next completion
+    ;;
+  3)
+    case $words[2] in
+    switch)
+      servers=(${(f)"$(switchman list -names -daemon-only 2>/dev/null)"})
+      compadd -a servers
+      ;;
+    completion)
+      compadd bash zsh fish
+      ;;
+    esac
+    ;;
+  esac
+}
+if [ "$funcstack[1]" = "_switchman" ]; then
+  _switchman "$@"
+else
+  compdef _switchman switchman
+fi
+`,
+	"fish": `# fish completion for switchman, install with:
+#   switchman completion fish > ~/.config/fish/completions/switchman.fish
+complete -c switchman -f
+complete -c switchman -n __fish_use_subcommand -a 'status list switch next completion'
+complete -c switchman -n '__fish_seen_subcommand_from switch' -a '(switchman list -names -daemon-only 2>/dev/null)'
+complete -c switchman -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`,
+}
+
+// completion writes the completion script of a shell.
+func completion(w io.Writer, shell string) error {
+	script, ok := completions[shell]
+	if !ok {
+		return fmt.Errorf("unknown shell %q, want bash, zsh or fish", shell)
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
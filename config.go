@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfig is the config file read if it exists, unless -config is set.
+const defaultConfig = "/etc/switchman/config.json"
+
+// restartFlags are flags which only take effect at startup, not on reload.
+var restartFlags = []string{
+	"config", "listen", "socket",
+	"mullvad", "mullvadapp", "openvpn", "wireguard", "tailscale", "catalog",
+	"mullvad-account", "mullvad-key-rotation", "mullvadapp-grpc",
+	"openvpn-management", "openvpn-profiles", "wireguard-profiles", "tailscale-socket",
+	"catalog-list", "catalog-map",
+}
+
+// A config is the settings of a config file: flag values by flag name.
+// Repeatable flags can have several values.
+type config map[string][]string
+
+// readConfig reads a JSON config file: an object of flag names without dash
+// to values, e.g. {"listen": ":81", "exit-check": true, "tunnel": ["se=wg0"]}.
+// A missing file is an empty config unless required.
+func readConfig(fs *flag.FlagSet, path string, required bool) (config, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseConfig(fs, b)
+	if err != nil {
+		return nil, fmt.Errorf("config %v: %v", path, err)
+	}
+	return c, nil
+}
+
+// parseConfig parses and validates a JSON config.
+func parseConfig(fs *flag.FlagSet, b []byte) (config, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line := 1 + bytes.Count(b[:syntax.Offset], []byte("\n"))
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil, err
+	}
+	c := config{}
+	for name, v := range raw {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		values, err := configValues(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		c[name] = values
+	}
+	return c, nil
+}
+
+// configValues returns the values of a setting: a string, number or boolean,
+// or a list of strings for repeatable flags.
+func configValues(f *flag.Flag, v json.RawMessage) ([]string, error) {
+	_, repeatable := f.Value.(*multiFlag)
+	var values []string
+	if repeatable {
+		if err := json.Unmarshal(v, &values); err == nil {
+			return values, nil
+		}
+	}
+	var value any
+	if err := json.Unmarshal(v, &value); err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case bool:
+		return []string{strconv.FormatBool(value)}, nil
+	case float64:
+		return []string{string(v)}, nil
+	}
+	if repeatable {
+		return nil, fmt.Errorf("want a string or a list of strings")
+	}
+	return nil, fmt.Errorf("want a string, number or boolean")
+}
+
+// envName returns the environment variable overriding a flag:
+// SWITCHMAN_EXIT_CHECK for exit-check.
+func envName(flag string) string {
+	return "SWITCHMAN_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyConfig sets flags not set on the command line from the environment,
+// then the config read from path, then their default. Repeatable flags are
+// separated by spaces in the environment. Values are all validated before
+// any is set.
+func applyConfig(fs *flag.FlagSet, path string, c config, getenv func(string) (string, bool), cmdline map[string]bool) error {
+	values := map[string][]string{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || cmdline[f.Name] || f.Name == "config" {
+			return
+		}
+		_, repeatable := f.Value.(*multiFlag)
+		v, ok := c[f.Name]
+		source := "config " + path
+		if env, set := getenv(envName(f.Name)); set {
+			v, ok, source = []string{env}, true, envName(f.Name)
+			if repeatable {
+				v = strings.Fields(env)
+			}
+		}
+		if !ok {
+			v, source = []string{f.DefValue}, "default"
+			if repeatable {
+				v = nil
+			}
+		}
+		for _, e := range v {
+			if verr := validValue(f.Value, e); verr != nil {
+				err = fmt.Errorf("%v: %v: invalid value %q: %v", source, f.Name, e, verr)
+				return
+			}
+		}
+		values[f.Name] = v
+	})
+	if err != nil {
+		return err
+	}
+	for name, v := range values {
+		f := fs.Lookup(name)
+		if m, ok := f.Value.(*multiFlag); ok {
+			*m = nil
+		}
+		for _, e := range v {
+			if err := f.Value.Set(e); err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validValue returns an error if a value cannot be set, without setting it.
+func validValue(v flag.Value, s string) error {
+	g, ok := v.(flag.Getter)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch g.Get().(type) {
+	case bool:
+		_, err = strconv.ParseBool(s)
+	case int:
+		_, err = strconv.ParseInt(s, 0, strconv.IntSize)
+	case time.Duration:
+		_, err = time.ParseDuration(s)
+	}
+	return err
+}
+
+// loadConfig reads the config file, required if not the default, then sets
+// the flags not set on the command line.
+func loadConfig(fs *flag.FlagSet, path string, cmdline map[string]bool) error {
+	c, err := readConfig(fs, path, path != defaultConfig)
+	if err != nil {
+		return err
+	}
+	return applyConfig(fs, path, c, os.LookupEnv, cmdline)
+}
+
+// restartValues returns the values of the flags which need a restart.
+func restartValues(fs *flag.FlagSet) map[string]string {
+	values := map[string]string{}
+	for _, name := range restartFlags {
+		values[name] = fs.Lookup(name).Value.String()
+	}
+	return values
+}
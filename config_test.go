@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFlags() (*flag.FlagSet, *string, *bool, *time.Duration, *multiFlag) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	listen := fs.String("listen", ":81", "")
+	check := fs.Bool("exit-check", false, "")
+	cooldown := fs.Duration("failover-cooldown", 10*time.Minute, "")
+	var tunnels multiFlag
+	fs.Var(&tunnels, "tunnel", "")
+	return fs, listen, check, cooldown, &tunnels
+}
+
+func TestParseConfig(t *testing.T) {
+	fs, _, _, _, _ := testFlags()
+	for _, tt := range []struct {
+		config string
+		err    string
+	}{
+		{config: `{"listen": ":82", "exit-check": true, "failover-cooldown": "1h", "tunnel": ["se=wg0", "us=wg1"]}`},
+		{config: `{"tunnel": "se=wg0"}`},
+		{config: `{"listen": 82}`},
+		{config: `{"lisen": ":82"}`, err: `unknown setting "lisen"`},
+		{config: `{"tunnel": {"se": "wg0"}}`, err: "tunnel: want a string or a list of strings"},
+		{config: `{"listen": [":82"]}`, err: "listen: want a string, number or boolean"},
+		{config: "{\n\"listen\": \":82\",\n}", err: "line 3:"},
+	} {
+		_, err := parseConfig(fs, []byte(tt.config))
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("parseConfig(%q) = %v; want error %q", tt.config, err, tt.err)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	fs, listen, check, cooldown, tunnels := testFlags()
+	if err := fs.Parse([]string{"-listen", ":83"}); err != nil {
+		t.Fatal(err)
+	}
+	cmdline := map[string]bool{"listen": true}
+	c, err := parseConfig(fs, []byte(`{"listen": ":82", "exit-check": true, "failover-cooldown": "1h", "tunnel": ["se=wg0", "us=wg1"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"SWITCHMAN_FAILOVER_COOLDOWN": "5m"}
+	getenv := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+	if err := applyConfig(fs, "config.json", c, getenv, cmdline); err != nil {
+		t.Fatal(err)
+	}
+	if *listen != ":83" || !*check || *cooldown != 5*time.Minute || !slices.Equal(*tunnels, []string{"se=wg0", "us=wg1"}) {
+		t.Errorf("applyConfig: got listen %v, exit-check %v, cooldown %v, tunnels %v", *listen, *check, *cooldown, *tunnels)
+	}
+
+	// reload: invalid values leave everything unchanged
+	env["SWITCHMAN_EXIT_CHECK"] = "maybe"
+	if err := applyConfig(fs, "config.json", config{}, getenv, cmdline); err == nil || !strings.Contains(err.Error(), "SWITCHMAN_EXIT_CHECK") {
+		t.Errorf("applyConfig with invalid environment: %v", err)
+	}
+	if !*check || len(*tunnels) != 2 {
+		t.Errorf("applyConfig partially applied an invalid config")
+	}
+
+	// reload: settings removed from the config are back to their default
+	delete(env, "SWITCHMAN_EXIT_CHECK")
+	env["SWITCHMAN_TUNNEL"] = "se=wg0 nl=wg2"
+	if err := applyConfig(fs, "config.json", config{}, getenv, cmdline); err != nil {
+		t.Fatal(err)
+	}
+	if *check || *cooldown != 5*time.Minute || !slices.Equal(*tunnels, []string{"se=wg0", "nl=wg2"}) {
+		t.Errorf("applyConfig: got exit-check %v, cooldown %v, tunnels %v", *check, *cooldown, *tunnels)
+	}
+}
@@ -0,0 +1,76 @@
+// Package detect describes how well a backend matches the host, to choose
+// one predictably and explain why.
+package detect
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// A Result is the probe of a backend on the host.
+type Result struct {
+	Backend string `json:"backend"`
+	// Confidence that the backend is the one in use, from 0 (not usable) to 100.
+	Confidence int      `json:"confidence"`
+	Reason     string   `json:"reason"`
+	Found      []string `json:"found,omitempty"`   // files, binaries and interfaces
+	Missing    []string `json:"missing,omitempty"` // files, binaries and interfaces
+}
+
+// New returns an empty result for a backend.
+func New(backend string) *Result {
+	return &Result{Backend: backend}
+}
+
+// Score sets the confidence and its reason.
+func (r *Result) Score(confidence int, format string, a ...any) *Result {
+	r.Confidence = confidence
+	r.Reason = fmt.Sprintf(format, a...)
+	return r
+}
+
+// File returns whether a file or directory exists, and notes it.
+func (r *Result) File(path string) bool {
+	_, err := os.Stat(path)
+	return r.note(err == nil, "file "+path)
+}
+
+// Binary returns whether a binary is in PATH, and notes it.
+func (r *Result) Binary(name string) bool {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return r.note(false, "binary "+name)
+	}
+	return r.note(true, "binary "+path)
+}
+
+// Interface returns whether a network interface exists, and notes it.
+func (r *Result) Interface(name string) bool {
+	_, err := net.InterfaceByName(name)
+	return r.note(err == nil, "interface "+name)
+}
+
+func (r *Result) note(found bool, what string) bool {
+	if found {
+		r.Found = append(r.Found, what)
+	} else {
+		r.Missing = append(r.Missing, what)
+	}
+	return found
+}
+
+// Rank sorts results by decreasing confidence, keeping the given order for
+// equal confidence, and returns those usable.
+func Rank(results []*Result) []*Result {
+	ranked := append([]*Result(nil), results...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Confidence > ranked[j].Confidence })
+	for i, r := range ranked {
+		if r.Confidence <= 0 {
+			return ranked[:i]
+		}
+	}
+	return ranked
+}
@@ -0,0 +1,39 @@
+package detect
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRank(t *testing.T) {
+	a := New("a").Score(50, "a")
+	b := New("b").Score(90, "b")
+	c := New("c").Score(0, "c")
+	d := New("d").Score(50, "d")
+	got := Rank([]*Result{a, b, c, d})
+	if want := []*Result{b, a, d}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank = %v; want %v", got, want)
+	}
+}
+
+func TestNote(t *testing.T) {
+	dir := t.TempDir()
+	r := New("test")
+	if !r.File(dir) {
+		t.Errorf("File(%v) = false", dir)
+	}
+	missing := filepath.Join(dir, "missing")
+	if r.File(missing) {
+		t.Errorf("File(%v) = true", missing)
+	}
+	if r.Interface("switchman-test0") {
+		t.Error("Interface(switchman-test0) = true")
+	}
+	if !reflect.DeepEqual(r.Found, []string{"file " + dir}) {
+		t.Errorf("Found = %v", r.Found)
+	}
+	if want := []string{"file " + missing, "interface switchman-test0"}; !reflect.DeepEqual(r.Missing, want) {
+		t.Errorf("Missing = %v; want %v", r.Missing, want)
+	}
+}
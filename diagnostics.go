@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/StalkR/switchman/catalog"
+	"github.com/StalkR/switchman/detect"
+	"github.com/StalkR/switchman/mullvad"
+	"github.com/StalkR/switchman/mullvadapp"
+	"github.com/StalkR/switchman/openvpn"
+	"github.com/StalkR/switchman/tailscale"
+	"github.com/StalkR/switchman/wireguard"
+)
+
+// A backend is a supported VPN, probed by autodetection.
+type backend struct {
+	name   string
+	flag   *bool // selects it explicitly
+	detect func() *detect.Result
+	new    func() (Switchable, error)
+}
+
+// backends returns the supported VPNs, in order of preference for the same
+// detection confidence.
+func backends() []backend {
+	return []backend{
+		{"mullvad", flagMullvad, mullvad.Detect, func() (Switchable, error) { return mullvad.New(mullvadOptions()...) }},
+		{"mullvadapp", flagMullvadApp, mullvadapp.Detect, newMullvadApp},
+		{"openvpn", flagOpenVPN,
+			func() *detect.Result { return openvpn.Detect(openvpnOptions()...) },
+			func() (Switchable, error) { return openvpn.New(openvpnOptions()...) }},
+		{"wireguard", flagWireGuard,
+			func() *detect.Result { return wireguard.Detect(wireguardOptions()...) },
+			func() (Switchable, error) { return wireguard.New(wireguardOptions()...) }},
+		{"tailscale", flagTailscale,
+			func() *detect.Result { return tailscale.Detect(tailscaleOptions()...) },
+			func() (Switchable, error) { return tailscale.New(tailscaleOptions()...) }},
+		{"catalog", flagCatalog,
+			func() *detect.Result {
+				return catalog.Detect(*flagCatalogList, "/etc/wireguard/"+catalogDevice+".conf", catalogDevice)
+			},
+			newCatalog},
+	}
+}
+
+// detectBackends probes each backend.
+func detectBackends() []*detect.Result {
+	var results []*detect.Result
+	for _, b := range backends() {
+		results = append(results, b.detect())
+	}
+	return results
+}
+
+// selectedBy returns the flag selecting the backend, or empty if autodetected.
+func selectedBy() string {
+	for _, b := range backends() {
+		if *b.flag {
+			return "-" + b.name
+		}
+	}
+	return ""
+}
+
+// autodetect creates the backend detected with the highest confidence, or
+// the next if it fails.
+func autodetect() (Switchable, error) {
+	results := detectBackends()
+	var reasons []string
+	failed := map[string]bool{}
+	for _, r := range detect.Rank(results) {
+		for _, b := range backends() {
+			if b.name != r.Backend {
+				continue
+			}
+			s, err := b.new()
+			if err == nil {
+				log.Printf("detected %v (confidence %d): %v", r.Backend, r.Confidence, r.Reason)
+				return s, nil
+			}
+			failed[r.Backend] = true
+			reasons = append(reasons, fmt.Sprintf("%v: %v", r.Backend, err))
+		}
+	}
+	for _, r := range results {
+		if !failed[r.Backend] {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", r.Backend, r.Reason))
+		}
+	}
+	return nil, fmt.Errorf("no supported VPN found (%v)", strings.Join(reasons, "; "))
+}
+
+// writeDetection writes the detection results as text, for -detect.
+func writeDetection(w io.Writer, results []*detect.Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "BACKEND\tCONFIDENCE\tREASON\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v\t%d\t%v\n", r.Backend, r.Confidence, r.Reason)
+		if len(r.Found) > 0 {
+			fmt.Fprintf(tw, "\t\tfound: %v\n", strings.Join(r.Found, ", "))
+		}
+		if len(r.Missing) > 0 {
+			fmt.Fprintf(tw, "\t\tmissing: %v\n", strings.Join(r.Missing, ", "))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	switch by, ranked := selectedBy(), detect.Rank(results); {
+	case by != "":
+		fmt.Fprintf(w, "selected by %v\n", by)
+	case len(ranked) > 0:
+		fmt.Fprintf(w, "detected: %v\n", ranked[0].Backend)
+	default:
+		fmt.Fprintf(w, "no supported VPN found\n")
+	}
+	return nil
+}
+
+var diagnosticsTmpl = template.Must(template.New("").Parse(`<p>Running: {{.Running}}, {{if .SelectedBy}}selected by {{.SelectedBy}}{{else}}autodetected{{end}}</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Backend</th>
+      <th align="left">Confidence</th>
+      <th align="left">Reason</th>
+      <th align="left">Found</th>
+      <th align="left">Missing</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Results}}
+    <tr{{if eq .Backend $.Running}} style="font-weight: bold;"{{end}}>
+      <td>{{.Backend}}</td>
+      <td>{{.Confidence}}</td>
+      <td>{{.Reason}}</td>
+      <td>{{range .Found}}{{.}}<br>{{end}}</td>
+      <td>{{range .Missing}}{{.}}<br>{{end}}</td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>`))
+
+// diagnostics is the data of /diagnostics.
+type diagnostics struct {
+	Running    string           `json:"running"`
+	SelectedBy string           `json:"selected_by,omitempty"` // flag, or empty if autodetected
+	Results    []*detect.Result `json:"results"`
+}
+
+// handleDiagnostics shows how each backend matches the host, or returns it
+// as JSON for non-browsers.
+func (s *server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/diagnostics" {
+		http.NotFound(w, r)
+		return
+	}
+	d := diagnostics{
+		Running:    backendName(s.Switchable),
+		SelectedBy: selectedBy(),
+		Results:    detectBackends(),
+	}
+	if !acceptsHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	var content bytes.Buffer
+	if err := diagnosticsTmpl.Execute(&content, d); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	if err := page(w, s, content.String()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/StalkR/switchman/detect"
+)
+
+func TestWriteDetection(t *testing.T) {
+	wg := detect.New("wireguard").Score(60, "/etc/wireguard/wg0.conf, wg0 up")
+	wg.Found = []string{"file /etc/wireguard/wg0.conf", "interface wg0"}
+	results := []*detect.Result{
+		detect.New("mullvad").Score(0, "not a Mullvad relay"),
+		detect.New("mullvadapp").Score(60, "mullvad cli found"),
+		wg,
+	}
+	var b strings.Builder
+	if err := writeDetection(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	want := `BACKEND     CONFIDENCE  REASON
+mullvad     0           not a Mullvad relay
+mullvadapp  60          mullvad cli found
+wireguard   60          /etc/wireguard/wg0.conf, wg0 up
+                        found: file /etc/wireguard/wg0.conf, interface wg0
+detected: mullvadapp
+`
+	if b.String() != want {
+		t.Errorf("writeDetection:\n%v\nwant:\n%v", b.String(), want)
+	}
+}
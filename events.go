@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthPollInterval = 5 * time.Second
+	eventsKeepalive    = 30 * time.Second
+)
+
+// An event is pushed to clients of /events: switch-started, switch-finished,
+// health-changed or relay-list-refreshed.
+type event struct {
+	Type string
+	Data any
+}
+
+// A broker publishes events to subscribers. The zero value is ready to use.
+type broker struct {
+	m           sync.Mutex // protects below
+	subscribers map[chan event]bool
+}
+
+// subscribe returns a channel receiving events, until unsubscribed.
+func (b *broker) subscribe() chan event {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan event]bool{}
+	}
+	ch := make(chan event, 16)
+	b.subscribers[ch] = true
+	return ch
+}
+
+func (b *broker) unsubscribe(ch chan event) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// publish sends an event to subscribers, skipping those not keeping up.
+func (b *broker) publish(typ string, data any) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event{Type: typ, Data: data}:
+		default:
+		}
+	}
+}
+
+func (b *broker) active() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return len(b.subscribers) > 0
+}
+
+// A switchStart is the data of a switch-started event.
+type switchStart struct {
+	Action string `json:"action"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// health is the data of a health-changed event.
+type health struct {
+	Exit      string `json:"exit,omitempty"`      // verdict of the exit check
+	Leak      string `json:"leak,omitempty"`      // leak check: ok or leak
+	Handshake string `json:"handshake,omitempty"` // WireGuard: ok, stale or down
+	Tunnel    string `json:"tunnel,omitempty"`    // Mullvad app: connection state
+}
+
+// notifier is implemented by backends which notify changes as they happen,
+// e.g. from Mullvad daemon events, to publish health without waiting for the
+// next poll.
+type notifier interface {
+	Changed() <-chan struct{}
+}
+
+// health returns the health from the last checks and the WireGuard or
+// Mullvad app status.
+func (s *server) health() health {
+	var h health
+	if s.exits != nil {
+		if c := s.exits.Last(); c != nil {
+			h.Exit = c.Verdict
+		}
+	}
+	if s.leaks != nil {
+		if r := s.leaks.Last(); r != nil {
+			h.Leak = "ok"
+			if r.Leak() {
+				h.Leak = "leak"
+			}
+		}
+	}
+	if ws, ok := s.Switchable.(wireGuardStatusable); ok {
+		h.Handshake = "ok"
+		d, err := ws.Status()
+		switch {
+		case err != nil || len(d.Peers) == 0:
+			h.Handshake = "down"
+		case d.Peers[0].Stale():
+			h.Handshake = "stale"
+		}
+	}
+	if ms, ok := s.Switchable.(mullvadAppStatusable); ok {
+		h.Tunnel = "unknown"
+		if state, err := ms.Status(); err == nil {
+			h.Tunnel = state.State
+		}
+	}
+	return h
+}
+
+// watch publishes health and relay list changes, polling while there are
+// clients of /events, or when the backend notifies a change, until ctx is
+// done.
+func (s *server) watch(ctx context.Context) {
+	var last health
+	var known bool
+	var fetched time.Time
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+	var changed <-chan struct{}
+	if n, ok := s.Switchable.(notifier); ok {
+		changed = n.Changed()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+		if !s.events.active() {
+			continue
+		}
+		if h := s.health(); h != last || !known {
+			if known {
+				s.events.publish("health-changed", h)
+			}
+			last, known = h, true
+		}
+		if c, ok := s.Switchable.(relayCatalog); ok {
+			t, _ := c.RelayListFetched()
+			if !fetched.IsZero() && !t.Equal(fetched) {
+				s.events.publish("relay-list-refreshed", struct {
+					Time time.Time `json:"time"`
+				}{t})
+			}
+			fetched = t
+		}
+	}
+}
+
+// handleEvents streams events as Server-Sent Events.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/events" {
+		http.NotFound(w, r)
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e := <-ch:
+			b, err := json.Marshal(e.Data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
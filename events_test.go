@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StalkR/switchman/mullvadapp"
+)
+
+func TestEvents(t *testing.T) {
+	s := newServer(&fakeSwitchable{current: "a", servers: []string{"a", "b"}})
+	ts := httptest.NewServer(http.HandlerFunc(s.handleEvents))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %v; want text/event-stream", got)
+	}
+	// the handler subscribes after sending the headers
+	for !s.events.active() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.switchServer(origin{Action: "next"}, "b"); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < 6 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	want := []string{
+		"event: switch-started",
+		`data: {"action":"next","from":"a","to":"b"}`,
+		"",
+		"event: switch-finished",
+	}
+	if strings.Join(lines[:4], "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%v\nwant:\n%v", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.HasPrefix(lines[4], "data: {") || !strings.Contains(lines[4], `"to":"b"`) {
+		t.Errorf("switch-finished data = %v", lines[4])
+	}
+}
+
+// fakeNotifier is a Mullvad app like backend notifying state changes.
+type fakeNotifier struct {
+	fakeSwitchable
+	changed chan struct{}
+
+	m     sync.Mutex
+	state string
+}
+
+func (f *fakeNotifier) Status() (*mullvadapp.State, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return &mullvadapp.State{State: f.state}, nil
+}
+
+func (f *fakeNotifier) Changed() <-chan struct{} { return f.changed }
+
+func (f *fakeNotifier) notify(state string) {
+	f.m.Lock()
+	f.state = state
+	f.m.Unlock()
+	f.changed <- struct{}{}
+}
+
+func TestWatchNotified(t *testing.T) {
+	f := &fakeNotifier{changed: make(chan struct{})}
+	s := newServer(f)
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watch(ctx)
+
+	// without waiting for the health poll
+	f.notify("connected")
+	f.notify("connected")
+	f.notify("disconnected")
+	select {
+	case e := <-ch:
+		if h, ok := e.Data.(health); e.Type != "health-changed" || !ok || h.Tunnel != "disconnected" {
+			t.Errorf("event = %+v; want health-changed with tunnel disconnected", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("no event after notified change")
+	}
+}
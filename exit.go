@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/switchman/exitcheck"
+)
+
+// ExitVerifiable allows implementations to verify the exit found by the exit
+// check against the server, from the hostname reported by am.i.mullvad.net.
+type ExitVerifiable interface {
+	// VerifyExit returns whether the exit hostname is expected for the server.
+	// The hostname is empty if the exit is not known to the check endpoint.
+	VerifyExit(server, hostname string) bool
+}
+
+// An exitChecker checks the public exit of the connection.
+type exitChecker struct {
+	urls []string
+
+	m    sync.Mutex // protects below
+	last *exitCheck
+}
+
+func newExitChecker(urls ...string) *exitChecker {
+	var c exitChecker
+	for _, url := range urls {
+		if url != "" {
+			c.urls = append(c.urls, url)
+		}
+	}
+	return &c
+}
+
+// An exitCheck is the result of checking the exit.
+type exitCheck struct {
+	Time    time.Time         `json:"time"`
+	Server  string            `json:"server"`
+	Exits   []*exitcheck.Exit `json:"exits"`
+	Errors  []string          `json:"errors,omitempty"`
+	Verdict string            `json:"verdict"` // match, mismatch or unknown
+	Reason  string            `json:"reason,omitempty"`
+}
+
+// Last returns the last check, or nil if none yet.
+func (c *exitChecker) Last() *exitCheck {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.last
+}
+
+// Check looks up the exit with each endpoint and verifies it against the
+// current server.
+func (c *exitChecker) Check(s Switchable) *exitCheck {
+	r := &exitCheck{Time: time.Now()}
+	current, err := s.Current()
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	r.Server = current
+	for _, url := range c.urls {
+		e, err := exitcheck.Lookup(context.Background(), url)
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+		r.Exits = append(r.Exits, e)
+	}
+	r.Verdict, r.Reason = verifyExits(s, current, r.Exits)
+	if r.Verdict == "mismatch" {
+		log.Printf("exit check: mismatch: %v", r.Reason)
+	}
+	c.m.Lock()
+	c.last = r
+	c.m.Unlock()
+	return r
+}
+
+// verifyExits verifies the exits against the server: by hostname if the
+// backend can, otherwise by IP if the server resolves to one of the exits.
+func verifyExits(s Switchable, server string, exits []*exitcheck.Exit) (verdict, reason string) {
+	if len(exits) == 0 {
+		return "unknown", "could not find exit"
+	}
+	if v, ok := s.(ExitVerifiable); ok {
+		for _, e := range exits {
+			if v.VerifyExit(server, e.Hostname) {
+				continue
+			}
+			if e.Hostname == "" {
+				return "mismatch", fmt.Sprintf("exit %v is not a known exit for %v", e.IP, server)
+			}
+			return "mismatch", fmt.Sprintf("exit %v (%v) is not %v", e.IP, e.Hostname, server)
+		}
+		return "match", ""
+	}
+	addrs, err := net.LookupHost(serverHost(server))
+	if err != nil {
+		return "unknown", fmt.Sprintf("could not resolve server: %v", err)
+	}
+	for _, e := range exits {
+		for _, addr := range addrs {
+			if net.ParseIP(addr).Equal(net.ParseIP(e.IP)) {
+				return "match", ""
+			}
+		}
+	}
+	return "unknown", "exit is not the server address, the provider may exit elsewhere"
+}
+
+// serverHost returns the host of a server: host, host:port or host:port/proto.
+func serverHost(server string) string {
+	server, _, _ = strings.Cut(server, "/")
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		return host
+	}
+	return server
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/StalkR/switchman/exitcheck"
+)
+
+// fakeVerifiable is a Switchable verifying exits by hostname.
+type fakeVerifiable struct {
+	fakeSwitchable
+}
+
+func (f *fakeVerifiable) VerifyExit(server, hostname string) bool {
+	return strings.HasPrefix(server, hostname+".")
+}
+
+func TestVerifyExits(t *testing.T) {
+	verifiable := &fakeVerifiable{}
+	for _, tt := range []struct {
+		s       Switchable
+		server  string
+		exits   []*exitcheck.Exit
+		verdict string
+	}{
+		{verifiable, "se-got-wg-001.relays.mullvad.net:51820", nil, "unknown"},
+		{verifiable, "se-got-wg-001.relays.mullvad.net:51820", []*exitcheck.Exit{{IP: "198.51.100.1", Hostname: "se-got-wg-001"}}, "match"},
+		{verifiable, "se-got-wg-001.relays.mullvad.net:51820", []*exitcheck.Exit{{IP: "198.51.100.1", Hostname: "se-got-wg-001"}, {IP: "2001:db8::1", Hostname: "se-sto-wg-001"}}, "mismatch"},
+		{verifiable, "se-got-wg-001.relays.mullvad.net:51820", []*exitcheck.Exit{{IP: "198.51.100.1"}}, "mismatch"},
+		{&fakeSwitchable{}, "198.51.100.1:1194/udp", []*exitcheck.Exit{{IP: "198.51.100.1"}}, "match"},
+		{&fakeSwitchable{}, "[2001:db8::1]:51820", []*exitcheck.Exit{{IP: "2001:db8:0::1"}}, "match"},
+		{&fakeSwitchable{}, "198.51.100.1:1194/udp", []*exitcheck.Exit{{IP: "198.51.100.2"}}, "unknown"},
+	} {
+		if verdict, reason := verifyExits(tt.s, tt.server, tt.exits); verdict != tt.verdict {
+			t.Errorf("verifyExits(%T, %v, %d exits) = %v (%v); want %v", tt.s, tt.server, len(tt.exits), verdict, reason, tt.verdict)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package exitcheck looks up the public exit of the connection with a
+// "what is my IP" JSON endpoint, such as https://am.i.mullvad.net/json.
+package exitcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Mullvad endpoints to check the exit over IPv4 and IPv6.
+const (
+	MullvadIPv4URL = "https://ipv4.am.i.mullvad.net/json"
+	MullvadIPv6URL = "https://ipv6.am.i.mullvad.net/json"
+)
+
+const timeout = 10 * time.Second
+
+// An Exit is the public exit of the connection.
+// Only IP is required from compatible endpoints, the rest is optional.
+type Exit struct {
+	IP       string `json:"ip"`
+	Country  string `json:"country,omitempty"`
+	City     string `json:"city,omitempty"`
+	Hostname string `json:"mullvad_exit_ip_hostname,omitempty"`
+	// Mullvad tells if the exit is one of theirs; nil if unknown.
+	Mullvad *bool `json:"mullvad_exit_ip,omitempty"`
+}
+
+// Lookup looks up the exit with the endpoint at url.
+func Lookup(ctx context.Context, url string) (*Exit, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", url, resp.Status)
+	}
+	var e Exit
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return nil, fmt.Errorf("%v: %v", url, err)
+	}
+	if e.IP == "" {
+		return nil, fmt.Errorf("%v: no ip in response", url)
+	}
+	return &e, nil
+}
@@ -0,0 +1,47 @@
+package exitcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mullvad":
+			fmt.Fprint(w, `{"ip":"198.51.100.1","country":"Sweden","city":"Gothenburg","longitude":11.97,"latitude":57.71,"mullvad_exit_ip":true,"mullvad_exit_ip_hostname":"se-got-wg-001","mullvad_server_type":"WireGuard","blacklisted":{"blacklisted":false,"results":[]},"organization":"Mullvad"}`)
+		case "/plain":
+			fmt.Fprint(w, `{"ip":"2001:db8::1"}`)
+		case "/noip":
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	e, err := Lookup(context.Background(), ts.URL+"/mullvad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.IP != "198.51.100.1" || e.Country != "Sweden" || e.City != "Gothenburg" || e.Hostname != "se-got-wg-001" || e.Mullvad == nil || !*e.Mullvad {
+		t.Errorf("Lookup(mullvad) = %+v", e)
+	}
+
+	e, err = Lookup(context.Background(), ts.URL+"/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.IP != "2001:db8::1" || e.Mullvad != nil {
+		t.Errorf("Lookup(plain) = %+v", e)
+	}
+
+	for _, path := range []string{"/noip", "/notfound"} {
+		if _, err := Lookup(context.Background(), ts.URL+path); err == nil {
+			t.Errorf("Lookup(%v): got nil error, want error", path)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/StalkR/switchman/openvpn"
+)
+
+const (
+	failoverProbeTimeout = 10 * time.Second
+	failoverHistory      = 10
+)
+
+// Monitorable allows implementations to report whether a server is active
+// according to the provider, e.g. the Mullvad API.
+type Monitorable interface {
+	// Active returns whether the server is up according to the provider.
+	Active(server string) (bool, error)
+}
+
+// A failover watchdog checks the current exit periodically and switches to
+// another healthy server after consecutive failures.
+type failover struct {
+	interval  time.Duration // between checks
+	failures  int           // consecutive failures before switching
+	cooldown  time.Duration // minimum time between switches, to dampen flapping
+	handshake time.Duration // maximum WireGuard handshake age, 0 to skip
+	probe     string        // URL to GET through the tunnel, optional
+	policy    string        // next or random
+
+	m       sync.Mutex // protects below
+	failed  int        // consecutive failures
+	reason  string     // of the last failure
+	last    time.Time  // of the last failover
+	history []failoverEvent
+	avoid   map[string]time.Time // servers failed over from, until then
+}
+
+// A failoverEvent is something the watchdog did, shown on the index.
+type failoverEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+var failoverPolicies = []string{"next", "random"}
+
+func newFailover(interval time.Duration, failures int, cooldown, handshake time.Duration, probe, policy string) (*failover, error) {
+	if !slices.Contains(failoverPolicies, policy) {
+		return nil, fmt.Errorf("unknown failover policy %v, want one of %v", policy, failoverPolicies)
+	}
+	if failures < 1 {
+		return nil, fmt.Errorf("failover failures must be at least 1")
+	}
+	return &failover{
+		interval:  interval,
+		failures:  failures,
+		cooldown:  cooldown,
+		handshake: handshake,
+		probe:     probe,
+		policy:    policy,
+		avoid:     map[string]time.Time{},
+	}, nil
+}
+
+// inherit keeps the failovers and history of a previous watchdog, on reload.
+func (f *failover) inherit(prev *failover) {
+	prev.m.Lock()
+	defer prev.m.Unlock()
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.last = prev.last
+	f.history = slices.Clone(prev.history)
+	f.avoid = maps.Clone(prev.avoid)
+}
+
+// run checks the exit every interval, until ctx is done.
+func (f *failover) run(ctx context.Context, s *server) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.tick(s)
+		}
+	}
+}
+
+// tick checks the exit once and fails over if needed.
+func (f *failover) tick(s *server) {
+	err := f.check(s.Switchable)
+	f.m.Lock()
+	if err == nil {
+		f.failed, f.reason = 0, ""
+		f.m.Unlock()
+		return
+	}
+	f.failed++
+	f.reason = err.Error()
+	failed := f.failed
+	inCooldown := time.Since(f.last) < f.cooldown
+	f.m.Unlock()
+	log.Printf("failover: check failed (%d/%d): %v", failed, f.failures, err)
+	if failed < f.failures {
+		return
+	}
+	if inCooldown {
+		f.record(fmt.Sprintf("unhealthy (%v) but in cooldown after last failover", err))
+		return
+	}
+	current, _ := s.Current()
+	next, perr := f.pick(s.Switchable, current)
+	if perr != nil {
+		f.record(fmt.Sprintf("unhealthy (%v) but no server to fail over to: %v", err, perr))
+		return
+	}
+	f.m.Lock()
+	f.last = time.Now()
+	f.failed = 0
+	f.avoid[current] = time.Now().Add(f.cooldown)
+	f.m.Unlock()
+	if serr := s.switchServer(origin{Action: "failover"}, next); serr != nil {
+		f.record(fmt.Sprintf("failed over from %v to %v (%v) but switch failed: %v", current, next, err, serr))
+		return
+	}
+	f.record(fmt.Sprintf("failed over from %v to %v: %v", current, next, err))
+}
+
+func (f *failover) record(message string) {
+	log.Printf("failover: %v", message)
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.history = append(f.history, failoverEvent{Time: time.Now(), Message: message})
+	if len(f.history) > failoverHistory {
+		f.history = f.history[len(f.history)-failoverHistory:]
+	}
+}
+
+// check checks the health of the current exit: the tunnel is up and
+// handshaking or connected, the provider reports it active, and the probe URL
+// is reachable. A tunnel disconnected on request is not checked.
+func (f *failover) check(s Switchable) error {
+	switch v := s.(type) {
+	case wireGuardStatusable:
+		if f.handshake > 0 {
+			d, err := v.Status()
+			if err != nil {
+				return err
+			}
+			if len(d.Peers) == 0 {
+				return fmt.Errorf("no WireGuard peer")
+			}
+			p := d.Peers[0]
+			if p.LatestHandshake.IsZero() {
+				return fmt.Errorf("no WireGuard handshake")
+			}
+			if age := p.HandshakeAge(); age > f.handshake {
+				return fmt.Errorf("last WireGuard handshake %v ago", age)
+			}
+		}
+	case openVPNStatusable:
+		st, err := v.Status()
+		if errors.Is(err, openvpn.ErrNoManagement) {
+			break // the state is only known with the management interface
+		}
+		if err != nil {
+			return err
+		}
+		if st.State != "CONNECTED" {
+			return fmt.Errorf("OpenVPN %v", st.State)
+		}
+	case mullvadAppStatusable:
+		st, err := v.Status()
+		if err != nil {
+			return err
+		}
+		if st.State == "disconnected" {
+			return nil // on request, e.g. /disconnect: do not reconnect by failing over
+		}
+		if st.State != "connected" {
+			return fmt.Errorf("Mullvad app %v %v", st.State, st.Error)
+		}
+	}
+	if m, ok := s.(Monitorable); ok {
+		current, err := s.Current()
+		if err != nil {
+			return err
+		}
+		active, err := m.Active(current)
+		if err == nil && !active {
+			return fmt.Errorf("%v is not active according to the provider", current)
+		}
+	}
+	if f.probe != "" {
+		if err := probe(f.probe); err != nil {
+			return fmt.Errorf("probe: %v", err)
+		}
+	}
+	return nil
+}
+
+func probe(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), failoverProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return nil
+}
+
+// pick returns the server to fail over to according to the policy, skipping
+// the current server, servers recently failed over from, and servers the
+// provider reports inactive.
+func (f *failover) pick(s Switchable, current string) (string, error) {
+	servers, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	// candidates in order after the current server
+	if i := slices.Index(servers, current); i >= 0 {
+		servers = append(slices.Clone(servers[i+1:]), servers[:i]...)
+	}
+	if f.policy == "random" {
+		rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+	}
+	f.m.Lock()
+	avoid := map[string]bool{}
+	for server, until := range f.avoid {
+		if time.Now().Before(until) {
+			avoid[server] = true
+		} else {
+			delete(f.avoid, server)
+		}
+	}
+	f.m.Unlock()
+	m, monitorable := s.(Monitorable)
+	for _, server := range servers {
+		if server == current || avoid[server] {
+			continue
+		}
+		if monitorable {
+			if active, err := m.Active(server); err == nil && !active {
+				continue
+			}
+		}
+		return server, nil
+	}
+	return "", fmt.Errorf("no healthy server")
+}
+
+// A failoverReport is the state of the watchdog, for the index and API.
+type failoverReport struct {
+	Failures int             `json:"failures"` // consecutive
+	Reason   string          `json:"reason,omitempty"`
+	History  []failoverEvent `json:"history,omitempty"` // newest first
+}
+
+func (f *failover) report() *failoverReport {
+	f.m.Lock()
+	defer f.m.Unlock()
+	r := &failoverReport{Failures: f.failed, Reason: f.reason}
+	for i := len(f.history) - 1; i >= 0; i-- {
+		r.History = append(r.History, f.history[i])
+	}
+	return r
+}
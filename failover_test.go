@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StalkR/switchman/mullvadapp"
+	"github.com/StalkR/switchman/openvpn"
+)
+
+// fakeMonitorable is a Switchable whose servers can be inactive.
+type fakeMonitorable struct {
+	fakeSwitchable
+	inactive map[string]bool
+}
+
+func (f *fakeMonitorable) Active(server string) (bool, error) { return !f.inactive[server], nil }
+
+func TestFailover(t *testing.T) {
+	f := &fakeMonitorable{
+		fakeSwitchable: fakeSwitchable{current: "a", servers: []string{"a", "b", "c", "d"}},
+		inactive:       map[string]bool{},
+	}
+	s := newServer(f)
+	fo, err := newFailover(time.Second, 2, time.Hour, 0, "", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fo.tick(s)
+	if r := fo.report(); r.Failures != 0 || len(r.History) != 0 {
+		t.Fatalf("healthy: report = %+v", r)
+	}
+
+	f.inactive["a"] = true
+	f.inactive["b"] = true
+	fo.tick(s)
+	if f.current != "a" {
+		t.Fatalf("failed over after 1 failure, to %v", f.current)
+	}
+	if r := fo.report(); r.Failures != 1 || !strings.Contains(r.Reason, "not active") {
+		t.Errorf("report = %+v", r)
+	}
+	fo.tick(s)
+	if f.current != "c" {
+		t.Fatalf("current = %v; want c, the next active server", f.current)
+	}
+	if r := fo.report(); r.Failures != 0 || len(r.History) != 1 || !strings.Contains(r.History[0].Message, "from a to c") {
+		t.Errorf("report = %+v", r)
+	}
+
+	// flapping: no failover during the cooldown
+	f.inactive["c"] = true
+	fo.tick(s)
+	fo.tick(s)
+	if f.current != "c" {
+		t.Errorf("failed over to %v during cooldown", f.current)
+	}
+	if r := fo.report(); len(r.History) != 2 || !strings.Contains(r.History[0].Message, "cooldown") {
+		t.Errorf("report = %+v", r)
+	}
+
+	// after the cooldown, a server failed over from is still avoided
+	fo.last = time.Time{}
+	f.inactive["a"] = false
+	fo.tick(s)
+	if f.current != "d" {
+		t.Errorf("current = %v; want d", f.current)
+	}
+}
+
+// fakeOpenVPN is a Switchable without the OpenVPN management interface.
+type fakeOpenVPN struct{ fakeSwitchable }
+
+func (f *fakeOpenVPN) Status() (*openvpn.Status, error) { return nil, openvpn.ErrNoManagement }
+
+// fakeMullvadApp is a Switchable whose Mullvad app tunnel is in a state.
+type fakeMullvadApp struct {
+	fakeSwitchable
+	state string
+}
+
+func (f *fakeMullvadApp) Status() (*mullvadapp.State, error) {
+	return &mullvadapp.State{State: f.state}, nil
+}
+
+func TestFailoverCheckState(t *testing.T) {
+	fo, err := newFailover(time.Second, 2, time.Hour, 0, "", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fo.check(&fakeOpenVPN{}); err != nil {
+		t.Errorf("check(OpenVPN without management) = %v; want nil", err)
+	}
+	for _, tt := range []struct {
+		state   string
+		healthy bool
+	}{
+		{"connected", true},
+		{"disconnected", true},
+		{"connecting", false},
+		{"error", false},
+	} {
+		if err := fo.check(&fakeMullvadApp{state: tt.state}); (err == nil) != tt.healthy {
+			t.Errorf("check(Mullvad app %v) = %v; want healthy %v", tt.state, err, tt.healthy)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A favorite is a server saved with a friendly name, and switched to by its
+// alias: @ followed by the name in lower case with dashes, e.g. @streaming-uk.
+type favorite struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// Alias returns the alias of the favorite.
+func (f favorite) Alias() string {
+	return aliasOf(f.Name)
+}
+
+// aliasOf returns the alias of a name: Streaming UK is @streaming-uk.
+func aliasOf(name string) string {
+	var b strings.Builder
+	b.WriteString("@")
+	dash := false
+	for _, c := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash {
+				b.WriteRune('-')
+				dash = false
+			}
+			b.WriteRune(c)
+		case b.Len() > 1:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// favorites returns the favorites, in the order they were added.
+func (s *server) favorites() []favorite {
+	var favorites []favorite
+	if s.state == nil {
+		return nil
+	}
+	s.state.get(func(st *state) {
+		favorites = slices.Clone(st.Favorites)
+	})
+	return favorites
+}
+
+// groups returns the groups by name, with their servers or aliases.
+func (s *server) groups() map[string][]string {
+	groups := map[string][]string{}
+	if s.state == nil {
+		return groups
+	}
+	s.state.get(func(st *state) {
+		for name, servers := range st.Groups {
+			groups[name] = slices.Clone(servers)
+		}
+	})
+	return groups
+}
+
+// resolve returns the server of an alias, or the server itself if not an alias.
+func (s *server) resolve(server string) (string, error) {
+	if !strings.HasPrefix(server, "@") {
+		return server, nil
+	}
+	for _, f := range s.favorites() {
+		if f.Alias() == server {
+			return f.Server, nil
+		}
+	}
+	return "", fmt.Errorf("unknown favorite %v", server)
+}
+
+// group returns the servers of a group, with aliases resolved.
+func (s *server) group(name string) ([]string, error) {
+	members, ok := s.groups()[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown group %v", name)
+	}
+	var servers []string
+	for _, e := range members {
+		server, err := s.resolve(e)
+		if err != nil {
+			return nil, fmt.Errorf("group %v: %v", name, err)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// addFavorite saves a server with a friendly name, replacing any favorite
+// with the same alias.
+func (s *server) addFavorite(name, server string) error {
+	f := favorite{Name: strings.TrimSpace(name), Server: server}
+	if f.Alias() == "@" || server == "" {
+		return fmt.Errorf("favorite needs a name and a server")
+	}
+	if strings.HasPrefix(server, "@") {
+		return fmt.Errorf("favorite of a favorite %v", server)
+	}
+	return s.state.update(func(st *state) {
+		st.Favorites = slices.DeleteFunc(st.Favorites, func(e favorite) bool { return e.Alias() == f.Alias() })
+		st.Favorites = append(st.Favorites, f)
+	})
+}
+
+func (s *server) removeFavorite(alias string) error {
+	if _, err := s.resolve(alias); err != nil {
+		return err
+	}
+	return s.state.update(func(st *state) {
+		st.Favorites = slices.DeleteFunc(st.Favorites, func(e favorite) bool { return e.Alias() == alias })
+	})
+}
+
+// addToGroup adds a server or alias to a group, creating it if needed.
+func (s *server) addToGroup(group, server string) error {
+	if group == "" || server == "" {
+		return fmt.Errorf("group needs a name and a server")
+	}
+	return s.state.update(func(st *state) {
+		if st.Groups == nil {
+			st.Groups = map[string][]string{}
+		}
+		if !slices.Contains(st.Groups[group], server) {
+			st.Groups[group] = append(st.Groups[group], server)
+		}
+	})
+}
+
+// removeFromGroup removes a server or alias from a group, deleting it if empty.
+func (s *server) removeFromGroup(group, server string) error {
+	if _, ok := s.groups()[group]; !ok {
+		return fmt.Errorf("unknown group %v", group)
+	}
+	return s.state.update(func(st *state) {
+		st.Groups[group] = slices.DeleteFunc(st.Groups[group], func(e string) bool { return e == server })
+		if len(st.Groups[group]) == 0 {
+			delete(st.Groups, group)
+		}
+	})
+}
+
+// A groupView is a group as shown on pages.
+type groupView struct {
+	Name    string
+	Members []string
+}
+
+func (s *server) groupViews() []groupView {
+	var groups []groupView
+	for name, members := range s.groups() {
+		groups = append(groups, groupView{Name: name, Members: members})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+var pinnedTmpl = template.Must(template.New("").Parse(`<p>
+Favorites:
+{{range .Favorites}}<a href="switch?server={{.Alias}}" title="{{.Server}}">{{.Name}}</a>{{if eq .Server $.Current}} (current){{end}} {{else}}none {{end}}
+{{if .Groups}}<br>Groups: {{range .Groups}}<a href="next?group={{.Name}}" title="switch to the next server of the group">{{.Name}}</a> {{end}}{{end}}
+<a href="favorites">edit</a>
+</p>
+`))
+
+// pinned writes the favorites and groups pinned at the top of the index.
+func pinned(w io.Writer, s *server) error {
+	current, _ := s.Current()
+	return pinnedTmpl.Execute(w, struct {
+		Current   string
+		Favorites []favorite
+		Groups    []groupView
+	}{
+		Current:   current,
+		Favorites: s.favorites(),
+		Groups:    s.groupViews(),
+	})
+}
+
+var favoritesTmpl = template.Must(template.New("").Parse(`<p>Favorites:</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Name</th>
+      <th align="left">Alias</th>
+      <th align="left">Server</th>
+      <th align="left">Actions</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Favorites}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Alias}}</td>
+      <td>{{.Server}}</td>
+      <td><a href="switch?server={{.Alias}}">switch</a> <a href="favorites?action=remove&amp;favorite={{.Alias}}">remove</a></td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+<form action="favorites">
+  <input type="hidden" name="action" value="add">
+  <input name="name" placeholder="name, e.g. Streaming UK">
+  <input name="server" placeholder="server" list="servers">
+  <input type="submit" value="add favorite">
+</form>
+<p>Groups:</p>
+<ul>
+  {{range .Groups}}
+  <li>
+    {{.Name}} (<a href="next?group={{.Name}}">next</a>):
+    {{$group := .Name}}
+    {{range .Members}}{{.}} <a href="favorites?action=ungroup&amp;group={{$group}}&amp;server={{.}}">remove</a>, {{end}}
+  </li>
+  {{end}}
+</ul>
+<form action="favorites">
+  <input type="hidden" name="action" value="group">
+  <input name="group" placeholder="group, e.g. nordics">
+  <input name="server" placeholder="server or @favorite" list="servers">
+  <input type="submit" value="add to group">
+</form>
+<datalist id="servers">
+  {{range .Favorites}}<option value="{{.Alias}}">{{end}}
+  {{range .Servers}}<option value="{{.}}">{{end}}
+</datalist>`))
+
+// handleFavorites shows and edits favorites and groups, with action add (name,
+// server), remove (favorite), group (group, server) or ungroup (group, server).
+// note: no xsrf protection
+func (s *server) handleFavorites(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/favorites" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.state == nil {
+		http.Error(w, "state file not enabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	if action := q.Get("action"); action != "" {
+		var err error
+		var from, to string
+		start := time.Now()
+		switch action {
+		case "add":
+			to = fmt.Sprintf("%v = %v", aliasOf(q.Get("name")), q.Get("server"))
+			err = s.addFavorite(q.Get("name"), q.Get("server"))
+		case "remove":
+			from = q.Get("favorite")
+			err = s.removeFavorite(q.Get("favorite"))
+		case "group":
+			to = fmt.Sprintf("%v in %v", q.Get("server"), q.Get("group"))
+			err = s.addToGroup(q.Get("group"), q.Get("server"))
+		case "ungroup":
+			from = fmt.Sprintf("%v in %v", q.Get("server"), q.Get("group"))
+			err = s.removeFromGroup(q.Get("group"), q.Get("server"))
+		default:
+			http.Error(w, fmt.Sprintf("unknown action %v", action), http.StatusBadRequest)
+			return
+		}
+		if s.audit != nil {
+			s.audit.record(newChange(s.requestOrigin(r, "favorites"), "favorites", from, to, time.Since(start), err))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		done(w, r)
+		return
+	}
+
+	servers, err := s.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(servers)
+	var content bytes.Buffer
+	if err := favoritesTmpl.Execute(&content, struct {
+		Favorites []favorite
+		Groups    []groupView
+		Servers   []string
+	}{
+		Favorites: s.favorites(),
+		Groups:    s.groupViews(),
+		Servers:   servers,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	if err := page(w, s, content.String()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
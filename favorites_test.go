@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAliasOf(t *testing.T) {
+	for _, tt := range []struct {
+		name, want string
+	}{
+		{"Streaming UK", "@streaming-uk"},
+		{"  Office-ish ", "@office-ish"},
+		{"Nordics (fast!)", "@nordics-fast"},
+		{"Zürich 2", "@zürich-2"},
+		{"!!!", "@"},
+	} {
+		if got := aliasOf(tt.name); got != tt.want {
+			t.Errorf("aliasOf(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSwitchable{current: "a", servers: []string{"a", "b", "c", "d"}}
+	s := newServer(f)
+	s.state = st
+	if err := s.addFavorite("Streaming UK", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.addFavorite("Streaming UK", "b"); err != nil { // replaces
+		t.Fatal(err)
+	}
+	for _, e := range []string{"d", "@streaming-uk"} {
+		if err := s.addToGroup("nordics", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// persisted
+	st, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newServer(f)
+	s.state = st
+	if got := s.favorites(); len(got) != 1 || got[0] != (favorite{Name: "Streaming UK", Server: "b"}) {
+		t.Errorf("favorites = %+v", got)
+	}
+
+	for _, tt := range []struct {
+		url, want string
+	}{
+		{"/switch?server=@streaming-uk", "b"},
+		{"/next?group=nordics", "d"},
+		{"/next?group=nordics", "b"},
+		{"/next", "c"},
+		{"/next?group=nordics", "d"}, // c not in group: first
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if r.URL.Path == "/switch" {
+			s.handleSwitch(w, r)
+		} else {
+			s.handleNext(w, r)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("%v: %v %v", tt.url, w.Code, w.Body)
+		}
+		if f.current != tt.want {
+			t.Errorf("%v: current = %v; want %v", tt.url, f.current, tt.want)
+		}
+	}
+
+	if err := s.removeFavorite("@streaming-uk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.group("nordics"); err == nil {
+		t.Error("group with removed favorite: no error")
+	}
+	if err := s.removeFromGroup("nordics", "@streaming-uk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.removeFromGroup("nordics", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.groups(); len(got) != 0 {
+		t.Errorf("groups = %v; want none", got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	hookTimeout     = 30 * time.Second
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 5
+	webhookBackoff  = 2 * time.Second // doubled after each attempt
+)
+
+// A webhook is an outgoing HTTP POST notified of switches.
+type webhook struct {
+	format string // json, slack or matrix
+	url    string
+}
+
+// parseWebhook parses a webhook as [format=]url, json by default.
+func parseWebhook(s string) (webhook, error) {
+	format, url, ok := strings.Cut(s, "=")
+	if !ok || strings.Contains(format, ":") {
+		format, url = "json", s
+	}
+	switch format {
+	case "json", "slack", "matrix":
+	default:
+		return webhook{}, fmt.Errorf("webhook %v: unknown format %v", s, format)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return webhook{}, fmt.Errorf("webhook %v: not an http(s) url", s)
+	}
+	return webhook{format: format, url: url}, nil
+}
+
+// payload returns the body of the webhook for a change: the change itself for
+// json, or a message for Slack incoming webhooks and Matrix hookshot.
+func (w webhook) payload(c *change) ([]byte, error) {
+	switch w.format {
+	case "slack":
+		return json.Marshal(map[string]string{"text": message(c)})
+	case "matrix":
+		return json.Marshal(map[string]string{"text": message(c), "username": "switchman"})
+	}
+	return json.Marshal(c)
+}
+
+// message describes a change for humans.
+func message(c *change) string {
+	var b strings.Builder
+	if c.Error != "" {
+		fmt.Fprintf(&b, "switchman: %v switch from %v to %v failed: %v", c.Backend, c.From, c.To, c.Error)
+	} else {
+		fmt.Fprintf(&b, "switchman: %v switched from %v to %v", c.Backend, c.From, c.To)
+	}
+	var by []string
+	if c.User != "" {
+		by = append(by, c.User)
+	}
+	if c.Remote != "" {
+		by = append(by, c.Remote)
+	}
+	fmt.Fprintf(&b, " (%v", c.Action)
+	if len(by) > 0 {
+		fmt.Fprintf(&b, " by %v", strings.Join(by, " from "))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// hooks run scripts before and after switches and notify webhooks.
+type hooks struct {
+	pre      string // script which can veto a switch, optional
+	post     string // script, optional
+	webhooks []webhook
+
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+func newHooks(pre, post string, webhooks []webhook) *hooks {
+	return &hooks{
+		pre:      pre,
+		post:     post,
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+		attempts: webhookAttempts,
+		backoff:  webhookBackoff,
+	}
+}
+
+// before runs the pre-switch script, whose failure vetoes the switch.
+func (h *hooks) before(c *change) error {
+	if h.pre == "" {
+		return nil
+	}
+	if err := runHook(h.pre, c); err != nil {
+		return fmt.Errorf("vetoed by pre-switch hook: %v", err)
+	}
+	return nil
+}
+
+// after runs the post-switch script and notifies webhooks, in the background.
+func (h *hooks) after(c *change) {
+	if h.post != "" {
+		go func() {
+			if err := runHook(h.post, c); err != nil {
+				log.Printf("post-switch hook: %v", err)
+			}
+		}()
+	}
+	for _, w := range h.webhooks {
+		go func() {
+			if err := h.deliver(w, c); err != nil {
+				log.Printf("webhook %v: %v", w.url, err)
+			}
+		}()
+	}
+}
+
+// runHook runs a script with the change in environment variables.
+func runHook(path string, c *change) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(),
+		"SWITCHMAN_ACTION="+c.Action,
+		"SWITCHMAN_BACKEND="+c.Backend,
+		"SWITCHMAN_OLD_SERVER="+c.From,
+		"SWITCHMAN_NEW_SERVER="+c.To,
+		"SWITCHMAN_REMOTE="+c.Remote,
+		"SWITCHMAN_USER="+c.User,
+		"SWITCHMAN_ERROR="+c.Error,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%v: %v", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// deliver posts the change to a webhook, retrying with exponential backoff
+// on network errors, rate limiting and server errors.
+func (h *hooks) deliver(w webhook, c *change) error {
+	body, err := w.payload(c)
+	if err != nil {
+		return err
+	}
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := h.send(w.url, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= h.attempts {
+			return fmt.Errorf("attempt %d: %v", attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts once, returning whether a failure is worth retrying.
+func (h *hooks) send(url string, body []byte) (bool, error) {
+	resp, err := h.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return true, fmt.Errorf("%v", resp.Status)
+	}
+	return false, fmt.Errorf("%v", resp.Status)
+}
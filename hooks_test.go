@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseWebhook(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want webhook
+		err  bool
+	}{
+		{s: "https://example.com/hook?a=b", want: webhook{format: "json", url: "https://example.com/hook?a=b"}},
+		{s: "slack=https://hooks.slack.com/services/x", want: webhook{format: "slack", url: "https://hooks.slack.com/services/x"}},
+		{s: "matrix=http://localhost:9000/webhook/x", want: webhook{format: "matrix", url: "http://localhost:9000/webhook/x"}},
+		{s: "irc=https://example.com", err: true},
+		{s: "slack=example.com", err: true},
+	} {
+		got, err := parseWebhook(tt.s)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseWebhook(%q) = %+v, %v; want %+v, error %v", tt.s, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var calls atomic.Int32
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	h := newHooks("", "", nil)
+	h.backoff = time.Millisecond
+	c := newChange(origin{Action: "next", Remote: "192.0.2.1", User: "alice"}, "mullvad", "se1", "se2", time.Second, nil)
+	if err := h.deliver(webhook{format: "slack", url: ts.URL}, c); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("deliver: %d calls; want 3", calls.Load())
+	}
+	want := "switchman: mullvad switched from se1 to se2 (next by alice from 192.0.2.1)"
+	if got["text"] != want {
+		t.Errorf("deliver: text = %q; want %q", got["text"], want)
+	}
+
+	// not retried
+	calls.Store(0)
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	if err := h.deliver(webhook{format: "json", url: ts.URL}, c); err == nil {
+		t.Error("deliver: no error on 404")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("deliver: %d calls on 404; want 1", calls.Load())
+	}
+}
+
+func TestPreSwitchHookVeto(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "pre")
+	if err := os.WriteFile(script, []byte(`#!/bin/sh
+[ "$SWITCHMAN_OLD_SERVER" = a ] || exit 2
+[ "$SWITCHMAN_NEW_SERVER" = c ] && { echo "not c"; exit 1; }
+exit 0
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	post := filepath.Join(dir, "post")
+	posted := filepath.Join(dir, "posted")
+	if err := os.WriteFile(post, []byte(`#!/bin/sh
+echo "$SWITCHMAN_NEW_SERVER" >> `+posted+`
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSwitchable{current: "a", servers: []string{"a", "b", "c"}}
+	s := newServer(f)
+	s.hooks = newHooks(script, post, nil)
+	s.audit = newAuditLog(filepath.Join(dir, "audit.log"))
+	err := s.switchServer(origin{Action: "switch"}, "c")
+	if err == nil || !strings.Contains(err.Error(), "not c") {
+		t.Errorf("switch to c: %v; want veto", err)
+	}
+	if f.current != "a" {
+		t.Errorf("switched to %v despite veto", f.current)
+	}
+	if err := s.switchServer(origin{Action: "switch"}, "b"); err != nil {
+		t.Errorf("switch to b: %v", err)
+	}
+	if f.current != "b" {
+		t.Errorf("current = %v; want b", f.current)
+	}
+
+	// the post-switch hook runs in the background, only for the switch to b
+	var b []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if b, err = os.ReadFile(posted); err == nil && len(b) > 0 {
+			break
+		}
+	}
+	if string(b) != "b\n" {
+		t.Errorf("post-switch hook ran for %q; want only b", b)
+	}
+	changes, err := s.audit.read(auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Vetoed || !changes[1].Vetoed { // newest first
+		t.Errorf("audit log %+v; want switch to c vetoed, then to b", changes)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/StalkR/switchman/killswitch"
+	"github.com/StalkR/switchman/leakcheck"
+	"github.com/StalkR/switchman/routing"
+)
+
+// Endpointed allows implementations to report the endpoints of a server, for
+// the kill switch to allow traffic to them outside the tunnel.
+type Endpointed interface {
+	// Endpoints returns the endpoints of a server, as host:port or host:port/proto.
+	Endpoints(server string) ([]string, error)
+}
+
+// A killSwitch keeps nftables rules only allowing traffic through the tunnel
+// and to the endpoints of the current server, and while switching, to the
+// endpoints of both servers and to the system resolvers so the new endpoint
+// can be resolved.
+type killSwitch struct {
+	allow []netip.Prefix
+
+	m       sync.Mutex // protects below
+	current []killswitch.Endpoint
+	next    []killswitch.Endpoint
+}
+
+func newKillSwitch(s Switchable, allow []netip.Prefix) (*killSwitch, error) {
+	if _, ok := s.(Tunneled); !ok {
+		return nil, fmt.Errorf("kill switch: backend does not report its device")
+	}
+	if _, ok := s.(Endpointed); !ok {
+		return nil, fmt.Errorf("kill switch: backend does not report its endpoints")
+	}
+	k := &killSwitch{allow: allow}
+	current, err := s.Current()
+	if err != nil {
+		return nil, err
+	}
+	if k.current, err = endpoints(s, current); err != nil {
+		return nil, err
+	}
+	if err := k.apply(s, false, k.current); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// checkTunnels rejects routing clients through tunnels of other devices than
+// the one of the backend: the kill switch only allows traffic through it, so
+// their clients would be dropped and their endpoints blocked.
+func checkTunnels(s Switchable, tunnels []routing.Tunnel) error {
+	t, ok := s.(Tunneled)
+	if !ok {
+		return fmt.Errorf("kill switch: backend does not report its device")
+	}
+	device, err := t.Device()
+	if err != nil {
+		return fmt.Errorf("kill switch: %v", err)
+	}
+	for _, tunnel := range tunnels {
+		if tunnel.Device != device {
+			return fmt.Errorf("kill switch: tunnel %v through %v not supported, only through %v", tunnel.Name, tunnel.Device, device)
+		}
+	}
+	return nil
+}
+
+// reconfigure changes the networks allowed outside the tunnel, keeping the
+// endpoints allowed, including of a switch in progress.
+func (k *killSwitch) reconfigure(s Switchable, allow []netip.Prefix) error {
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.allow = allow
+	if k.next != nil {
+		return k.apply(s, true, append(append([]killswitch.Endpoint(nil), k.current...), k.next...))
+	}
+	return k.apply(s, false, k.current)
+}
+
+// begin allows the endpoints of the server being switched to.
+func (k *killSwitch) begin(s Switchable, server string) error {
+	k.m.Lock()
+	defer k.m.Unlock()
+	// allow DNS first to resolve the new endpoints
+	if err := k.apply(s, true, k.current); err != nil {
+		return err
+	}
+	next, err := endpoints(s, server)
+	if err != nil {
+		return err
+	}
+	k.next = next
+	return k.apply(s, true, append(append([]killswitch.Endpoint(nil), k.current...), next...))
+}
+
+// end only allows the endpoints of the new server if the switch succeeded,
+// otherwise of the previous one.
+func (k *killSwitch) end(s Switchable, ok bool) error {
+	k.m.Lock()
+	defer k.m.Unlock()
+	if ok {
+		k.current = k.next
+	}
+	k.next = nil
+	return k.apply(s, false, k.current)
+}
+
+func (k *killSwitch) apply(s Switchable, dns bool, endpoints []killswitch.Endpoint) error {
+	device, err := s.(Tunneled).Device()
+	if err != nil {
+		return fmt.Errorf("kill switch: %v", err)
+	}
+	c := killswitch.Config{
+		Device:    device,
+		Endpoints: endpoints,
+		Allow:     k.allow,
+	}
+	if dns {
+		if c.DNS, err = resolvers(); err != nil {
+			return err
+		}
+	}
+	return killswitch.Apply(c)
+}
+
+// resolvers returns the system resolvers, the only DNS allowed in the clear.
+func resolvers() ([]netip.Addr, error) {
+	nameservers, err := leakcheck.Resolvers()
+	if err != nil {
+		return nil, fmt.Errorf("kill switch: %v", err)
+	}
+	var addrs []netip.Addr
+	for _, ns := range nameservers {
+		addr, err := netip.ParseAddr(ns)
+		if err != nil {
+			return nil, fmt.Errorf("kill switch: nameserver %v: %v", ns, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// endpoints resolves the endpoints of a server.
+func endpoints(s Switchable, server string) ([]killswitch.Endpoint, error) {
+	if server == "" {
+		return nil, nil
+	}
+	list, err := s.(Endpointed).Endpoints(server)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []killswitch.Endpoint
+	for _, e := range list {
+		resolved, err := killswitch.ParseEndpoint(e)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, resolved...)
+	}
+	return endpoints, nil
+}
+
+// parsePrefixes parses a comma-separated list of prefixes.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+func formatPrefixes(prefixes []netip.Prefix) string {
+	var s []string
+	for _, p := range prefixes {
+		s = append(s, p.String())
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,187 @@
+// Package killswitch generates and applies nftables rules that only allow
+// traffic through the VPN device and to the VPN endpoints, so that nothing
+// goes out in the clear, including while the tunnel is down.
+package killswitch
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table is the nftables table holding the rules.
+const Table = "inet switchman"
+
+// DefaultAllow are the destinations allowed outside the tunnel by default:
+// private and link-local networks, so that the LAN stays reachable.
+var DefaultAllow = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// An Endpoint is a VPN server address allowed outside the tunnel.
+type Endpoint struct {
+	Addr  netip.Addr
+	Port  int
+	Proto string // udp or tcp
+}
+
+// Config is the configuration of the kill switch.
+type Config struct {
+	Device    string         // VPN device, e.g. wg0
+	Endpoints []Endpoint     // VPN endpoints
+	Allow     []netip.Prefix // destinations allowed outside the tunnel
+	// DNS are the resolvers allowed outside the tunnel, to resolve endpoints
+	// while switching.
+	DNS []netip.Addr
+}
+
+// ParseEndpoint resolves an endpoint: host:port or host:port/proto, with the
+// proto defaulting to udp.
+func ParseEndpoint(s string) ([]Endpoint, error) {
+	hostport, proto, _ := strings.Cut(s, "/")
+	switch {
+	case proto == "":
+		proto = "udp"
+	case strings.HasPrefix(proto, "udp"):
+		proto = "udp"
+	case strings.HasPrefix(proto, "tcp"):
+		proto = "tcp"
+	default:
+		return nil, fmt.Errorf("endpoint %v: invalid proto", s)
+	}
+	host, sport, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %v: %v", s, err)
+	}
+	port, err := strconv.Atoi(sport)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %v: invalid port", s)
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %v: %v", s, err)
+	}
+	var endpoints []Endpoint
+	for _, a := range addrs {
+		addr, err := netip.ParseAddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %v: %v", s, err)
+		}
+		endpoints = append(endpoints, Endpoint{Addr: addr.Unmap(), Port: port, Proto: proto})
+	}
+	return endpoints, nil
+}
+
+// Ruleset returns the nftables ruleset for the config. It replaces the table
+// atomically when applied: the table is created if missing, then deleted and
+// recreated in the same transaction.
+func Ruleset(c Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s\n", Table)
+	fmt.Fprintf(&b, "delete table %s\n", Table)
+	fmt.Fprintf(&b, "table %s {\n", Table)
+
+	var allow4, allow6 []string
+	for _, p := range c.Allow {
+		if p.Addr().Is4() {
+			allow4 = append(allow4, p.String())
+		} else {
+			allow6 = append(allow6, p.String())
+		}
+	}
+	var dns4, dns6 []string
+	for _, a := range c.DNS {
+		if a = a.Unmap(); a.Is4() {
+			dns4 = append(dns4, a.String())
+		} else {
+			dns6 = append(dns6, a.String())
+		}
+	}
+
+	endpoints := append([]Endpoint(nil), c.Endpoints...)
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Addr != endpoints[j].Addr {
+			return endpoints[i].Addr.Less(endpoints[j].Addr)
+		}
+		if endpoints[i].Proto != endpoints[j].Proto {
+			return endpoints[i].Proto < endpoints[j].Proto
+		}
+		return endpoints[i].Port < endpoints[j].Port
+	})
+
+	b.WriteString("\tchain output {\n")
+	b.WriteString("\t\ttype filter hook output priority 0; policy drop;\n")
+	b.WriteString("\t\toifname \"lo\" accept\n")
+	fmt.Fprintf(&b, "\t\toifname %q accept\n", c.Device)
+	for _, e := range endpoints {
+		family := "ip"
+		if e.Addr.Is6() {
+			family = "ip6"
+		}
+		fmt.Fprintf(&b, "\t\t%s daddr %s %s dport %d accept\n", family, e.Addr, e.Proto, e.Port)
+	}
+	// keep the link working: DHCP leases, IPv6 neighbor and router discovery
+	b.WriteString("\t\tudp sport 68 udp dport 67 accept\n")
+	b.WriteString("\t\tudp sport 546 udp dport 547 accept\n")
+	b.WriteString("\t\ticmpv6 type { nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert, nd-redirect } accept\n")
+	b.WriteString("\t\tip6 daddr ff02::/16 accept\n")
+	writeAllow(&b, "", allow4, allow6)
+	for _, proto := range []string{"udp", "tcp"} {
+		writeSet(&b, "", "ip", dns4, proto+" dport 53 ")
+		writeSet(&b, "", "ip6", dns6, proto+" dport 53 ")
+	}
+	b.WriteString("\t}\n")
+
+	b.WriteString("\tchain forward {\n")
+	b.WriteString("\t\ttype filter hook forward priority 0; policy drop;\n")
+	fmt.Fprintf(&b, "\t\toifname %q accept\n", c.Device)
+	fmt.Fprintf(&b, "\t\tiifname %q ct state established,related accept\n", c.Device)
+	// only from the LAN, or new connections from the tunnel would reach it
+	writeAllow(&b, fmt.Sprintf("iifname != %q ", c.Device), allow4, allow6)
+	b.WriteString("\t}\n")
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeAllow writes the rules accepting the allowed destinations, after a
+// match prefix.
+func writeAllow(b *strings.Builder, match string, allow4, allow6 []string) {
+	writeSet(b, match, "ip", allow4, "")
+	writeSet(b, match, "ip6", allow6, "")
+}
+
+// writeSet writes a rule accepting a set of destinations of a family, if any.
+func writeSet(b *strings.Builder, match, family string, set []string, suffix string) {
+	if len(set) > 0 {
+		fmt.Fprintf(b, "\t\t%s%s daddr { %s } %saccept\n", match, family, strings.Join(set, ", "), suffix)
+	}
+}
+
+// Apply applies the ruleset for the config atomically.
+func Apply(c Config) error {
+	return nft(Ruleset(c))
+}
+
+// Remove removes the rules.
+func Remove() error {
+	return nft(fmt.Sprintf("table %s\ndelete table %s\n", Table, Table))
+}
+
+func nft(ruleset string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(ruleset)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v - %v", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
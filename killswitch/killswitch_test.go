@@ -0,0 +1,128 @@
+package killswitch
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleset(t *testing.T) {
+	got := Ruleset(Config{
+		Device: "wg0",
+		Endpoints: []Endpoint{
+			{Addr: netip.MustParseAddr("2001:db8::1"), Port: 51820, Proto: "udp"},
+			{Addr: netip.MustParseAddr("198.51.100.1"), Port: 51820, Proto: "udp"},
+		},
+		Allow: []netip.Prefix{
+			netip.MustParsePrefix("192.168.0.0/16"),
+			netip.MustParsePrefix("fe80::/10"),
+		},
+	})
+	want := `table inet switchman
+delete table inet switchman
+table inet switchman {
+	chain output {
+		type filter hook output priority 0; policy drop;
+		oifname "lo" accept
+		oifname "wg0" accept
+		ip daddr 198.51.100.1 udp dport 51820 accept
+		ip6 daddr 2001:db8::1 udp dport 51820 accept
+		udp sport 68 udp dport 67 accept
+		udp sport 546 udp dport 547 accept
+		icmpv6 type { nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert, nd-redirect } accept
+		ip6 daddr ff02::/16 accept
+		ip daddr { 192.168.0.0/16 } accept
+		ip6 daddr { fe80::/10 } accept
+	}
+	chain forward {
+		type filter hook forward priority 0; policy drop;
+		oifname "wg0" accept
+		iifname "wg0" ct state established,related accept
+		iifname != "wg0" ip daddr { 192.168.0.0/16 } accept
+		iifname != "wg0" ip6 daddr { fe80::/10 } accept
+	}
+}
+`
+	if got != want {
+		t.Errorf("Ruleset() = %v; want %v", got, want)
+	}
+}
+
+func TestRulesetDNS(t *testing.T) {
+	got := Ruleset(Config{
+		Device:    "tun0",
+		Endpoints: []Endpoint{{Addr: netip.MustParseAddr("198.51.100.1"), Port: 443, Proto: "tcp"}},
+		DNS:       []netip.Addr{netip.MustParseAddr("192.0.2.53"), netip.MustParseAddr("2001:db8::53")},
+	})
+	want := `table inet switchman
+delete table inet switchman
+table inet switchman {
+	chain output {
+		type filter hook output priority 0; policy drop;
+		oifname "lo" accept
+		oifname "tun0" accept
+		ip daddr 198.51.100.1 tcp dport 443 accept
+		udp sport 68 udp dport 67 accept
+		udp sport 546 udp dport 547 accept
+		icmpv6 type { nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert, nd-redirect } accept
+		ip6 daddr ff02::/16 accept
+		ip daddr { 192.0.2.53 } udp dport 53 accept
+		ip6 daddr { 2001:db8::53 } udp dport 53 accept
+		ip daddr { 192.0.2.53 } tcp dport 53 accept
+		ip6 daddr { 2001:db8::53 } tcp dport 53 accept
+	}
+	chain forward {
+		type filter hook forward priority 0; policy drop;
+		oifname "tun0" accept
+		iifname "tun0" ct state established,related accept
+	}
+}
+`
+	if got != want {
+		t.Errorf("Ruleset() = %v; want %v", got, want)
+	}
+}
+
+// TestRulesetForwardFromTunnel checks that new connections from the tunnel
+// are not forwarded, including to the allowed networks.
+func TestRulesetForwardFromTunnel(t *testing.T) {
+	ruleset := Ruleset(Config{Device: "wg0", Allow: DefaultAllow})
+	_, forward, _ := strings.Cut(ruleset, "chain forward {")
+	forward, _, _ = strings.Cut(forward, "}\n")
+	for _, rule := range strings.Split(strings.TrimSpace(forward), "\n") {
+		rule = strings.TrimSpace(rule)
+		switch {
+		case !strings.HasSuffix(rule, "accept"):
+		case strings.HasPrefix(rule, `oifname "wg0" `):
+		case strings.HasPrefix(rule, `iifname "wg0" ct state established,related `):
+		case strings.HasPrefix(rule, `iifname != "wg0" `):
+		default:
+			t.Errorf("forward rule %q accepts new connections from the tunnel", rule)
+		}
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want []Endpoint
+	}{
+		{"198.51.100.1:51820", []Endpoint{{Addr: netip.MustParseAddr("198.51.100.1"), Port: 51820, Proto: "udp"}}},
+		{"198.51.100.1:443/tcp-client", []Endpoint{{Addr: netip.MustParseAddr("198.51.100.1"), Port: 443, Proto: "tcp"}}},
+		{"[2001:db8::1]:1194/udp6", []Endpoint{{Addr: netip.MustParseAddr("2001:db8::1"), Port: 1194, Proto: "udp"}}},
+	} {
+		got, err := ParseEndpoint(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseEndpoint(%v) = %+v; want %+v", tt.s, got, tt.want)
+		}
+	}
+	for _, s := range []string{"198.51.100.1", "198.51.100.1:x", "198.51.100.1:1194/sctp"} {
+		if _, err := ParseEndpoint(s); err == nil {
+			t.Errorf("ParseEndpoint(%v): got nil error, want error", s)
+		}
+	}
+}
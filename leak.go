@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/StalkR/switchman/leakcheck"
+)
+
+// Tunneled allows implementations to report the network device of their
+// tunnel, to check that traffic goes through it.
+type Tunneled interface {
+	// Device returns the network device of the tunnel, e.g. wg0, or an
+	// error if it is not known, e.g. with another tunnel protocol.
+	Device() (string, error)
+}
+
+// A leakChecker checks for DNS and IPv6 leaks outside the tunnel.
+type leakChecker struct {
+	strict bool // a leak fails the switch
+
+	m    sync.Mutex // protects below
+	last *leakcheck.Result
+}
+
+// Last returns the last check, or nil if none yet.
+func (c *leakChecker) Last() *leakcheck.Result {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.last
+}
+
+// Check checks for leaks outside the tunnel of the backend.
+func (c *leakChecker) Check(s Switchable) (*leakcheck.Result, error) {
+	t, ok := s.(Tunneled)
+	if !ok {
+		return nil, fmt.Errorf("leak check: backend does not report its device")
+	}
+	device, err := t.Device()
+	if err != nil {
+		return nil, fmt.Errorf("leak check: %v", err)
+	}
+	r := leakcheck.Check(device)
+	if r.Leak() {
+		log.Printf("leak check: %v", strings.Join(r.Leaks, "; "))
+	}
+	c.m.Lock()
+	c.last = r
+	c.m.Unlock()
+	return r, nil
+}
+
+// checkAfterSwitch checks for leaks after a switch: in the background, or
+// before returning if strict, failing if there is a leak.
+func (c *leakChecker) checkAfterSwitch(s Switchable) error {
+	if !c.strict {
+		go c.Check(s)
+		return nil
+	}
+	r, err := c.Check(s)
+	if err != nil {
+		return err
+	}
+	if r.Leak() {
+		return fmt.Errorf("switched but leak detected: %v", strings.Join(r.Leaks, "; "))
+	}
+	return nil
+}
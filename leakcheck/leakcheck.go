@@ -0,0 +1,172 @@
+// Package leakcheck checks that DNS and IPv6 traffic go through the VPN:
+// that the system resolvers and the default IPv6 route use its device.
+package leakcheck
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	resolvConf = "/etc/resolv.conf"
+	// systemd-resolved lists its upstream servers there while resolv.conf
+	// points to its local stub resolver
+	resolvedConf = "/run/systemd/resolve/resolv.conf"
+	// a public IPv6 address to look up the default IPv6 route
+	probeIPv6 = "2606:4700:4700::1111"
+)
+
+// A Route is the device traffic to a destination goes through.
+type Route struct {
+	Dest   string `json:"dest"`
+	Device string `json:"device"`
+}
+
+// A Result is the result of a leak check.
+type Result struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	DNS    []Route   `json:"dns"`
+	IPv6   *Route    `json:"ipv6,omitempty"` // nil if no IPv6 route
+	Leaks  []string  `json:"leaks,omitempty"`
+	Errors []string  `json:"errors,omitempty"`
+}
+
+// Leak returns whether a leak was detected.
+func (r *Result) Leak() bool {
+	return len(r.Leaks) > 0
+}
+
+// Check checks that the resolvers and the default IPv6 route go through device.
+func Check(device string) *Result {
+	return check(device, []string{resolvConf, resolvedConf}, routeGet)
+}
+
+func check(device string, confs []string, routeGet func(dest string) (string, error)) *Result {
+	r := &Result{Time: time.Now(), Device: device}
+
+	nameservers, err := resolvers(confs)
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	for _, ns := range nameservers {
+		if ip := net.ParseIP(ns); ip != nil && ip.IsLoopback() {
+			r.Errors = append(r.Errors, fmt.Sprintf("nameserver %v is a local resolver, cannot verify its upstream", ns))
+			continue
+		}
+		dev, err := routeGet(ns)
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+		r.DNS = append(r.DNS, Route{Dest: ns, Device: dev})
+		if dev != device {
+			r.Leaks = append(r.Leaks, fmt.Sprintf("DNS to %v goes through %v, not %v", ns, dev, device))
+		}
+	}
+
+	dev, err := routeGet(probeIPv6)
+	switch {
+	case err == errUnreachable:
+		// no IPv6 route, nothing can leak
+	case err != nil:
+		r.Errors = append(r.Errors, err.Error())
+	default:
+		r.IPv6 = &Route{Dest: probeIPv6, Device: dev}
+		if dev != device {
+			r.Leaks = append(r.Leaks, fmt.Sprintf("IPv6 goes through %v, not %v", dev, device))
+		}
+	}
+	return r
+}
+
+// Resolvers returns the nameservers of the system.
+func Resolvers() ([]string, error) {
+	return resolvers([]string{resolvConf, resolvedConf})
+}
+
+// resolvers returns the nameservers of the first resolv.conf with non-local
+// ones, or the local ones if there are only local ones.
+func resolvers(confs []string) ([]string, error) {
+	var local []string
+	for _, conf := range confs {
+		nameservers, err := readResolvConf(conf)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nameservers {
+			if ip := net.ParseIP(ns); ip == nil || !ip.IsLoopback() {
+				return nameservers, nil
+			}
+		}
+		if local == nil {
+			local = nameservers
+		}
+	}
+	if local == nil {
+		return nil, fmt.Errorf("no nameserver found in %v", strings.Join(confs, ", "))
+	}
+	return local, nil
+}
+
+func readResolvConf(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var nameservers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			// strip IPv6 zone, e.g. fe80::1%eth0
+			ns, _, _ := strings.Cut(fields[1], "%")
+			nameservers = append(nameservers, ns)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nameservers, nil
+}
+
+var errUnreachable = fmt.Errorf("network is unreachable")
+
+// routeGet returns the device traffic to dest goes through.
+func routeGet(dest string) (string, error) {
+	out, err := exec.Command("ip", "route", "get", dest).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "unreachable") {
+			return "", errUnreachable
+		}
+		return "", fmt.Errorf("ip route get %v: %v - %v", dest, err, strings.TrimSpace(string(out)))
+	}
+	return parseRouteDevice(string(out))
+}
+
+// parseRouteDevice parses the device from `ip route get`, e.g.
+// 1.1.1.1 dev wg0 table 51820 src 10.64.0.2 uid 0
+func parseRouteDevice(out string) (string, error) {
+	fields := strings.Fields(out)
+	if len(fields) > 0 {
+		switch fields[0] {
+		case "unreachable", "prohibit", "blackhole":
+			return "", errUnreachable
+		}
+	}
+	for i, f := range fields {
+		if f == "dev" && i+1 < len(fields) {
+			return fields[i+1], nil
+		}
+	}
+	return "", fmt.Errorf("no device in route %q", strings.TrimSpace(out))
+}
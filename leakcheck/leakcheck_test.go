@@ -0,0 +1,74 @@
+package leakcheck
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRouteDevice(t *testing.T) {
+	for _, tt := range []struct {
+		out  string
+		want string
+		err  error
+	}{
+		{"1.1.1.1 dev wg0 table 51820 src 10.64.0.2 uid 0 \n    cache \n", "wg0", nil},
+		{"9.9.9.9 via 192.168.1.1 dev eth0 src 192.168.1.2 uid 0 \n    cache \n", "eth0", nil},
+		{"unreachable 2606:4700:4700::1111 from :: dev lo proto kernel src ::1 metric 0 pref medium\n", "", errUnreachable},
+		{"unreachable 2606:4700:4700::1111\n", "", errUnreachable},
+	} {
+		got, err := parseRouteDevice(tt.out)
+		if got != tt.want || (err == nil) != (tt.err == nil) {
+			t.Errorf("parseRouteDevice(%q) = %q, %v; want %q, %v", tt.out, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "resolv.conf")
+	upstream := filepath.Join(dir, "resolved.conf")
+	if err := os.WriteFile(stub, []byte("# stub\nnameserver 127.0.0.53\noptions edns0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(upstream, []byte("nameserver 10.64.0.1\nnameserver 192.168.1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]string{
+		"10.64.0.1":   "wg0",
+		"192.168.1.1": "eth0",
+		probeIPv6:     "eth0",
+	}
+	routeGet := func(dest string) (string, error) {
+		if dev, ok := routes[dest]; ok {
+			return dev, nil
+		}
+		return "", errUnreachable
+	}
+
+	r := check("wg0", []string{stub, upstream}, routeGet)
+	want := []string{
+		"DNS to 192.168.1.1 goes through eth0, not wg0",
+		"IPv6 goes through eth0, not wg0",
+	}
+	if !r.Leak() || !reflect.DeepEqual(r.Leaks, want) {
+		t.Errorf("Leaks = %q; want %q", r.Leaks, want)
+	}
+	if len(r.Errors) > 0 {
+		t.Errorf("Errors = %q; want none", r.Errors)
+	}
+
+	delete(routes, probeIPv6)
+	routes["192.168.1.1"] = "wg0"
+	r = check("wg0", []string{stub, upstream}, routeGet)
+	if r.Leak() || r.IPv6 != nil || len(r.DNS) != 2 {
+		t.Errorf("check() = %+v; want no leak, no IPv6 route, 2 DNS routes", r)
+	}
+
+	r = check("wg0", []string{stub}, routeGet)
+	if want := []string{"nameserver 127.0.0.53 is a local resolver, cannot verify its upstream"}; !reflect.DeepEqual(r.Errors, want) {
+		t.Errorf("Errors with only a local resolver = %q; want %q", r.Errors, want)
+	}
+}
@@ -3,53 +3,314 @@ Binary switchman is a small web server to switch VPN exits.
 
 Supported VPNs:
   - Mullvad: switch between servers fetched from their API, single config (`wg0.conf`)
-  - basic OpenVPN: switch between `remote` commented out with `;`, single config (`*.conf`)
-  - basic WireGuard: switch between `Endpoint` commented out with `#`, single config (`wg0.conf`)
+  - basic OpenVPN: switch between `remote` or `<connection>` commented out with `;` or `#`,
+    single config (`*.conf`), servers identified as host:port/proto,
+    optionally using the management interface to reconnect and show the connection state,
+    or switch between configs in a directory (`*.conf`, `*.ovpn`), one per server
+  - basic WireGuard: switch between `Endpoint` commented out with `#`, single config (`wg0.conf`),
+    or switch between configs in a directory (`*.conf`), one per server
 */
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/StalkR/switchman/catalog"
+	"github.com/StalkR/switchman/exitcheck"
+	"github.com/StalkR/switchman/killswitch"
 	"github.com/StalkR/switchman/mullvad"
 	"github.com/StalkR/switchman/mullvadapp"
 	"github.com/StalkR/switchman/openvpn"
+	"github.com/StalkR/switchman/routing"
+	"github.com/StalkR/switchman/tailscale"
+	"github.com/StalkR/switchman/wgshow"
 	"github.com/StalkR/switchman/wireguard"
 )
 
 var (
+	flagConfig = flag.String("config", defaultConfig, "JSON config file of flags by name, overridden by SWITCHMAN_<FLAG> environment variables.")
 	flagListen = flag.String("listen", ":81", "Port to listen on for HTTP requests.")
+	flagSocket = flag.String("socket", "/run/switchman.sock", "Unix socket to also listen on for HTTP requests, used by commands (empty to disable).")
+	flagDaemon = flag.String("daemon", "", "Daemon used by commands: unix socket path or http(s) URL (default: -socket, then -listen on localhost).")
 
 	flagMullvad    = flag.Bool("mullvad", false, "Switch Mullvad (via plain WireGuard).")
 	flagMullvadApp = flag.Bool("mullvadapp", false, "Switch Mullvad (via app cli).")
 	flagOpenVPN    = flag.Bool("openvpn", false, "Switch OpenVPN.")
 	flagWireGuard  = flag.Bool("wireguard", false, "Switch WireGuard.")
+	flagTailscale  = flag.Bool("tailscale", false, "Switch Tailscale/Headscale exit nodes.")
+	flagCatalog    = flag.Bool("catalog", false, "Switch wg0.conf between the relays of a JSON relay list (-catalog-list).")
+	flagDetect     = flag.Bool("detect", false, "Print how each backend matches this host, and which is selected, then exit.")
+
+	flagMullvadAccount     = flag.String("mullvad-account", "", "Mullvad account number, to manage the WireGuard key and addresses of wg0.conf with -mullvad.")
+	flagMullvadKeyRotation = flag.Duration("mullvad-key-rotation", 7*24*time.Hour, "Rotate the managed WireGuard key when older (0 to never rotate).")
+	flagMullvadAppGRPC     = flag.Bool("mullvadapp-grpc", false, "With -mullvadapp, use the daemon's gRPC management interface instead of the app cli.")
+
+	flagOpenVPNManagement = flag.String("openvpn-management", "", "OpenVPN management interface (host:port or unix socket path).")
+	flagOpenVPNProfiles   = flag.String("openvpn-profiles", "", "Directory of OpenVPN configs (.conf/.ovpn), each one a server.")
+	flagWireGuardProfiles = flag.String("wireguard-profiles", "", "Directory of WireGuard configs (.conf), each one a server.")
+	flagTailscaleSocket   = flag.String("tailscale-socket", "", "Use the tailscaled local API at this unix socket instead of the tailscale cli, e.g. "+tailscale.DefaultSocket+".")
+	flagCatalogList       = flag.String("catalog-list", "", "JSON relay list of a WireGuard provider (http(s) URL or file path), switched with -catalog.")
+	flagCatalogMap        = flag.String("catalog-map", "", "Keys of the relays of -catalog-list, as comma-separated field=key (fields: relays, id, hostname, port, public_key, active, owned, country, city, provider, multihop_port).")
+
+	flagExitCheck     = flag.Bool("exit-check", false, "Check the public exit after each switch and on demand.")
+	flagExitCheckURL  = flag.String("exit-check-url", exitcheck.MullvadIPv4URL, "JSON endpoint to check the IPv4 exit (empty to skip).")
+	flagExitCheckURL6 = flag.String("exit-check-url6", exitcheck.MullvadIPv6URL, "JSON endpoint to check the IPv6 exit (empty to skip).")
+
+	flagLeakCheck       = flag.Bool("leak-check", false, "Check that DNS and IPv6 go through the tunnel after each switch and on demand.")
+	flagLeakCheckStrict = flag.Bool("leak-check-strict", false, "Fail switches when a leak is detected (implies -leak-check).")
+
+	flagKillSwitch      = flag.Bool("killswitch", false, "Only allow traffic through the tunnel with nftables, including while switching.")
+	flagKillSwitchAllow = flag.String("killswitch-allow", formatPrefixes(killswitch.DefaultAllow), "Comma-separated networks allowed outside the tunnel with -killswitch.")
+
+	flagFailover          = flag.Bool("failover", false, "Switch to another server when the current exit is unhealthy.")
+	flagFailoverInterval  = flag.Duration("failover-interval", 30*time.Second, "Interval between failover health checks.")
+	flagFailoverFailures  = flag.Int("failover-failures", 3, "Consecutive failed health checks before failing over.")
+	flagFailoverCooldown  = flag.Duration("failover-cooldown", 10*time.Minute, "Minimum time between failovers, and before failing back to a server.")
+	flagFailoverHandshake = flag.Duration("failover-handshake", wgshow.StaleHandshake, "Maximum WireGuard handshake age for a healthy exit (0 to skip).")
+	flagFailoverProbe     = flag.String("failover-probe", "", "URL which must be reachable for a healthy exit (empty to skip).")
+	flagFailoverPolicy    = flag.String("failover-policy", "next", "Server to fail over to: next (in list order) or random.")
+
+	flagAuditLog     = flag.String("audit-log", "/var/log/switchman/audit.log", "File to record switches and routing changes as JSON lines (empty to disable).")
+	flagTrustedProxy = flag.String("trusted-proxy", "", "Comma-separated networks of reverse proxies trusted for the user (basic auth or X-Forwarded-User) and address (X-Forwarded-For) of requests.")
+
+	flagPreSwitchHook  = flag.String("pre-switch-hook", "", "Script run before each switch, which vetoes it by failing.")
+	flagPostSwitchHook = flag.String("post-switch-hook", "", "Script run after each switch.")
+	flagWebhooks       multiFlag
+
+	flagState   = flag.String("state", "/var/lib/switchman/state.json", "File to persist state: favorites, groups and client routing choices.")
+	flagTunnels multiFlag
+	flagClients multiFlag
 )
 
+func init() {
+	flag.Var(&flagTunnels, "tunnel", "Tunnel LAN clients can be routed through, as name=device or name=device/backend (mullvad or wireguard) to switch it (repeatable).")
+	flag.Var(&flagClients, "client", "LAN client routed through a tunnel, as ip=tunnel or mac=tunnel (repeatable).")
+	flag.Var(&flagWebhooks, "webhook", "URL notified of switches, as [json=|slack=|matrix=]url (repeatable).")
+}
+
+// multiFlag is a flag which can be repeated.
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
 	flag.Parse()
+	cmdline := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { cmdline[f.Name] = true })
+	if err := loadConfig(flag.CommandLine, *flagConfig, cmdline); err != nil {
+		log.Fatal(err)
+	}
 
-	s, err := func() (Switchable, error) {
-		switch {
-		case *flagMullvad:
-			return mullvad.New()
-		case *flagMullvadApp:
-			return mullvadapp.New()
-		case *flagOpenVPN:
-			return openvpn.New()
-		case *flagWireGuard:
-			return wireguard.New()
-		default:
-			return autodetect()
+	if *flagDetect {
+		if err := writeDetection(os.Stdout, detectBackends()); err != nil {
+			log.Fatal(err)
 		}
-	}()
+		return
+	}
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	s, err := newBackend()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, err := setup(ctx, s, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Fatal(serve(s, *flagListen))
+	var h reloadable
+	h.set(srv)
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			restart := restartValues(flag.CommandLine)
+			if err := loadConfig(flag.CommandLine, *flagConfig, cmdline); err != nil {
+				log.Printf("reload: %v", err)
+				continue
+			}
+			for name, value := range restartValues(flag.CommandLine) {
+				if value != restart[name] {
+					log.Printf("reload: %v changed, restart to apply", name)
+				}
+			}
+			nctx, ncancel := context.WithCancel(context.Background())
+			nsrv, err := setup(nctx, s, srv)
+			if err != nil {
+				ncancel()
+				log.Printf("reload: %v, keeping the running configuration", err)
+				continue
+			}
+			h.set(nsrv)
+			cancel()
+			teardown(srv, nsrv)
+			srv, cancel = nsrv, ncancel
+			log.Printf("reloaded")
+		}
+	}()
+	log.Fatal(serve(&h, *flagListen, *flagSocket))
+}
+
+// newBackend creates the backend selected by flags, or autodetected.
+func newBackend() (Switchable, error) {
+	switch {
+	case *flagMullvad:
+		return mullvad.New(mullvadOptions()...)
+	case *flagMullvadApp:
+		return newMullvadApp()
+	case *flagOpenVPN:
+		return openvpn.New(openvpnOptions()...)
+	case *flagWireGuard:
+		return wireguard.New(wireguardOptions()...)
+	case *flagTailscale:
+		return tailscale.New(tailscaleOptions()...)
+	case *flagCatalog:
+		return newCatalog()
+	}
+	return autodetect()
+}
+
+// setup creates the server for the backend from the flags, with background
+// work running until ctx is done. On reload, prev is the running server,
+// whose metrics, events, switch lock, kill switch and failover history are
+// kept, so a switch in progress on it is not interleaved with the new one.
+func setup(ctx context.Context, s Switchable, prev *server) (*server, error) {
+	srv := newServer(s)
+	if prev != nil {
+		srv.metrics, srv.events, srv.switching = prev.metrics, prev.events, prev.switching
+	}
+	var err error
+	if *flagAuditLog != "" {
+		srv.audit = newAuditLog(*flagAuditLog)
+	}
+	if srv.proxies, err = parsePrefixes(*flagTrustedProxy); err != nil {
+		return nil, err
+	}
+	if *flagPreSwitchHook != "" || *flagPostSwitchHook != "" || len(flagWebhooks) > 0 {
+		var webhooks []webhook
+		for _, e := range flagWebhooks {
+			w, err := parseWebhook(e)
+			if err != nil {
+				return nil, err
+			}
+			webhooks = append(webhooks, w)
+		}
+		srv.hooks = newHooks(*flagPreSwitchHook, *flagPostSwitchHook, webhooks)
+	}
+	if *flagFailover {
+		if srv.failover, err = newFailover(*flagFailoverInterval, *flagFailoverFailures, *flagFailoverCooldown, *flagFailoverHandshake, *flagFailoverProbe, *flagFailoverPolicy); err != nil {
+			return nil, err
+		}
+		if prev != nil && prev.failover != nil {
+			srv.failover.inherit(prev.failover)
+		}
+	}
+	if srv.state, err = loadState(*flagState); err != nil {
+		return nil, err
+	}
+	if len(flagTunnels) > 0 {
+		if srv.route, err = newRouter(flagTunnels, flagClients, srv.state, tunnelBackends(s, prev)); err != nil {
+			return nil, err
+		}
+	}
+	if *flagKillSwitch {
+		allow, err := parsePrefixes(*flagKillSwitchAllow)
+		if err != nil {
+			return nil, err
+		}
+		if srv.route != nil {
+			if err := checkTunnels(s, srv.route.tunnels); err != nil {
+				return nil, err
+			}
+		}
+		if prev != nil && prev.kill != nil {
+			srv.kill = prev.kill
+			if err := srv.kill.reconfigure(s, allow); err != nil {
+				return nil, err
+			}
+		} else if srv.kill, err = newKillSwitch(s, allow); err != nil {
+			return nil, err
+		}
+	}
+	if *flagExitCheck {
+		srv.exits = newExitChecker(*flagExitCheckURL, *flagExitCheckURL6)
+		go srv.exits.Check(s)
+	}
+	if *flagLeakCheck || *flagLeakCheckStrict {
+		srv.leaks = &leakChecker{strict: *flagLeakCheckStrict}
+		go srv.leaks.Check(s)
+	}
+	if srv.route != nil {
+		go srv.route.periodicallyApply(ctx)
+	}
+	if srv.failover != nil {
+		go srv.failover.run(ctx, srv)
+	}
+	go srv.watch(ctx)
+	return srv, nil
+}
+
+// tunnelBackends returns the backends of the tunnels routing clients: the
+// backend of the server for its own device, otherwise a new one of the kind,
+// kept from the previous server on reload. Without kind, other tunnels can
+// only be routed through, not switched.
+func tunnelBackends(s Switchable, prev *server) tunnelBackend {
+	return func(device, kind string) (Switchable, error) {
+		if t, ok := s.(Tunneled); ok {
+			if d, err := t.Device(); err == nil && d == device {
+				return s, nil
+			}
+		}
+		if prev != nil && prev.route != nil {
+			if b := prev.route.backend(device, kind); b != nil && b != prev.Switchable {
+				return b, nil
+			}
+		}
+		switch kind {
+		case "":
+			return nil, nil
+		case "mullvad":
+			return mullvad.New(append(mullvadOptions(), mullvad.WithDevice(device))...)
+		case "wireguard":
+			// profiles are for the device of the server
+			return wireguard.New(wireguard.WithDevice(device))
+		}
+		return nil, fmt.Errorf("backend %v cannot switch a tunnel, want mullvad or wireguard", kind)
+	}
+}
+
+// teardown removes the rules of features of the previous server disabled on reload.
+func teardown(prev, srv *server) {
+	if prev.kill != nil && srv.kill == nil {
+		if err := killswitch.Remove(); err != nil {
+			log.Printf("reload: kill switch: %v", err)
+		}
+	}
+	if prev.route != nil && srv.route == nil {
+		if err := routing.Apply(nil, nil); err != nil {
+			log.Printf("reload: routing: %v", err)
+		}
+	}
 }
 
 // A Switchable implements support for a VPN that can be switched servers.
@@ -63,18 +324,66 @@ type Switchable interface {
 	Switch(server string) error
 }
 
-var errNotConfigured = errors.New("not configured")
+func mullvadOptions() []mullvad.Option {
+	var options []mullvad.Option
+	if *flagMullvadAccount != "" {
+		options = append(options, mullvad.WithAccount(*flagMullvadAccount), mullvad.WithKeyRotation(*flagMullvadKeyRotation))
+	}
+	return options
+}
 
-func autodetect() (Switchable, error) {
-	for _, f := range []func() (Switchable, error){
-		func() (Switchable, error) { return mullvad.New() },
-		func() (Switchable, error) { return mullvadapp.New() },
-		func() (Switchable, error) { return openvpn.New() },
-		func() (Switchable, error) { return wireguard.New() },
-	} {
-		if s, err := f(); err == nil {
-			return s, nil
-		}
+// newMullvadApp creates the Mullvad app backend, via the daemon's gRPC
+// management interface or the app cli.
+func newMullvadApp() (Switchable, error) {
+	if *flagMullvadAppGRPC {
+		return mullvadapp.NewDaemon(mullvadapp.DaemonSocket)
 	}
-	return nil, fmt.Errorf("no supported VPN found")
+	return mullvadapp.New()
 }
+
+func openvpnOptions() []openvpn.Option {
+	var options []openvpn.Option
+	if *flagOpenVPNManagement != "" {
+		options = append(options, openvpn.WithManagement(*flagOpenVPNManagement))
+	}
+	if *flagOpenVPNProfiles != "" {
+		options = append(options, openvpn.WithProfiles(*flagOpenVPNProfiles))
+	}
+	return options
+}
+
+func wireguardOptions() []wireguard.Option {
+	var options []wireguard.Option
+	if *flagWireGuardProfiles != "" {
+		options = append(options, wireguard.WithProfiles(*flagWireGuardProfiles))
+	}
+	return options
+}
+
+func tailscaleOptions() []tailscale.Option {
+	var options []tailscale.Option
+	if *flagTailscaleSocket != "" {
+		options = append(options, tailscale.WithLocalAPI(*flagTailscaleSocket))
+	}
+	return options
+}
+
+// catalogDevice is the device switched between the relays of -catalog-list.
+const catalogDevice = "wg0"
+
+// newCatalog creates the backend switching the config of catalogDevice
+// between the relays of -catalog-list.
+func newCatalog() (Switchable, error) {
+	provider, err := catalog.NewJSONList(*flagCatalogList, *flagCatalogMap)
+	if err != nil {
+		return nil, err
+	}
+	s := catalog.New("/etc/wireguard/"+catalogDevice+".conf", catalogDevice, provider)
+	if _, err := s.Current(); err != nil {
+		return nil, err
+	}
+	go s.FetchPeriodically()
+	return s, nil
+}
+
+var errNotConfigured = errors.New("not configured")
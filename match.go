@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxCandidates is the number of candidates shown in ambiguous errors.
+const maxCandidates = 10
+
+// An ambiguousError is returned when a query matches several servers.
+type ambiguousError struct {
+	query      string
+	candidates []string // sorted
+}
+
+func (e *ambiguousError) Error() string {
+	candidates := strings.Join(e.candidates, ", ")
+	if n := len(e.candidates); n > maxCandidates {
+		candidates = fmt.Sprintf("%v and %d more", strings.Join(e.candidates[:maxCandidates], ", "), n-maxCandidates)
+	}
+	return fmt.Sprintf("%q matches %d servers: %v", e.query, len(e.candidates), candidates)
+}
+
+// matchServer returns the server matching a query: the server itself, the
+// only server starting with it, or the only server whose words start with
+// the words of the query in order, ignoring case and with numbers equal,
+// e.g. "got 3" for se-got-wg-003.relays.mullvad.net:51820.
+func matchServer(query string, servers []string) (string, error) {
+	if slices.Contains(servers, query) {
+		return query, nil
+	}
+	lower := strings.ToLower(query)
+	q := words(query)
+	for _, match := range []func(server string) bool{
+		func(server string) bool { return strings.HasPrefix(strings.ToLower(server), lower) },
+		func(server string) bool { return len(q) > 0 && matchWords(q, words(server)) },
+	} {
+		var candidates []string
+		for _, server := range servers {
+			if match(server) {
+				candidates = append(candidates, server)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			return candidates[0], nil
+		}
+		sort.Strings(candidates)
+		return "", &ambiguousError{query: query, candidates: candidates}
+	}
+	return "", fmt.Errorf("no server matches %q", query)
+}
+
+// words splits a server or query into lower case words of letters and
+// numbers, without leading zeros: se-got-wg-003 is se, got, wg, 3.
+func words(s string) []string {
+	w := strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	for i, e := range w {
+		if isNumber(e) {
+			if w[i] = strings.TrimLeft(e, "0"); w[i] == "" {
+				w[i] = "0"
+			}
+		}
+	}
+	return w
+}
+
+func isNumber(s string) bool {
+	return strings.IndexFunc(s, func(c rune) bool { return !unicode.IsDigit(c) }) < 0
+}
+
+// matchWords returns whether the query words match server words in order:
+// numbers equal, otherwise a prefix.
+func matchWords(query, server []string) bool {
+	for _, q := range query {
+		for {
+			if len(server) == 0 {
+				return false
+			}
+			w := server[0]
+			server = server[1:]
+			if isNumber(q) && w == q || !isNumber(q) && strings.HasPrefix(w, q) {
+				break
+			}
+		}
+	}
+	return true
+}
+
+// match returns the server of an alias or matching a query.
+func (s *server) match(query string) (string, error) {
+	if strings.HasPrefix(query, "@") {
+		return s.resolve(query)
+	}
+	servers, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	return matchServer(query, servers)
+}
+
+var candidatesTmpl = template.Must(template.New("").Parse(`<p>"{{.Query}}" matches {{len .Candidates}} servers:</p>
+<ul>
+{{range .Candidates}}<li><a href="switch?server={{.}}">{{.}}</a></li>{{end}}
+</ul>`))
+
+// candidates responds to an ambiguous switch: the candidates to switch to
+// for browsers, otherwise the error.
+func candidates(w http.ResponseWriter, r *http.Request, s *server, err *ambiguousError) {
+	if !acceptsHTML(r) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	var content strings.Builder
+	if err := candidatesTmpl.Execute(&content, struct {
+		Query      string
+		Candidates []string
+	}{
+		Query:      err.query,
+		Candidates: err.candidates,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	w.WriteHeader(http.StatusConflict)
+	if err := page(w, s, content.String()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchServer(t *testing.T) {
+	servers := []string{
+		"se-got-wg-001.relays.mullvad.net:51820",
+		"se-got-wg-003.relays.mullvad.net:51820",
+		"se-got-wg-031.relays.mullvad.net:51820",
+		"se-sto-wg-001.relays.mullvad.net:51820",
+		"ch-zrh-wg-001.relays.mullvad.net:51820",
+		"se-got-wg-001",
+	}
+	for _, tt := range []struct {
+		query      string
+		want       string
+		candidates int // if ambiguous
+	}{
+		{"se-got-wg-001", "se-got-wg-001", 0},
+		{"se-got-wg-003", "se-got-wg-003.relays.mullvad.net:51820", 0},
+		{"CH", "ch-zrh-wg-001.relays.mullvad.net:51820", 0},
+		{"got 3", "se-got-wg-003.relays.mullvad.net:51820", 0},
+		{"got 31", "se-got-wg-031.relays.mullvad.net:51820", 0},
+		{"sto", "se-sto-wg-001.relays.mullvad.net:51820", 0},
+		{"zrh 1", "ch-zrh-wg-001.relays.mullvad.net:51820", 0},
+		{"se-got", "", 4},
+		{"got 1", "", 2},
+		{"se", "", 5},
+		{"3 got", "", -1},
+		{"us", "", -1},
+		{"", "", 6},
+	} {
+		got, err := matchServer(tt.query, servers)
+		var ambiguous *ambiguousError
+		switch {
+		case tt.candidates > 0:
+			if !errors.As(err, &ambiguous) || len(ambiguous.candidates) != tt.candidates {
+				t.Errorf("matchServer(%q) = %v, %v; want %d candidates", tt.query, got, err, tt.candidates)
+			}
+		case tt.candidates < 0:
+			if err == nil || errors.As(err, &ambiguous) {
+				t.Errorf("matchServer(%q) = %v, %v; want no match", tt.query, got, err)
+			}
+		case err != nil || got != tt.want:
+			t.Errorf("matchServer(%q) = %v, %v; want %v", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	var servers []string
+	for _, e := range "abcdefghijkl" {
+		servers = append(servers, "se-"+string(e))
+	}
+	_, err := matchServer("se", servers)
+	want := `"se" matches 12 servers: se-a, se-b, se-c, se-d, se-e, se-f, se-g, se-h, se-i, se-j and 2 more`
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v; want %v", err, want)
+	}
+}
+
+func TestHandleSwitchMatch(t *testing.T) {
+	fake := &fakeSwitchable{current: "a", servers: []string{"se-got-1", "se-got-2", "ch-zrh-1"}}
+	s := newServer(fake)
+
+	w := httptest.NewRecorder()
+	s.handleSwitch(w, httptest.NewRequest("GET", "/switch?server=zrh", nil))
+	if w.Code != http.StatusOK || fake.current != "ch-zrh-1" {
+		t.Errorf("switch zrh: code %v, current %v; want %v, ch-zrh-1", w.Code, fake.current, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleSwitch(w, httptest.NewRequest("GET", "/switch?server=got", nil))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "se-got-1, se-got-2") {
+		t.Errorf("switch got: code %v, body %q; want %v with candidates", w.Code, w.Body.String(), http.StatusConflict)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/switch?server=got", nil)
+	r.Header.Set("Accept", "text/html")
+	s.handleSwitch(w, r)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `<a href="switch?server=se-got-2">se-got-2</a>`) {
+		t.Errorf("switch got from browser: code %v, body %q; want %v with links", w.Code, w.Body.String(), http.StatusConflict)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/switchman/catalog"
+	"github.com/StalkR/switchman/mullvad"
+	"github.com/StalkR/switchman/mullvadapp"
+	"github.com/StalkR/switchman/openvpn"
+	"github.com/StalkR/switchman/tailscale"
+	"github.com/StalkR/switchman/wireguard"
+)
+
+// relayCatalog is implemented by backends fetching a relay list.
+type relayCatalog interface {
+	// RelayListFetched returns when the relay list was last fetched
+	// successfully and the error of the last fetch if it failed.
+	RelayListFetched() (time.Time, error)
+}
+
+// backendName returns the name of the backend, as selected by flags.
+func backendName(s Switchable) string {
+	switch s.(type) {
+	case *mullvad.Server:
+		return "mullvad"
+	case *mullvadapp.Server, *mullvadapp.Daemon:
+		return "mullvadapp"
+	case *openvpn.Server:
+		return "openvpn"
+	case *wireguard.Server:
+		return "wireguard"
+	case *tailscale.Server:
+		return "tailscale"
+	case *catalog.Server:
+		return "catalog"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// switchDurationBuckets are the upper bounds of the switch duration histogram.
+var switchDurationBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 120}
+
+// metrics records switches to export them to Prometheus.
+// The zero value is ready to use.
+type metrics struct {
+	m         sync.Mutex     // protects below
+	switches  map[string]int // by outcome
+	durations []int          // count by bucket, last is +Inf
+	sum       float64
+}
+
+// observe records a switch.
+func (m *metrics) observe(d time.Duration, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.switches == nil {
+		m.switches = map[string]int{}
+		m.durations = make([]int, len(switchDurationBuckets)+1)
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.switches[outcome]++
+	seconds := d.Seconds()
+	m.sum += seconds
+	i := sort.SearchFloat64s(switchDurationBuckets, seconds)
+	m.durations[i]++
+}
+
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, s)
+}
+
+// writeMetrics writes metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, s *server) {
+	backend := labels("backend", backendName(s.Switchable))
+
+	s.metrics.m.Lock()
+	fmt.Fprintln(w, "# HELP switchman_switches_total Switches by outcome.")
+	fmt.Fprintln(w, "# TYPE switchman_switches_total counter")
+	for _, outcome := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "switchman_switches_total%s %d\n", labels("backend", backendName(s.Switchable), "outcome", outcome), s.metrics.switches[outcome])
+	}
+	fmt.Fprintln(w, "# HELP switchman_switch_duration_seconds Duration of switches.")
+	fmt.Fprintln(w, "# TYPE switchman_switch_duration_seconds histogram")
+	count := 0
+	for i, le := range switchDurationBuckets {
+		if s.metrics.durations != nil {
+			count += s.metrics.durations[i]
+		}
+		fmt.Fprintf(w, "switchman_switch_duration_seconds_bucket%s %d\n", labels("backend", backendName(s.Switchable), "le", fmt.Sprint(le)), count)
+	}
+	if s.metrics.durations != nil {
+		count += s.metrics.durations[len(switchDurationBuckets)]
+	}
+	fmt.Fprintf(w, "switchman_switch_duration_seconds_bucket%s %d\n", labels("backend", backendName(s.Switchable), "le", "+Inf"), count)
+	fmt.Fprintf(w, "switchman_switch_duration_seconds_sum%s %g\n", backend, s.metrics.sum)
+	fmt.Fprintf(w, "switchman_switch_duration_seconds_count%s %d\n", backend, count)
+	s.metrics.m.Unlock()
+
+	fmt.Fprintln(w, "# HELP switchman_current_server Current server, as a label.")
+	fmt.Fprintln(w, "# TYPE switchman_current_server gauge")
+	if current, err := s.Current(); err == nil {
+		fmt.Fprintf(w, "switchman_current_server%s 1\n", labels("backend", backendName(s.Switchable), "server", current))
+	}
+	fmt.Fprintln(w, "# HELP switchman_servers Number of available servers.")
+	fmt.Fprintln(w, "# TYPE switchman_servers gauge")
+	if servers, err := s.List(); err == nil {
+		fmt.Fprintf(w, "switchman_servers%s %d\n", backend, len(servers))
+	}
+
+	if c, ok := s.Switchable.(relayCatalog); ok {
+		fetched, err := c.RelayListFetched()
+		fmt.Fprintln(w, "# HELP switchman_relay_list_age_seconds Time since the relay list was last fetched successfully.")
+		fmt.Fprintln(w, "# TYPE switchman_relay_list_age_seconds gauge")
+		if !fetched.IsZero() {
+			fmt.Fprintf(w, "switchman_relay_list_age_seconds%s %g\n", backend, time.Since(fetched).Seconds())
+		}
+		fmt.Fprintln(w, "# HELP switchman_relay_list_fetch_error Whether the last fetch of the relay list failed.")
+		fmt.Fprintln(w, "# TYPE switchman_relay_list_fetch_error gauge")
+		failed := 0
+		if err != nil {
+			failed = 1
+		}
+		fmt.Fprintf(w, "switchman_relay_list_fetch_error%s %d\n", backend, failed)
+	}
+
+	if ws, ok := s.Switchable.(wireGuardStatusable); ok {
+		fmt.Fprintln(w, "# HELP switchman_wireguard_up Whether the WireGuard interface is up.")
+		fmt.Fprintln(w, "# TYPE switchman_wireguard_up gauge")
+		d, err := ws.Status()
+		if err != nil {
+			device := ""
+			if t, ok := s.Switchable.(Tunneled); ok {
+				device, _ = t.Device()
+			}
+			fmt.Fprintf(w, "switchman_wireguard_up%s 0\n", labels("backend", backendName(s.Switchable), "device", device))
+			return
+		}
+		fmt.Fprintf(w, "switchman_wireguard_up%s 1\n", labels("backend", backendName(s.Switchable), "device", d.Name))
+		fmt.Fprintln(w, "# HELP switchman_wireguard_handshake_age_seconds Time since the latest handshake with the peer.")
+		fmt.Fprintln(w, "# TYPE switchman_wireguard_handshake_age_seconds gauge")
+		for _, p := range d.Peers {
+			if !p.LatestHandshake.IsZero() {
+				fmt.Fprintf(w, "switchman_wireguard_handshake_age_seconds%s %g\n", labels("device", d.Name, "peer", p.PublicKey, "endpoint", p.Endpoint), time.Since(p.LatestHandshake).Seconds())
+			}
+		}
+		fmt.Fprintln(w, "# HELP switchman_wireguard_receive_bytes_total Bytes received from the peer.")
+		fmt.Fprintln(w, "# TYPE switchman_wireguard_receive_bytes_total counter")
+		for _, p := range d.Peers {
+			fmt.Fprintf(w, "switchman_wireguard_receive_bytes_total%s %d\n", labels("device", d.Name, "peer", p.PublicKey, "endpoint", p.Endpoint), p.RxBytes)
+		}
+		fmt.Fprintln(w, "# HELP switchman_wireguard_transmit_bytes_total Bytes sent to the peer.")
+		fmt.Fprintln(w, "# TYPE switchman_wireguard_transmit_bytes_total counter")
+		for _, p := range d.Peers {
+			fmt.Fprintf(w, "switchman_wireguard_transmit_bytes_total%s %d\n", labels("device", d.Name, "peer", p.PublicKey, "endpoint", p.Endpoint), p.TxBytes)
+		}
+	}
+}
+
+// labels formats label pairs, escaping values.
+func labels(kv ...string) string {
+	var pairs []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, kv[i], v))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newServer(&fakeSwitchable{current: `a"b`, servers: []string{`a"b`, "c"}})
+	s.metrics.observe(3*time.Second, nil)
+	s.metrics.observe(200*time.Second, errors.New("failed"))
+	var b strings.Builder
+	writeMetrics(&b, s)
+	for _, want := range []string{
+		`switchman_switches_total{backend="*main.fakeSwitchable",outcome="success"} 1`,
+		`switchman_switches_total{backend="*main.fakeSwitchable",outcome="failure"} 1`,
+		`switchman_switch_duration_seconds_bucket{backend="*main.fakeSwitchable",le="2"} 0`,
+		`switchman_switch_duration_seconds_bucket{backend="*main.fakeSwitchable",le="5"} 1`,
+		`switchman_switch_duration_seconds_bucket{backend="*main.fakeSwitchable",le="+Inf"} 2`,
+		`switchman_switch_duration_seconds_sum{backend="*main.fakeSwitchable"} 203`,
+		`switchman_switch_duration_seconds_count{backend="*main.fakeSwitchable"} 2`,
+		`switchman_current_server{backend="*main.fakeSwitchable",server="a\"b"} 1`,
+		`switchman_servers{backend="*main.fakeSwitchable"} 2`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("metrics do not contain %v:\n%v", want, b.String())
+		}
+	}
+}
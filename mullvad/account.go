@@ -0,0 +1,130 @@
+package mullvad
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net/http"
+  "strings"
+  "time"
+)
+
+// https://api.mullvad.net/accounts/v1/
+const accountAPIURL = "https://api.mullvad.net"
+
+// An accountDevice is a WireGuard key registered on the account, with its
+// addresses.
+type accountDevice struct {
+  ID          string    `json:"id"`
+  Name        string    `json:"name"`
+  PublicKey   string    `json:"pubkey"`
+  Created     time.Time `json:"created"`
+  IPv4Address string    `json:"ipv4_address"`
+  IPv6Address string    `json:"ipv6_address"`
+}
+
+// An account is a client of the Mullvad account API.
+type account struct {
+  url    string
+  number string
+  client *http.Client
+}
+
+func newAccount(number string) *account {
+  return &account{
+    url:    accountAPIURL,
+    number: strings.ReplaceAll(number, " ", ""),
+    client: &http.Client{Timeout: 30 * time.Second},
+  }
+}
+
+// token returns an access token for the account.
+func (a *account) token() (string, error) {
+  var resp struct {
+    AccessToken string `json:"access_token"`
+  }
+  if err := a.call("", "POST", "/auth/v1/token", map[string]string{"account_number": a.number}, &resp); err != nil {
+    return "", err
+  }
+  return resp.AccessToken, nil
+}
+
+// devices returns the devices of the account.
+func (a *account) devices() ([]accountDevice, error) {
+  token, err := a.token()
+  if err != nil {
+    return nil, err
+  }
+  var devices []accountDevice
+  if err := a.call(token, "GET", "/accounts/v1/devices", nil, &devices); err != nil {
+    return nil, err
+  }
+  return devices, nil
+}
+
+// register registers a public key as a new device.
+func (a *account) register(publicKey string) (*accountDevice, error) {
+  token, err := a.token()
+  if err != nil {
+    return nil, err
+  }
+  var d accountDevice
+  req := map[string]any{"pubkey": publicKey, "hijack_dns": false}
+  if err := a.call(token, "POST", "/accounts/v1/devices", req, &d); err != nil {
+    return nil, err
+  }
+  return &d, nil
+}
+
+// replaceKey replaces the public key of a device, which gets new addresses.
+func (a *account) replaceKey(id, publicKey string) (*accountDevice, error) {
+  token, err := a.token()
+  if err != nil {
+    return nil, err
+  }
+  var d accountDevice
+  if err := a.call(token, "PUT", "/accounts/v1/devices/"+id+"/pubkey", map[string]string{"pubkey": publicKey}, &d); err != nil {
+    return nil, err
+  }
+  return &d, nil
+}
+
+// call calls the API with a JSON request and decodes the JSON response.
+func (a *account) call(token, method, path string, request, response any) error {
+  var body io.Reader
+  if request != nil {
+    b, err := json.Marshal(request)
+    if err != nil {
+      return err
+    }
+    body = bytes.NewReader(b)
+  }
+  req, err := http.NewRequest(method, a.url+path, body)
+  if err != nil {
+    return err
+  }
+  if request != nil {
+    req.Header.Set("Content-Type", "application/json")
+  }
+  if token != "" {
+    req.Header.Set("Authorization", "Bearer "+token)
+  }
+  resp, err := a.client.Do(req)
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode/100 != 2 {
+    // errors are {"code": "INVALID_ACCOUNT", "detail": "..."}
+    var e struct {
+      Code   string `json:"code"`
+      Detail string `json:"detail"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && e.Code != "" {
+      return fmt.Errorf("mullvad account API %v %v: %v: %v", method, path, e.Code, e.Detail)
+    }
+    return fmt.Errorf("mullvad account API %v %v: %v", method, path, resp.Status)
+  }
+  return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -3,9 +3,9 @@ package mullvad
 import (
   "encoding/json"
   "fmt"
-  "net"
   "net/http"
-  "strconv"
+
+  "github.com/StalkR/switchman/catalog"
 )
 
 // https://api.mullvad.net/public/documentation/
@@ -66,19 +66,11 @@ type apiv2Response struct {
   } `json:"wireguard"`
 }
 
-type relay struct {
-  ID           string
-  Hostname     string
-  Port         int
-  Active       bool
-  Owned        bool
-  Country      string
-  City         string
-  PublicKey    string
-  MultihopPort int
-}
+// provider is the catalog adapter for the Mullvad relay list.
+type provider struct{}
 
-func (s *Server) fetchRelays() ([]relay, error) {
+// Fetch fetches the WireGuard relays from the API.
+func (provider) Fetch() ([]catalog.Relay, error) {
   resp1, err := http.Get(apiv1URL)
   if err != nil {
     return nil, err
@@ -127,9 +119,9 @@ func (s *Server) fetchRelays() ([]relay, error) {
     }
   }
 
-  var servers []relay
+  var servers []catalog.Relay
   for _, r := range v2.WireGuard.Relays {
-    servers = append(servers, relay{
+    servers = append(servers, catalog.Relay{
       ID:           r.Hostname,
       Hostname:     r.Hostname + relaySuffix,
       Port:         relayPort,
@@ -137,6 +129,7 @@ func (s *Server) fetchRelays() ([]relay, error) {
       Owned:        r.Owned,
       Country:      locations[r.Location].Country,
       City:         locations[r.Location].City,
+      Provider:     r.Provider,
       PublicKey:    r.PublicKey,
       MultihopPort: multihopPort[r.Hostname],
     })
@@ -145,40 +138,17 @@ func (s *Server) fetchRelays() ([]relay, error) {
   return servers, nil
 }
 
-// findRelays finds the relays for this server.
-// If single-hop, it returns the single relay.
-// If multi-hop, it returns the entry relay then the exit.
-func (s *Server) findRelays(server string) ([]relay, error) {
-  host, sport, err := net.SplitHostPort(server)
-  if err != nil {
-    return nil, err
+// Peer returns the peer settings of the relays of a server: a relay at its
+// port, or the entry relay at the multihop port of the exit, with the key of
+// the exit.
+func (provider) Peer(relays []catalog.Relay) catalog.Peer {
+  entry, exit := relays[0], relays[len(relays)-1]
+  port := entry.Port
+  if len(relays) > 1 {
+    port = exit.MultihopPort
   }
-  port, err := strconv.Atoi(sport)
-  if err != nil {
-    return nil, err
-  }
-  relays, err := s.listRelays()
-  if err != nil {
-    return nil, err
-  }
-  var entry relay
-  for _, e := range relays {
-    // single-hop
-    if e.Hostname == host && e.Port == port {
-      return []relay{e}, nil
-    }
-    // multi-hop
-    if e.Hostname == host {
-      entry = e
-    }
-  }
-  for _, e := range relays {
-    if e.MultihopPort == port {
-      if entry.Hostname == "" {
-        return nil, fmt.Errorf("found exit server (multihop port) but not entry server %v", host)
-      }
-      return []relay{entry, e}, nil
-    }
+  return catalog.Peer{
+    Endpoint:  fmt.Sprintf("%s:%d", entry.Hostname, port),
+    PublicKey: exit.PublicKey,
   }
-  return nil, fmt.Errorf("server %v not found", server)
 }
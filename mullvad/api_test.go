@@ -0,0 +1,23 @@
+package mullvad
+
+import (
+  "testing"
+
+  "github.com/StalkR/switchman/catalog"
+)
+
+func TestPeer(t *testing.T) {
+  entry := catalog.Relay{Hostname: "se-got-wg-001" + relaySuffix, Port: relayPort, PublicKey: "entry", MultihopPort: 3001}
+  exit := catalog.Relay{Hostname: "ch-zrh-wg-001" + relaySuffix, Port: relayPort, PublicKey: "exit", MultihopPort: 3002}
+  for _, tt := range []struct {
+    relays []catalog.Relay
+    want   catalog.Peer
+  }{
+    {[]catalog.Relay{entry}, catalog.Peer{Endpoint: "se-got-wg-001.relays.mullvad.net:51820", PublicKey: "entry"}},
+    {[]catalog.Relay{entry, exit}, catalog.Peer{Endpoint: "se-got-wg-001.relays.mullvad.net:3002", PublicKey: "exit"}},
+  } {
+    if got := (provider{}).Peer(tt.relays); got != tt.want {
+      t.Errorf("Peer(%v relays) = %+v; want %+v", len(tt.relays), got, tt.want)
+    }
+  }
+}
@@ -0,0 +1,29 @@
+package mullvad
+
+import (
+  "strings"
+
+  "github.com/StalkR/switchman/catalog"
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for a Mullvad WireGuard config: wg0.conf with a relay endpoint.
+func Detect() *detect.Result {
+  const config = "/etc/wireguard/wg0.conf"
+  r := detect.New("mullvad")
+  if !r.File(config) {
+    return r.Score(0, "no %v", config)
+  }
+  current, err := catalog.Endpoint(config)
+  if err != nil {
+    return r.Score(0, "cannot read %v: %v", config, err)
+  }
+  host, _, _ := strings.Cut(current, ":")
+  if !strings.HasSuffix(host, relaySuffix) {
+    return r.Score(0, "endpoint %q in %v is not a Mullvad relay", current, config)
+  }
+  if r.Interface(defaultDevice) {
+    return r.Score(90, "Mullvad relay endpoint %v in %v, %v up", current, config, defaultDevice)
+  }
+  return r.Score(70, "Mullvad relay endpoint %v in %v, %v down", current, config, defaultDevice)
+}
@@ -0,0 +1,11 @@
+package mullvad
+
+// VerifyExit returns whether the exit hostname reported by am.i.mullvad.net
+// is the exit relay of the server: the relay itself, or the exit if multi-hop.
+func (s *Server) VerifyExit(server, hostname string) bool {
+  relays, err := s.Find(server)
+  if err != nil {
+    return false
+  }
+  return relays[len(relays)-1].ID == hostname
+}
@@ -0,0 +1,274 @@
+package mullvad
+
+import (
+  "crypto/ecdh"
+  "crypto/rand"
+  "encoding/base64"
+  "encoding/json"
+  "fmt"
+  "os"
+  "regexp"
+  "slices"
+  "strings"
+  "time"
+)
+
+// keyCheckInterval is how often the key is checked to be registered and
+// rotated if too old.
+const keyCheckInterval = time.Hour
+
+var (
+  privateKeyRE = regexp.MustCompile(`(?m)^PrivateKey[ \t]*=[ \t]*(\S*)[ \t]*$`)
+  addressRE    = regexp.MustCompile(`(?m)^Address[ \t]*=.*$`)
+  interfaceRE  = regexp.MustCompile(`(?m)^\[Interface\][ \t]*$`)
+)
+
+// A managedKey is the WireGuard key of the config as registered on the
+// account, saved next to the config.
+type managedKey struct {
+  Device    string    `json:"device"` // ID on the account
+  Name      string    `json:"name"`
+  PublicKey string    `json:"public_key"`
+  Created   time.Time `json:"created"` // when registered or rotated
+  // Pending is the new private key while rotating, saved before replacing
+  // the key on the account so that it is not lost if the config is not
+  // written afterwards.
+  Pending string `json:"pending,omitempty"`
+}
+
+// Age returns how old the key is.
+func (k *managedKey) Age() time.Duration {
+  return time.Since(k.Created).Truncate(time.Minute)
+}
+
+// generateKey generates a WireGuard keypair, base64 encoded.
+func generateKey() (private, public string, err error) {
+  k, err := ecdh.X25519().GenerateKey(rand.Reader)
+  if err != nil {
+    return "", "", err
+  }
+  return base64.StdEncoding.EncodeToString(k.Bytes()), base64.StdEncoding.EncodeToString(k.PublicKey().Bytes()), nil
+}
+
+// publicKey returns the public key of a base64 encoded private key.
+func publicKey(private string) (string, error) {
+  b, err := base64.StdEncoding.DecodeString(private)
+  if err != nil {
+    return "", err
+  }
+  k, err := ecdh.X25519().NewPrivateKey(b)
+  if err != nil {
+    return "", err
+  }
+  return base64.StdEncoding.EncodeToString(k.PublicKey().Bytes()), nil
+}
+
+// readKey reads the key saved next to the config, nil if none.
+func (s *Server) readKey() (*managedKey, error) {
+  b, err := os.ReadFile(s.keyFile)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  var k managedKey
+  if err := json.Unmarshal(b, &k); err != nil {
+    return nil, fmt.Errorf("%v: %v", s.keyFile, err)
+  }
+  return &k, nil
+}
+
+func (s *Server) writeKey(k *managedKey) error {
+  b, err := json.MarshalIndent(k, "", "  ")
+  if err != nil {
+    return err
+  }
+  return os.WriteFile(s.keyFile, append(b, '\n'), 0600)
+}
+
+// setInterface sets a setting of the [Interface] section: replaces the line
+// matching re, or adds it after the section header.
+func setInterface(b []byte, re *regexp.Regexp, setting string) []byte {
+  if re.Match(b) {
+    return re.ReplaceAllLiteral(b, []byte(setting))
+  }
+  loc := interfaceRE.FindIndex(b)
+  if loc == nil {
+    return slices.Concat([]byte("[Interface]\n"+setting+"\n"), b)
+  }
+  return slices.Concat(b[:loc[1]], []byte("\n"+setting), b[loc[1]:])
+}
+
+// setKey writes the private key and the addresses of the device into the config.
+func (s *Server) setKey(private string, d *accountDevice) error {
+  b, err := os.ReadFile(s.Config())
+  if err != nil {
+    return err
+  }
+  var addresses []string
+  for _, e := range []string{d.IPv4Address, d.IPv6Address} {
+    if e != "" {
+      addresses = append(addresses, e)
+    }
+  }
+  b = setInterface(b, privateKeyRE, "PrivateKey = "+private)
+  b = setInterface(b, addressRE, "Address = "+strings.Join(addresses, ","))
+  return os.WriteFile(s.Config(), b, 0600)
+}
+
+// registerKey makes sure the key of the config is registered on the account,
+// registering it or a new one if the config has none, and writes its
+// addresses into the config. It returns whether the config changed.
+func (s *Server) registerKey() (bool, error) {
+  s.LockConfig()
+  defer s.UnlockConfig()
+  b, err := os.ReadFile(s.Config())
+  if err != nil {
+    return false, err
+  }
+  var private, public string
+  if m := privateKeyRE.FindSubmatch(b); m != nil && len(m[1]) > 0 {
+    private = string(m[1])
+    if public, err = publicKey(private); err != nil {
+      return false, fmt.Errorf("%v: invalid PrivateKey: %v", s.Config(), err)
+    }
+  }
+  k, err := s.readKey()
+  if err != nil {
+    return false, err
+  }
+  if k != nil && public != "" && k.PublicKey == public {
+    return false, nil // already registered
+  }
+
+  var d *accountDevice
+  if public != "" {
+    devices, err := s.account.devices()
+    if err != nil {
+      return false, err
+    }
+    for _, e := range devices {
+      if e.PublicKey == public {
+        d = &e
+        break
+      }
+    }
+  }
+  if d == nil {
+    if private == "" {
+      if private, public, err = generateKey(); err != nil {
+        return false, err
+      }
+    }
+    if d, err = s.account.register(public); err != nil {
+      return false, err
+    }
+  }
+  if err := s.setKey(private, d); err != nil {
+    return false, err
+  }
+  return true, s.writeKey(&managedKey{Device: d.ID, Name: d.Name, PublicKey: public, Created: d.Created})
+}
+
+// rotateKey replaces the key with a new one if older than the rotation
+// interval, or completes a rotation left pending. It returns whether the
+// config changed.
+func (s *Server) rotateKey() (bool, error) {
+  s.LockConfig()
+  defer s.UnlockConfig()
+  k, err := s.readKey()
+  if err != nil || k == nil {
+    return false, err
+  }
+  if k.Pending != "" {
+    return s.resumeRotation(k)
+  }
+  if s.rotation <= 0 || time.Since(k.Created) < s.rotation {
+    return false, nil
+  }
+  private, public, err := generateKey()
+  if err != nil {
+    return false, err
+  }
+  k.Pending = private
+  if err := s.writeKey(k); err != nil {
+    return false, err
+  }
+  d, err := s.account.replaceKey(k.Device, public)
+  if err != nil {
+    // the key may have been replaced before the error, e.g. a timeout
+    if changed, rerr := s.resumeRotation(k); rerr != nil || changed {
+      return changed, rerr
+    }
+    return false, err
+  }
+  return true, s.completeRotation(private, public, d)
+}
+
+// resumeRotation completes a pending rotation if the account has its key,
+// otherwise rolls back to the current key. It returns whether the config
+// changed.
+func (s *Server) resumeRotation(k *managedKey) (bool, error) {
+  public, err := publicKey(k.Pending)
+  if err != nil {
+    return false, fmt.Errorf("%v: invalid pending key: %v", s.keyFile, err)
+  }
+  devices, err := s.account.devices()
+  if err != nil {
+    return false, err
+  }
+  for _, d := range devices {
+    if d.ID == k.Device && d.PublicKey == public {
+      return true, s.completeRotation(k.Pending, public, &d)
+    }
+  }
+  k.Pending = ""
+  return false, s.writeKey(k)
+}
+
+// completeRotation writes the new key into the config, then saves it.
+func (s *Server) completeRotation(private, public string, d *accountDevice) error {
+  if err := s.setKey(private, d); err != nil {
+    return err
+  }
+  return s.writeKey(&managedKey{Device: d.ID, Name: d.Name, PublicKey: public, Created: time.Now()})
+}
+
+// periodicallyManageKey registers and rotates the key, restarting the
+// interface if it is up when the config changes.
+func (s *Server) periodicallyManageKey() {
+  for ; ; time.Sleep(keyCheckInterval) {
+    registered, err := s.registerKey()
+    rotated := false
+    if err == nil {
+      rotated, err = s.rotateKey()
+    }
+    if err == nil && (registered || rotated) {
+      if s.Up() {
+        s.LockConfig()
+        err = s.Restart()
+        s.UnlockConfig()
+      }
+    }
+    s.m.Lock()
+    s.keyError = err
+    s.m.Unlock()
+  }
+}
+
+// key returns the key of the config and the error of the last check, nil
+// if keys are not managed.
+func (s *Server) key() (*managedKey, error) {
+  if s.account == nil {
+    return nil, nil
+  }
+  s.m.Lock()
+  keyError := s.keyError
+  s.m.Unlock()
+  k, err := s.readKey()
+  if err != nil {
+    return nil, err
+  }
+  return k, keyError
+}
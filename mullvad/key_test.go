@@ -0,0 +1,340 @@
+package mullvad
+
+import (
+  "encoding/base64"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/StalkR/switchman/catalog"
+)
+
+// fakeAccountAPI is a fake of the Mullvad account API for one account.
+type fakeAccountAPI struct {
+  number string
+
+  m       sync.Mutex
+  devices []accountDevice
+  next    int // address of the next key
+  // failReplace fails replacing keys, after replacing them with
+  // failAfterReplace, like a lost response.
+  failReplace, failAfterReplace bool
+}
+
+func (f *fakeAccountAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  f.m.Lock()
+  defer f.m.Unlock()
+  if r.URL.Path == "/auth/v1/token" {
+    var req struct {
+      AccountNumber string `json:"account_number"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AccountNumber != f.number {
+      w.WriteHeader(http.StatusBadRequest)
+      fmt.Fprint(w, `{"code": "INVALID_ACCOUNT", "detail": "invalid account"}`)
+      return
+    }
+    fmt.Fprint(w, `{"access_token": "token", "expiry": "2030-01-01T00:00:00Z"}`)
+    return
+  }
+  if r.Header.Get("Authorization") != "Bearer token" {
+    http.Error(w, "unauthorized", http.StatusUnauthorized)
+    return
+  }
+  var req struct {
+    PublicKey string `json:"pubkey"`
+  }
+  switch {
+  case r.Method == "GET" && r.URL.Path == "/accounts/v1/devices":
+    json.NewEncoder(w).Encode(f.devices)
+  case r.Method == "POST" && r.URL.Path == "/accounts/v1/devices":
+    json.NewDecoder(r.Body).Decode(&req)
+    f.devices = append(f.devices, f.device(fmt.Sprintf("id%d", len(f.devices)), req.PublicKey))
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(f.devices[len(f.devices)-1])
+  case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/pubkey"):
+    json.NewDecoder(r.Body).Decode(&req)
+    id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/v1/devices/"), "/pubkey")
+    if f.failReplace && !f.failAfterReplace {
+      http.Error(w, "internal error", http.StatusInternalServerError)
+      return
+    }
+    for i, d := range f.devices {
+      if d.ID == id {
+        f.devices[i] = f.device(id, req.PublicKey)
+        f.devices[i].Created = d.Created
+        if f.failReplace {
+          http.Error(w, "internal error", http.StatusInternalServerError)
+          return
+        }
+        json.NewEncoder(w).Encode(f.devices[i])
+        return
+      }
+    }
+    w.WriteHeader(http.StatusNotFound)
+    fmt.Fprint(w, `{"code": "DEVICE_NOT_FOUND", "detail": "not found"}`)
+  default:
+    http.NotFound(w, r)
+  }
+}
+
+func (f *fakeAccountAPI) device(id, publicKey string) accountDevice {
+  f.next++
+  return accountDevice{
+    ID:          id,
+    Name:        "happy " + id,
+    PublicKey:   publicKey,
+    Created:     time.Now().UTC().Truncate(time.Second),
+    IPv4Address: fmt.Sprintf("10.64.0.%d/32", f.next),
+    IPv6Address: fmt.Sprintf("fc00:bbbb:bbbb:bb01::%x/128", f.next),
+  }
+}
+
+const testConfig = `[Interface]
+DNS = 10.64.0.1
+
+[Peer]
+PublicKey = relaykey
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = se-got-wg-001.relays.mullvad.net:51820
+`
+
+func newTestServer(t *testing.T, config string) (*Server, *fakeAccountAPI) {
+  dir := t.TempDir()
+  s := &Server{
+    Server:  catalog.New(filepath.Join(dir, "wg0.conf"), defaultDevice, provider{}),
+    keyFile: filepath.Join(dir, "wg0.mullvad.json"),
+  }
+  if err := os.WriteFile(s.Config(), []byte(config), 0600); err != nil {
+    t.Fatal(err)
+  }
+  api := &fakeAccountAPI{number: "1234123412341234"}
+  ts := httptest.NewServer(api)
+  t.Cleanup(ts.Close)
+  WithAccount("1234 1234 1234 1234")(s)
+  s.account.url = ts.URL
+  return s, api
+}
+
+func TestPublicKey(t *testing.T) {
+  // RFC 7748 section 6.1
+  private, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+  public, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+  got, err := publicKey(base64.StdEncoding.EncodeToString(private))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := base64.StdEncoding.EncodeToString(public); got != want {
+    t.Errorf("publicKey() = %v; want %v", got, want)
+  }
+
+  private2, public2, err := generateKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got, err := publicKey(private2); err != nil || got != public2 {
+    t.Errorf("publicKey(generated) = %v, %v; want %v", got, err, public2)
+  }
+}
+
+func TestRegisterKeyGenerates(t *testing.T) {
+  s, api := newTestServer(t, testConfig)
+  changed, err := s.registerKey()
+  if err != nil || !changed {
+    t.Fatalf("registerKey() = %v, %v; want true, nil", changed, err)
+  }
+  b, err := os.ReadFile(s.Config())
+  if err != nil {
+    t.Fatal(err)
+  }
+  m := privateKeyRE.FindSubmatch(b)
+  if m == nil {
+    t.Fatalf("no PrivateKey in config:\n%s", b)
+  }
+  public, err := publicKey(string(m[1]))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(api.devices) != 1 || api.devices[0].PublicKey != public {
+    t.Errorf("devices = %+v; want key %v registered", api.devices, public)
+  }
+  want := "[Interface]\nAddress = 10.64.0.1/32,fc00:bbbb:bbbb:bb01::1/128\nPrivateKey = " + string(m[1]) + "\nDNS = 10.64.0.1\n"
+  if !strings.HasPrefix(string(b), want) || !strings.Contains(string(b), "Endpoint = se-got-wg-001") {
+    t.Errorf("config =\n%s\nwant prefix\n%s", b, want)
+  }
+  k, err := s.readKey()
+  if err != nil || k == nil || k.Device != "id0" || k.PublicKey != public {
+    t.Errorf("readKey() = %+v, %v; want device id0 with key %v", k, err, public)
+  }
+
+  // already registered
+  if changed, err := s.registerKey(); err != nil || changed {
+    t.Errorf("registerKey() again = %v, %v; want false, nil", changed, err)
+  }
+  if len(api.devices) != 1 {
+    t.Errorf("%d devices; want 1", len(api.devices))
+  }
+}
+
+func TestRegisterKeyExisting(t *testing.T) {
+  private, public, err := generateKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  config := strings.Replace(testConfig, "[Interface]\n", "[Interface]\nPrivateKey = "+private+"\nAddress = 10.99.0.1/32\n", 1)
+
+  // registered on the account, e.g. by hand: adopted
+  s, api := newTestServer(t, config)
+  created := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+  api.devices = []accountDevice{{ID: "old", Name: "old otter", PublicKey: public, Created: created, IPv4Address: "10.64.1.1/32"}}
+  if changed, err := s.registerKey(); err != nil || !changed {
+    t.Fatalf("registerKey() = %v, %v; want true, nil", changed, err)
+  }
+  b, _ := os.ReadFile(s.Config())
+  if !strings.Contains(string(b), "PrivateKey = "+private+"\nAddress = 10.64.1.1/32\n") {
+    t.Errorf("config =\n%s\nwant same key and account address", b)
+  }
+  if k, err := s.readKey(); err != nil || k.Device != "old" || !k.Created.Equal(created) {
+    t.Errorf("readKey() = %+v, %v; want device old created %v", k, err, created)
+  }
+
+  // not registered: registers it
+  s, api = newTestServer(t, config)
+  if changed, err := s.registerKey(); err != nil || !changed {
+    t.Fatalf("registerKey() = %v, %v; want true, nil", changed, err)
+  }
+  if len(api.devices) != 1 || api.devices[0].PublicKey != public {
+    t.Errorf("devices = %+v; want key %v registered", api.devices, public)
+  }
+}
+
+func TestRegisterKeyInvalidAccount(t *testing.T) {
+  s, _ := newTestServer(t, testConfig)
+  s.account.number = "0"
+  if _, err := s.registerKey(); err == nil || !strings.Contains(err.Error(), "INVALID_ACCOUNT") {
+    t.Errorf("registerKey() = %v; want INVALID_ACCOUNT", err)
+  }
+}
+
+func TestRotateKey(t *testing.T) {
+  s, api := newTestServer(t, testConfig)
+  s.rotation = 24 * time.Hour
+  if _, err := s.registerKey(); err != nil {
+    t.Fatal(err)
+  }
+  if rotated, err := s.rotateKey(); err != nil || rotated {
+    t.Fatalf("rotateKey() of new key = %v, %v; want false, nil", rotated, err)
+  }
+
+  k, err := s.readKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  k.Created = time.Now().Add(-25 * time.Hour)
+  if err := s.writeKey(k); err != nil {
+    t.Fatal(err)
+  }
+  if rotated, err := s.rotateKey(); err != nil || !rotated {
+    t.Fatalf("rotateKey() of old key = %v, %v; want true, nil", rotated, err)
+  }
+  rotated, err := s.readKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if rotated.Device != k.Device || rotated.PublicKey == k.PublicKey || rotated.Age() > time.Minute {
+    t.Errorf("rotated key = %+v; want new key for device %v", rotated, k.Device)
+  }
+  if len(api.devices) != 1 || api.devices[0].PublicKey != rotated.PublicKey {
+    t.Errorf("devices = %+v; want rotated key %v", api.devices, rotated.PublicKey)
+  }
+  b, _ := os.ReadFile(s.Config())
+  if !strings.Contains(string(b), "Address = 10.64.0.2/32,fc00:bbbb:bbbb:bb01::2/128\n") || strings.Count(string(b), "PrivateKey") != 1 {
+    t.Errorf("config =\n%s\nwant one key and new addresses", b)
+  }
+
+  // never rotate
+  s.rotation = 0
+  rotated.Created = time.Now().Add(-365 * 24 * time.Hour)
+  if err := s.writeKey(rotated); err != nil {
+    t.Fatal(err)
+  }
+  if changed, err := s.rotateKey(); err != nil || changed {
+    t.Errorf("rotateKey() without rotation = %v, %v; want false, nil", changed, err)
+  }
+}
+
+func TestRotateKeyFailure(t *testing.T) {
+  for _, after := range []bool{false, true} {
+    s, api := newTestServer(t, testConfig)
+    s.rotation = 24 * time.Hour
+    if _, err := s.registerKey(); err != nil {
+      t.Fatal(err)
+    }
+    k, err := s.readKey()
+    if err != nil {
+      t.Fatal(err)
+    }
+    k.Created = time.Now().Add(-25 * time.Hour)
+    if err := s.writeKey(k); err != nil {
+      t.Fatal(err)
+    }
+    before, _ := os.ReadFile(s.Config())
+    api.failReplace, api.failAfterReplace = true, after
+
+    rotated, err := s.rotateKey()
+    got, _ := s.readKey()
+    config, _ := os.ReadFile(s.Config())
+    if after {
+      // the account has the new key: it is used
+      if err != nil || !rotated || got.Pending != "" || got.PublicKey != api.devices[0].PublicKey || string(config) == string(before) {
+        t.Errorf("rotateKey() replaced then failing = %v, %v, key %+v; want new key used", rotated, err, got)
+      }
+      continue
+    }
+    // rolled back to the current key
+    if err == nil || rotated || got.Pending != "" || got.PublicKey != k.PublicKey || string(config) != string(before) {
+      t.Errorf("rotateKey() failing = %v, %v, key %+v; want error, current key kept", rotated, err, got)
+    }
+  }
+}
+
+func TestRotateKeyResume(t *testing.T) {
+  s, api := newTestServer(t, testConfig)
+  if _, err := s.registerKey(); err != nil {
+    t.Fatal(err)
+  }
+  k, err := s.readKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  // interrupted after replacing the key on the account
+  private, public, err := generateKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  api.devices[0].PublicKey = public
+  k.Pending = private
+  if err := s.writeKey(k); err != nil {
+    t.Fatal(err)
+  }
+  if rotated, err := s.rotateKey(); err != nil || !rotated {
+    t.Fatalf("rotateKey() pending = %v, %v; want true, nil", rotated, err)
+  }
+  got, err := s.readKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got.PublicKey != public || got.Pending != "" {
+    t.Errorf("key = %+v; want pending key %v used", got, public)
+  }
+  if b, _ := os.ReadFile(s.Config()); !strings.Contains(string(b), "PrivateKey = "+private+"\n") {
+    t.Errorf("config =\n%s\nwant pending private key", b)
+  }
+}
@@ -2,20 +2,36 @@ package mullvad
 
 import (
   "fmt"
+  "html/template"
+  "io"
   "os"
   "strings"
   "sync"
   "time"
+
+  "github.com/StalkR/switchman/catalog"
 )
 
+// defaultDevice is the device switched unless WithDevice.
+const defaultDevice = "wg0"
+
 // New creates a new Server to switch a mullvad WireGuard server.
-func New() (*Server, error) {
-  const config = "/etc/wireguard/wg0.conf"
-  if _, err := os.Stat(config); err != nil {
-    return nil, err
+func New(options ...Option) (*Server, error) {
+  s := &Server{device: defaultDevice}
+  for _, option := range options {
+    option(s)
   }
-  s := &Server{
-    config: config,
+  config := "/etc/wireguard/" + s.device + ".conf"
+  s.Server = catalog.New(config, s.device, provider{})
+  s.keyFile = strings.TrimSuffix(config, ".conf") + ".mullvad.json"
+  created := false
+  if _, err := os.Stat(s.Config()); os.IsNotExist(err) && s.account != nil {
+    if err := s.createConfig(); err != nil {
+      return nil, err
+    }
+    created = true
+  } else if err != nil {
+    return nil, err
   }
   current, err := s.Current()
   if err != nil {
@@ -25,35 +41,112 @@ func New() (*Server, error) {
   if len(fields) != 2 || !strings.HasSuffix(fields[0], relaySuffix) {
     return nil, fmt.Errorf("not mullvad")
   }
-  go s.periodicallyFetchEndpoints()
+  if created {
+    // the config needs a key before the interface can be brought up
+    if _, err := s.registerKey(); err != nil {
+      return nil, err
+    }
+    if err := s.Restart(); err != nil {
+      return nil, err
+    }
+  }
+  go s.FetchPeriodically()
+  if s.account != nil {
+    go s.periodicallyManageKey()
+  }
   return s, nil
 }
 
-// A Server implements the ability to switch a mullvad WireGuard server.
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithAccount manages the WireGuard key of the config with the Mullvad
+// account number: registers the key of the config, or generates one, with
+// the account API and writes the assigned tunnel addresses into the config,
+// which is created with the first active relay if missing.
+func WithAccount(number string) Option {
+  return func(s *Server) {
+    s.account = newAccount(number)
+  }
+}
+
+// WithDevice switches the tunnel of device, with its config in
+// /etc/wireguard, instead of wg0.
+func WithDevice(device string) Option {
+  return func(s *Server) {
+    s.device = device
+  }
+}
+
+// WithKeyRotation replaces the managed key with a new one when older than
+// rotation, 0 to never rotate.
+func WithKeyRotation(rotation time.Duration) Option {
+  return func(s *Server) {
+    s.rotation = rotation
+  }
+}
+
+// A Server implements the ability to switch a mullvad WireGuard server,
+// with the relay catalog of the API.
 // It implements the Switchable and Indexable interfaces.
 type Server struct {
-  config string
+  *catalog.Server
+  device   string        // of the tunnel, set by options before the catalog
+  keyFile  string        // key registered on the account, if managed
+  account  *account      // optional, to manage the key
+  rotation time.Duration // of the managed key, 0 to never rotate
 
-  m      sync.Mutex // protects below
-  relays []relay
-  error  error
+  m        sync.Mutex // protects below
+  keyError error      // of the last key check
 }
 
-func (s *Server) periodicallyFetchEndpoints() {
-  for ; ; time.Sleep(24 * time.Hour) {
-    relays, err := s.fetchRelays()
-    s.m.Lock()
-    // if error, keep previous, it's stale but better than nothing
-    if err == nil {
-      s.relays = relays
+// createConfig creates the config with the first active relay, without key.
+func (s *Server) createConfig() error {
+  relays, err := provider{}.Fetch()
+  if err != nil {
+    return err
+  }
+  for _, r := range relays {
+    if !r.Active {
+      continue
     }
-    s.error = err
-    s.m.Unlock()
+    s.SetRelays(relays)
+    peer := provider{}.Peer([]catalog.Relay{r})
+    config := fmt.Sprintf(`[Interface]
+DNS = 10.64.0.1
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = %s
+`, peer.PublicKey, peer.Endpoint)
+    return os.WriteFile(s.Config(), []byte(config), 0600)
   }
+  return fmt.Errorf("no active relay to create %v", s.Config())
 }
 
-func (s *Server) listRelays() ([]relay, error) {
-  s.m.Lock()
-  defer s.m.Unlock()
-  return s.relays, s.error
+var keyTmpl = template.Must(template.New("").Parse(`{{with .Key}}
+<p>Key {{.PublicKey}} (device {{.Name}}), {{.Age}} old{{if $.Rotation}}, rotated every {{$.Rotation}}{{end}}</p>
+{{end}}
+{{if .KeyError}}
+<p style="color: red;">Error managing key: {{.KeyError}}</p>
+{{end}}
+`))
+
+// Index writes the body of an HTML index page to switch the Server: the
+// managed key, then the relay catalog.
+func (s *Server) Index(w io.Writer) error {
+  key, keyError := s.key()
+  if err := keyTmpl.Execute(w, struct {
+    Key      *managedKey
+    KeyError error
+    Rotation time.Duration
+  }{
+    Key:      key,
+    KeyError: keyError,
+    Rotation: s.rotation,
+  }); err != nil {
+    return err
+  }
+  return s.Server.Index(w)
 }
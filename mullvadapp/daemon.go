@@ -0,0 +1,476 @@
+package mullvadapp
+
+import (
+  "context"
+  "fmt"
+  "slices"
+  "strings"
+  "sync"
+  "time"
+)
+
+// DaemonSocket is the Unix socket of the daemon's management interface.
+const DaemonSocket = "/var/run/mullvad-vpn"
+
+// How long to wait before listening to daemon events again after an error.
+var listenRetryInterval = 5 * time.Second
+
+// relayTypes are the names of Relay endpoint types, as features.
+var relayTypes = []string{"OpenVPN", "Bridge", "WireGuard"}
+
+// tunnelTypes are the names of the values of the TunnelType enum.
+var tunnelTypes = []string{"OpenVPN", "WireGuard"}
+
+// ownerships are the values of the Ownership enum.
+var ownerships = []string{"any", "owned", "rented"}
+
+// errorCauses are the descriptions of the ErrorState Cause enum, in the
+// order of its values, transcribed like the field numbers.
+var errorCauses = []string{
+  "Authentication failed",
+  "IPv6 unavailable",
+  "Failed to set firewall policy",
+  "Failed to set DNS",
+  "Failed to start tunnel",
+  "Invalid tunnel parameters",
+  "Offline",
+  "Split tunneling error",
+}
+
+// daemonSettings are the settings that can be changed via the daemon;
+// others require the cli.
+var daemonSettings = []string{"providers", "ownership"}
+
+// NewDaemon creates a new Daemon to switch mullvad via the daemon's gRPC
+// management interface on its Unix socket.
+func NewDaemon(socket string) (*Daemon, error) {
+  d := &Daemon{
+    grpc:    newGRPCClient(socket),
+    changed: make(chan struct{}, 1),
+  }
+  if _, err := d.version(); err != nil {
+    return nil, fmt.Errorf("mullvad daemon: %v", err)
+  }
+  go d.listen()
+  return d, nil
+}
+
+// A Daemon implements the ability to switch mullvad via the daemon's gRPC
+// management interface, without spawning the cli.
+// It implements the Switchable and Indexable interfaces.
+type Daemon struct {
+  grpc    *grpcClient
+  changed chan struct{}
+
+  m           sync.Mutex
+  state       *State // from events, nil when not listening
+  eventsError error
+}
+
+// Device returns the network device of the tunnel, from the tunnel type of
+// the relay settings.
+func (d *Daemon) Device() (string, error) {
+  _, normal, err := d.settings()
+  if err != nil {
+    return "", err
+  }
+  protocol := "any"
+  if normal.has(normalRelaySettingsTunnelType) {
+    protocol = fmt.Sprint(normal.uint(normalRelaySettingsTunnelType))
+    if t := normal.uint(normalRelaySettingsTunnelType); t < uint64(len(tunnelTypes)) {
+      protocol = tunnelTypes[t]
+    }
+  }
+  return deviceOf(protocol)
+}
+
+// VerifyExit returns whether the exit hostname reported by am.i.mullvad.net
+// is in the location: the relay itself, or a relay of the country or city.
+func (d *Daemon) VerifyExit(location, hostname string) bool {
+  return hostname != "" && inLocation(hostname, location)
+}
+
+// Changed returns a channel receiving when the tunnel state changes.
+func (d *Daemon) Changed() <-chan struct{} {
+  return d.changed
+}
+
+// listen keeps the tunnel state up to date from daemon events.
+func (d *Daemon) listen() {
+  for {
+    err := d.grpc.stream(context.Background(), "EventsListen", nil, func(event message) error {
+      if !event.has(daemonEventTunnelState) {
+        return nil
+      }
+      ts, err := event.message(daemonEventTunnelState)
+      if err != nil {
+        return err
+      }
+      state, err := parseTunnelState(ts)
+      if err != nil {
+        return err
+      }
+      d.setState(state, nil)
+      return nil
+    })
+    if err == nil {
+      err = fmt.Errorf("events stream ended")
+    }
+    d.setState(nil, err)
+    time.Sleep(listenRetryInterval)
+  }
+}
+
+func (d *Daemon) setState(state *State, err error) {
+  d.m.Lock()
+  d.state, d.eventsError = state, err
+  d.m.Unlock()
+  if state == nil {
+    return
+  }
+  select {
+  case d.changed <- struct{}{}:
+  default:
+  }
+}
+
+// Status returns the connection state of the daemon, as last received from
+// events or else asked.
+func (d *Daemon) Status() (*State, error) {
+  d.m.Lock()
+  state := d.state
+  d.m.Unlock()
+  if state != nil {
+    return state, nil
+  }
+  ts, err := d.grpc.call("GetTunnelState", nil)
+  if err != nil {
+    return nil, err
+  }
+  return parseTunnelState(ts)
+}
+
+// parseTunnelState parses a TunnelState message.
+func parseTunnelState(ts message) (*State, error) {
+  s := &State{}
+  var num int
+  for _, e := range []struct {
+    name string
+    num  int
+  }{
+    {"disconnected", tunnelStateDisconnected},
+    {"connecting", tunnelStateConnecting},
+    {"connected", tunnelStateConnected},
+    {"disconnecting", tunnelStateDisconnecting},
+    {"error", tunnelStateError},
+  } {
+    if ts.has(e.num) {
+      s.State, num = e.name, e.num
+    }
+  }
+  if s.State == "" {
+    return nil, fmt.Errorf("unknown tunnel state")
+  }
+  inner, err := ts.message(num)
+  if err != nil {
+    return nil, err
+  }
+  switch s.State {
+  case "connecting", "connected":
+    info, err := inner.message(tunnelStateRelayInfo)
+    if err != nil {
+      return nil, err
+    }
+    location, err := info.message(relayInfoLocation)
+    if err != nil {
+      return nil, err
+    }
+    s.Relay = location.string(geoIPLocationHostname)
+    s.Location = location.string(geoIPLocationCountry)
+    if city := location.string(geoIPLocationCity); city != "" {
+      s.Location = city + ", " + s.Location
+    }
+  case "error":
+    es, err := inner.message(tunnelStateErrorState)
+    if err != nil {
+      return nil, err
+    }
+    s.Error = fmt.Sprintf("cause %d", es.uint(errorStateCause))
+    if c := es.uint(errorStateCause); c < uint64(len(errorCauses)) {
+      s.Error = errorCauses[c]
+    }
+  }
+  return s, nil
+}
+
+// Connect connects the tunnel and waits until connected.
+func (d *Daemon) Connect() error {
+  return d.control("ConnectTunnel")
+}
+
+// Disconnect disconnects the tunnel.
+func (d *Daemon) Disconnect() error {
+  _, err := d.grpc.call("DisconnectTunnel", nil)
+  return err
+}
+
+// Reconnect reconnects the tunnel, to a new relay of the location, and waits
+// until connected.
+func (d *Daemon) Reconnect() error {
+  return d.control("ReconnectTunnel")
+}
+
+func (d *Daemon) control(method string) error {
+  if _, err := d.grpc.call(method, nil); err != nil {
+    return err
+  }
+  location, err := d.Current()
+  if err != nil {
+    return err
+  }
+  return waitConnected(d.Status, location)
+}
+
+func (d *Daemon) version() (string, error) {
+  v, err := d.grpc.call("GetCurrentVersion", nil)
+  if err != nil {
+    return "", err
+  }
+  return v.string(wrapperValue), nil
+}
+
+// settings returns the Settings message, and its normal relay settings.
+func (d *Daemon) settings() (message, message, error) {
+  settings, err := d.grpc.call("GetSettings", nil)
+  if err != nil {
+    return nil, nil, err
+  }
+  normal, err := normalRelaySettings(settings)
+  if err != nil {
+    return nil, nil, err
+  }
+  return settings, normal, nil
+}
+
+// normalRelaySettings returns the normal relay settings of Settings.
+func normalRelaySettings(settings message) (message, error) {
+  rs, err := settings.message(settingsRelaySettings)
+  if err != nil {
+    return nil, err
+  }
+  if !rs.has(relaySettingsNormal) {
+    return nil, fmt.Errorf("custom relay settings not supported")
+  }
+  return rs.message(relaySettingsNormal)
+}
+
+// updateRelaySettings changes the normal relay settings, keeping the others.
+func (d *Daemon) updateRelaySettings(update func(normal message) message) error {
+  _, normal, err := d.settings()
+  if err != nil {
+    return err
+  }
+  _, err = d.grpc.call("SetRelaySettings", message{}.withMessage(relaySettingsNormal, update(normal)))
+  return err
+}
+
+// Current returns the current relay.
+// It can be a country location, or a country and city location, or the relay hostname.
+func (d *Daemon) Current() (string, error) {
+  _, normal, err := d.settings()
+  if err != nil {
+    return "", err
+  }
+  return relayLocation(normal)
+}
+
+// relayLocation returns the location of normal relay settings, as listed.
+func relayLocation(normal message) (string, error) {
+  if !normal.has(normalRelaySettingsLocation) {
+    return "any", nil
+  }
+  constraint, err := normal.message(normalRelaySettingsLocation)
+  if err != nil {
+    return "", err
+  }
+  if constraint.has(locationConstraintCustomList) {
+    return "", fmt.Errorf("custom list location %q not supported", constraint.string(locationConstraintCustomList))
+  }
+  geo, err := constraint.message(locationConstraintLocation)
+  if err != nil {
+    return "", err
+  }
+  country, city, hostname := geo.string(geoConstraintCountry), geo.string(geoConstraintCity), geo.string(geoConstraintHostname)
+  switch {
+  case hostname != "":
+    return hostname, nil
+  case city != "":
+    return fmt.Sprintf("%s %s", country, city), nil
+  case country != "":
+    return country, nil
+  }
+  return "any", nil
+}
+
+// Switch switches to the specified location, as with the cli: country,
+// country and city, or hostname.
+// It waits until the daemon reports connected to the location.
+func (d *Daemon) Switch(location string) error {
+  var geo message
+  switch args := strings.Split(location, " "); {
+  case len(args) == 1 && hostnameRE.FindString(args[0]) == args[0]:
+    parts := strings.Split(args[0], "-")
+    geo = geo.withString(geoConstraintCountry, parts[0]).withString(geoConstraintCity, parts[1]).withString(geoConstraintHostname, args[0])
+  case len(args) == 1:
+    geo = geo.withString(geoConstraintCountry, args[0])
+  case len(args) == 2:
+    geo = geo.withString(geoConstraintCountry, args[0]).withString(geoConstraintCity, args[1])
+  default:
+    return fmt.Errorf("invalid location")
+  }
+  if err := d.updateRelaySettings(func(normal message) message {
+    location := message{}.withMessage(locationConstraintLocation, geo)
+    return normal.without(normalRelaySettingsLocation).withMessage(normalRelaySettingsLocation, location)
+  }); err != nil {
+    return fmt.Errorf("could not set location to %v: %v", location, err)
+  }
+  // connected: reconnects by itself; disconnected: needs to connect
+  return d.Connect()
+}
+
+// Set changes a setting of the app: providers or ownership.
+func (d *Daemon) Set(name, value string) error {
+  if _, err := findSetting(name, value); err != nil {
+    return err
+  }
+  if !slices.Contains(daemonSettings, name) {
+    return fmt.Errorf("setting %v not supported via the daemon, use the cli", name)
+  }
+  err := d.updateRelaySettings(func(normal message) message {
+    switch name {
+    case "providers":
+      normal = normal.without(normalRelaySettingsProviders)
+      if value != "any" {
+        for _, p := range strings.Fields(value) {
+          normal = normal.withString(normalRelaySettingsProviders, p)
+        }
+      }
+    case "ownership":
+      o := uint64(slices.Index(ownerships, value))
+      normal = normal.without(normalRelaySettingsOwnership).withUint(normalRelaySettingsOwnership, o)
+    }
+    return normal
+  })
+  if err != nil {
+    return fmt.Errorf("could not set %v to %v: %v", name, value, err)
+  }
+  return nil
+}
+
+// currentSettings returns the settings shown in the index.
+func (d *Daemon) currentSettings() ([]keyValue, error) {
+  settings, normal, err := d.settings()
+  if err != nil {
+    return nil, err
+  }
+  location, err := relayLocation(normal)
+  if err != nil {
+    location = err.Error()
+  }
+  providers := "any"
+  if p := normal.strings(normalRelaySettingsProviders); len(p) > 0 {
+    providers = strings.Join(p, ", ")
+  }
+  ownership := fmt.Sprint(normal.uint(normalRelaySettingsOwnership))
+  if o := normal.uint(normalRelaySettingsOwnership); o < uint64(len(ownerships)) {
+    ownership = ownerships[o]
+  }
+  onOff := func(v bool) string {
+    if v {
+      return "on"
+    }
+    return "off"
+  }
+  return []keyValue{
+    {"Relay constraints", "Location", location},
+    {"Relay constraints", "Providers", providers},
+    {"Relay constraints", "Ownership", ownership},
+    {"", "Allow LAN", onOff(settings.bool(settingsAllowLAN))},
+    {"", "Lockdown mode", onOff(settings.bool(settingsLockdownMode))},
+    {"", "Auto-connect", onOff(settings.bool(settingsAutoConnect))},
+  }, nil
+}
+
+// List lists available relay locations.
+func (d *Daemon) List() ([]string, error) {
+  relays, err := d.listRelays()
+  if err != nil {
+    return nil, err
+  }
+  var servers []string
+  for _, relay := range relays {
+    servers = append(servers, relay.Location())
+  }
+  return servers, nil
+}
+
+func (d *Daemon) listRelays() ([]*relay, error) {
+  list, err := d.grpc.call("GetRelayLocations", nil)
+  if err != nil {
+    return nil, err
+  }
+  hostnames, err := parseRelayLocations(list)
+  if err != nil {
+    return nil, err
+  }
+  return locations(hostnames), nil
+}
+
+// parseRelayLocations parses a RelayList message into active relays by
+// hostname, skipping bridges.
+func parseRelayLocations(list message) ([]*relay, error) {
+  var relays []*relay
+  countries, err := list.messages(relayListCountries)
+  if err != nil {
+    return nil, err
+  }
+  for _, country := range countries {
+    cities, err := country.messages(relayListCountryCities)
+    if err != nil {
+      return nil, err
+    }
+    for _, city := range cities {
+      hostnames, err := city.messages(relayListCityRelays)
+      if err != nil {
+        return nil, err
+      }
+      for _, h := range hostnames {
+        if !h.bool(relayActive) {
+          continue
+        }
+        r := &relay{
+          Country:     country.string(relayListCountryCode),
+          CountryName: country.string(relayListCountryName),
+          City:        city.string(relayListCityCode),
+          CityName:    city.string(relayListCityName),
+          Hostname:    h.string(relayHostname),
+          IPv4:        h.string(relayIPv4AddrIn),
+          IPv6:        h.string(relayIPv6AddrIn),
+          HostedBy:    h.string(relayProvider),
+          Ownership:   "rented",
+        }
+        if h.bool(relayOwned) {
+          r.Ownership = "owned"
+        }
+        if t := h.uint(relayEndpointType); t < uint64(len(relayTypes)) {
+          r.Features = []string{relayTypes[t]}
+        }
+        if r.Bridge() {
+          continue
+        }
+        relays = append(relays, r)
+      }
+    }
+  }
+  return relays, nil
+}
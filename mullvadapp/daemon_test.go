@@ -0,0 +1,310 @@
+package mullvadapp
+
+import (
+  "bytes"
+  "encoding/binary"
+  "net"
+  "net/http"
+  "net/url"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+)
+
+// fakeDaemon is a fake of the daemon's gRPC management interface.
+type fakeDaemon struct {
+  events chan message // DaemonEvent
+
+  m        sync.Mutex
+  settings message // Settings
+  state    message // TunnelState
+  fail     map[string]string
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  method := strings.TrimPrefix(r.URL.Path, grpcService)
+  req, err := readFrame(r.Body)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  w.Header().Set("Content-Type", "application/grpc")
+  if method == "EventsListen" {
+    w.WriteHeader(http.StatusOK)
+    http.NewResponseController(w).Flush()
+    for {
+      select {
+      case <-r.Context().Done():
+        return
+      case e := <-f.events:
+        writeFrame(w, e)
+        http.NewResponseController(w).Flush()
+      }
+    }
+  }
+  f.m.Lock()
+  resp, errMsg := f.answer(method, req)
+  f.m.Unlock()
+  if errMsg != "" {
+    w.Header().Set("Grpc-Status", "13")
+    w.Header().Set("Grpc-Message", url.PathEscape(errMsg))
+    w.WriteHeader(http.StatusOK)
+    return
+  }
+  w.Header().Set("Trailer", "Grpc-Status")
+  writeFrame(w, resp)
+  w.Header().Set("Grpc-Status", "0")
+}
+
+func (f *fakeDaemon) answer(method string, req message) (message, string) {
+  if msg, ok := f.fail[method]; ok {
+    return nil, msg
+  }
+  switch method {
+  case "GetCurrentVersion":
+    return message{}.withString(wrapperValue, "2024.8"), ""
+  case "GetTunnelState":
+    return f.state, ""
+  case "GetSettings":
+    return f.settings, ""
+  case "GetRelayLocations":
+    return testRelayList(), ""
+  case "SetRelaySettings":
+    f.settings = f.settings.without(settingsRelaySettings).withMessage(settingsRelaySettings, req)
+    return nil, ""
+  case "ConnectTunnel", "ReconnectTunnel":
+    normal, _ := normalRelaySettings(f.settings)
+    location, _ := relayLocation(normal)
+    hostname := location
+    if !strings.Contains(location, "-") {
+      hostname = strings.ReplaceAll(location, " ", "-") + "-wg-001"
+    }
+    geo := message{}.withString(geoIPLocationCountry, "Somewhere").withString(geoIPLocationHostname, hostname)
+    info := message{}.withMessage(relayInfoLocation, geo)
+    f.setState(message{}.withMessage(tunnelStateConnected, message{}.withMessage(tunnelStateRelayInfo, info)))
+    return message{}.withBool(wrapperValue, true), ""
+  case "DisconnectTunnel":
+    f.setState(message{}.withMessage(tunnelStateDisconnected, nil))
+    return message{}.withBool(wrapperValue, true), ""
+  }
+  return nil, "unimplemented " + method
+}
+
+func (f *fakeDaemon) setState(state message) {
+  f.state = state
+  f.events <- message{}.withMessage(daemonEventTunnelState, state)
+}
+
+func writeFrame(w http.ResponseWriter, m message) {
+  b := m.marshal()
+  w.Write(append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(b))), b...))
+}
+
+func testRelay(hostname string, active, owned bool, typ uint64) message {
+  return message{}.withString(relayHostname, hostname).withString(relayIPv4AddrIn, "10.0.0.1").
+    withBool(relayActive, active).withBool(relayOwned, owned).withString(relayProvider, "31173").
+    withUint(relayEndpointType, typ)
+}
+
+func testRelayList() message {
+  city := func(name, code string) message {
+    return message{}.withString(relayListCityName, name).withString(relayListCityCode, code)
+  }
+  country := func(name, code string, city message) message {
+    return message{}.withString(relayListCountryName, name).withString(relayListCountryCode, code).
+      withMessage(relayListCountryCities, city)
+  }
+  got := city("Gothenburg", "got").
+    withMessage(relayListCityRelays, testRelay("se-got-wg-001", true, true, 2)).
+    withMessage(relayListCityRelays, testRelay("se-got-wg-002", true, false, 2)).
+    withMessage(relayListCityRelays, testRelay("se-got-br-001", true, true, 1)). // bridge
+    withMessage(relayListCityRelays, testRelay("se-got-wg-003", false, true, 2)) // inactive
+  zrh := city("Zurich", "zrh").
+    withMessage(relayListCityRelays, testRelay("ch-zrh-wg-001", true, false, 2))
+  return message{}.
+    withMessage(relayListCountries, country("Switzerland", "ch", zrh)).
+    withMessage(relayListCountries, country("Sweden", "se", got))
+}
+
+// newTestDaemon runs a fake daemon on a Unix socket and connects to it.
+func newTestDaemon(t *testing.T) (*Daemon, *fakeDaemon) {
+  prevTimeout, prevInterval := connectTimeout, connectPollInterval
+  t.Cleanup(func() { connectTimeout, connectPollInterval = prevTimeout, prevInterval })
+  connectTimeout, connectPollInterval = time.Second, time.Millisecond
+
+  se := message{}.withString(geoConstraintCountry, "se").withString(geoConstraintCity, "got")
+  normal := message{}.withMessage(normalRelaySettingsLocation, message{}.withMessage(locationConstraintLocation, se)).
+    withUint(normalRelaySettingsTunnelType, 1) // wireguard
+  relaySettings := message{}.withMessage(relaySettingsNormal, normal)
+  f := &fakeDaemon{
+    events:   make(chan message, 10),
+    settings: message{}.withMessage(settingsRelaySettings, relaySettings).withBool(settingsAllowLAN, true),
+    state:    message{}.withMessage(tunnelStateDisconnected, nil),
+    fail:     map[string]string{},
+  }
+  socket := filepath.Join(t.TempDir(), "mullvad-vpn")
+  l, err := net.Listen("unix", socket)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var protocols http.Protocols
+  protocols.SetUnencryptedHTTP2(true)
+  srv := &http.Server{Handler: f, Protocols: &protocols}
+  go srv.Serve(l)
+  t.Cleanup(func() { srv.Close() })
+
+  d, err := NewDaemon(socket)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return d, f
+}
+
+func TestProtoUnknownFields(t *testing.T) {
+  m := message{}.withString(1, "se").withUint(2, 300).withMessage(3, message{}.withBool(1, true))
+  b := append(m.marshal(), 0x21, 1, 2, 3, 4, 5, 6, 7, 8) // fixed64 field 4
+  got, err := unmarshal(b)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got.string(1) != "se" || got.uint(2) != 300 || !got.has(4) {
+    t.Errorf("unmarshal() = %+v", got)
+  }
+  if inner, err := got.message(3); err != nil || !inner.bool(1) {
+    t.Errorf("message(3) = %+v, %v; want bool 1 true", inner, err)
+  }
+  if !bytes.Equal(got.marshal(), b) {
+    t.Errorf("marshal() = %x; want %x", got.marshal(), b)
+  }
+  if _, err := unmarshal([]byte{0x0a, 5, 'a'}); err == nil {
+    t.Errorf("unmarshal(truncated) = nil; want error")
+  }
+}
+
+func TestDaemonList(t *testing.T) {
+  d, _ := newTestDaemon(t)
+  got, err := d.List()
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := []string{"ch", "ch zrh", "ch-zrh-wg-001", "se", "se got", "se-got-wg-001", "se-got-wg-002"}
+  if !reflect.DeepEqual(got, want) {
+    t.Errorf("List() = %v; want %v", got, want)
+  }
+  relays, err := d.listRelays()
+  if err != nil {
+    t.Fatal(err)
+  }
+  r := relays[len(relays)-1]
+  wantRelay := relay{Country: "se", CountryName: "Sweden", City: "got", CityName: "Gothenburg", Hostname: "se-got-wg-002",
+    IPv4: "10.0.0.1", Features: []string{"WireGuard"}, HostedBy: "31173", Ownership: "rented"}
+  if !reflect.DeepEqual(*r, wantRelay) {
+    t.Errorf("relay = %+v; want %+v", *r, wantRelay)
+  }
+}
+
+func TestDaemonSwitch(t *testing.T) {
+  d, f := newTestDaemon(t)
+  if got, err := d.Current(); err != nil || got != "se got" {
+    t.Errorf("Current() = %v, %v; want se got", got, err)
+  }
+  if err := d.Switch("ch-zrh-wg-001"); err != nil {
+    t.Fatal(err)
+  }
+  if got, err := d.Current(); err != nil || got != "ch-zrh-wg-001" {
+    t.Errorf("Current() = %v, %v; want ch-zrh-wg-001", got, err)
+  }
+  normal, _ := normalRelaySettings(f.settings)
+  if normal.uint(normalRelaySettingsTunnelType) != 1 {
+    t.Errorf("relay settings %+v lost the tunnel type", normal)
+  }
+  want := State{State: "connected", Relay: "ch-zrh-wg-001", Location: "Somewhere"}
+  if state, err := d.Status(); err != nil || *state != want {
+    t.Errorf("Status() = %+v, %v; want %+v", state, err, want)
+  }
+
+  if err := d.Disconnect(); err != nil {
+    t.Fatal(err)
+  }
+  // from the event stream
+  for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+    if state, err := d.Status(); err == nil && state.State == "disconnected" {
+      return
+    }
+  }
+  t.Errorf("Status() not disconnected after Disconnect()")
+}
+
+func TestDaemonDevice(t *testing.T) {
+  d, f := newTestDaemon(t)
+  if got, err := d.Device(); err != nil || got != wireGuardDevice {
+    t.Errorf("Device() = %v, %v; want %v", got, err, wireGuardDevice)
+  }
+  if err := d.updateRelaySettings(func(normal message) message {
+    return normal.without(normalRelaySettingsTunnelType).withUint(normalRelaySettingsTunnelType, 0) // openvpn
+  }); err != nil {
+    t.Fatal(err)
+  }
+  if got, err := d.Device(); err == nil {
+    t.Errorf("Device() with OpenVPN = %v; want error", got)
+  }
+  f.settings = f.settings.without(settingsRelaySettings).withMessage(settingsRelaySettings,
+    message{}.withMessage(relaySettingsNormal, message{})) // any
+  if got, err := d.Device(); err != nil || got != wireGuardDevice {
+    t.Errorf("Device() with any protocol = %v, %v; want %v", got, err, wireGuardDevice)
+  }
+}
+
+func TestDaemonSet(t *testing.T) {
+  d, f := newTestDaemon(t)
+  if err := d.Set("ownership", "owned"); err != nil {
+    t.Fatal(err)
+  }
+  if err := d.Set("providers", "31173 M247"); err != nil {
+    t.Fatal(err)
+  }
+  normal, _ := normalRelaySettings(f.settings)
+  providers := normal.strings(normalRelaySettingsProviders)
+  if normal.uint(normalRelaySettingsOwnership) != 1 || !reflect.DeepEqual(providers, []string{"31173", "M247"}) {
+    t.Errorf("relay settings %+v; want owned by 31173 M247", normal)
+  }
+  if err := d.Set("obfuscation", "off"); err == nil || !strings.Contains(err.Error(), "use the cli") {
+    t.Errorf("Set(obfuscation) = %v; want not supported", err)
+  }
+  if err := d.Set("ownership", "nobody"); err == nil {
+    t.Errorf("Set(ownership, nobody) = nil; want error")
+  }
+
+  current, err := d.currentSettings()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if current[1].Value != "31173, M247" || current[2].Value != "owned" || current[3].Value != "on" {
+    t.Errorf("currentSettings() = %+v", current)
+  }
+}
+
+func TestDaemonErrors(t *testing.T) {
+  d, f := newTestDaemon(t)
+  f.m.Lock()
+  f.fail["ConnectTunnel"] = "account is out of time"
+  f.fail["GetSettings"] = "settings unavailable"
+  f.m.Unlock()
+  if err := d.Connect(); err == nil || !strings.Contains(err.Error(), "account is out of time") {
+    t.Errorf("Connect() = %v; want grpc error", err)
+  }
+  if _, err := d.Current(); err == nil || !strings.Contains(err.Error(), "settings unavailable") {
+    t.Errorf("Current() = %v; want grpc error", err)
+  }
+  var b strings.Builder
+  if err := d.Index(&b); err != nil || !strings.Contains(b.String(), "se-got-wg-001") {
+    t.Errorf("Index() = %v; want relays despite settings error", err)
+  }
+
+  if _, err := NewDaemon(filepath.Join(t.TempDir(), "missing")); err == nil {
+    t.Errorf("NewDaemon(missing socket) = nil; want error")
+  }
+}
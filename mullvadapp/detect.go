@@ -0,0 +1,22 @@
+package mullvadapp
+
+import (
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for the Mullvad app: its cli, daemon socket and tunnel.
+func Detect() *detect.Result {
+  r := detect.New("mullvadapp")
+  if !r.Binary("mullvad") {
+    return r.Score(0, "mullvad binary not found in PATH")
+  }
+  daemon := r.File(DaemonSocket)
+  tunnel := r.Interface(wireGuardDevice)
+  switch {
+  case daemon && tunnel:
+    return r.Score(95, "mullvad cli, daemon running and tunnel up")
+  case daemon:
+    return r.Score(75, "mullvad cli and daemon running, tunnel down")
+  }
+  return r.Score(50, "mullvad cli found but daemon not running")
+}
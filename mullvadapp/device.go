@@ -0,0 +1,21 @@
+package mullvadapp
+
+import (
+  "fmt"
+  "strings"
+)
+
+// wireGuardDevice is the network device of the tunnel created by the app on
+// Linux with WireGuard.
+const wireGuardDevice = "wg0-mullvad"
+
+// deviceOf returns the network device of the tunnel with a tunnel protocol.
+// WireGuard is used unless OpenVPN is required, whose tun device is named by
+// the kernel and not reported by the app.
+func deviceOf(protocol string) (string, error) {
+  switch strings.ToLower(protocol) {
+  case "wireguard", "any":
+    return wireGuardDevice, nil
+  }
+  return "", fmt.Errorf("tunnel protocol %v: the device is only known with WireGuard", protocol)
+}
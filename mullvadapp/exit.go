@@ -0,0 +1,10 @@
+package mullvadapp
+
+// VerifyExit returns whether the exit hostname reported by am.i.mullvad.net
+// is in the location: the relay itself, or a relay of the country or city.
+func (s *Server) VerifyExit(location, hostname string) bool {
+  if hostname == "" {
+    return false
+  }
+  return inLocation(hostname, location)
+}
@@ -0,0 +1,81 @@
+package mullvadapp
+
+// Field numbers of the messages of the management interface used, named after
+// their message and field. They are transcribed by hand from
+// mullvad-management-interface/proto/management_interface.proto of the
+// mullvadvpn-app 2024.8 release and not checked against it: a mismatch shows
+// as missing or wrong values, not as an error.
+const (
+  // DaemonEvent
+  daemonEventTunnelState = 1
+
+  // TunnelState, oneof state
+  tunnelStateDisconnected  = 1
+  tunnelStateConnecting    = 2
+  tunnelStateConnected     = 3
+  tunnelStateDisconnecting = 4
+  tunnelStateError         = 5
+  // TunnelState.Connecting and TunnelState.Connected
+  tunnelStateRelayInfo = 1
+  // TunnelState.Error
+  tunnelStateErrorState = 1
+
+  // ErrorState
+  errorStateCause = 1
+
+  // TunnelStateRelayInfo
+  relayInfoLocation = 2
+
+  // GeoIpLocation
+  geoIPLocationCountry  = 3
+  geoIPLocationCity     = 4
+  geoIPLocationHostname = 8
+
+  // RelayList
+  relayListCountries = 1
+  // RelayListCountry
+  relayListCountryName   = 1
+  relayListCountryCode   = 2
+  relayListCountryCities = 3
+  // RelayListCity
+  relayListCityName   = 1
+  relayListCityCode   = 2
+  relayListCityRelays = 5
+
+  // Relay
+  relayHostname     = 1
+  relayIPv4AddrIn   = 2
+  relayIPv6AddrIn   = 3
+  relayActive       = 5
+  relayOwned        = 6
+  relayProvider     = 7
+  relayEndpointType = 9
+
+  // Settings
+  settingsRelaySettings = 1
+  settingsAllowLAN      = 4
+  settingsLockdownMode  = 5
+  settingsAutoConnect   = 6
+
+  // RelaySettings, oneof endpoint
+  relaySettingsCustom = 1
+  relaySettingsNormal = 2
+
+  // NormalRelaySettings
+  normalRelaySettingsLocation   = 1
+  normalRelaySettingsProviders  = 2
+  normalRelaySettingsTunnelType = 3
+  normalRelaySettingsOwnership  = 6
+
+  // LocationConstraint, oneof type
+  locationConstraintCustomList = 1
+  locationConstraintLocation   = 2
+
+  // GeographicLocationConstraint
+  geoConstraintCountry  = 1
+  geoConstraintCity     = 2
+  geoConstraintHostname = 3
+
+  // google.protobuf.StringValue and BoolValue
+  wrapperValue = 1
+)
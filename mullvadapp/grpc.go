@@ -0,0 +1,127 @@
+package mullvadapp
+
+import (
+  "bytes"
+  "context"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "net"
+  "net/http"
+  "net/url"
+  "time"
+)
+
+// grpcTimeout bounds unary calls to the daemon.
+var grpcTimeout = 10 * time.Second
+
+// grpcService is the path prefix of the methods of the daemon's management
+// interface.
+const grpcService = "/mullvad_daemon.management_interface.ManagementService/"
+
+// A grpcClient calls the daemon's gRPC management interface: HTTP/2 without
+// TLS over its Unix socket, messages framed with a 5-byte prefix.
+type grpcClient struct {
+  client *http.Client
+}
+
+func newGRPCClient(socket string) *grpcClient {
+  var protocols http.Protocols
+  protocols.SetUnencryptedHTTP2(true)
+  return &grpcClient{client: &http.Client{Transport: &http.Transport{
+    Protocols: &protocols,
+    DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+      var d net.Dialer
+      return d.DialContext(ctx, "unix", socket)
+    },
+  }}}
+}
+
+// call calls a unary method and returns the response message.
+func (c *grpcClient) call(method string, req message) (message, error) {
+  ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+  defer cancel()
+  var resp message
+  err := c.stream(ctx, method, req, func(m message) error {
+    resp = m
+    return nil
+  })
+  return resp, err
+}
+
+// stream calls a method and calls fn with each response message, until the
+// end of the stream, an error or ctx is done.
+func (c *grpcClient) stream(ctx context.Context, method string, req message, fn func(message) error) error {
+  b := req.marshal()
+  body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(b)))
+  body = append(body, b...)
+  r, err := http.NewRequestWithContext(ctx, "POST", "http://mullvad"+grpcService+method, bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  r.Header.Set("Content-Type", "application/grpc")
+  r.Header.Set("TE", "trailers")
+  resp, err := c.client.Do(r)
+  if err != nil {
+    return fmt.Errorf("%v: %v", method, err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return fmt.Errorf("%v: HTTP %v", method, resp.Status)
+  }
+  // an error without a response is in the headers, not the trailers
+  if err := grpcStatus(resp.Header); err != nil {
+    return fmt.Errorf("%v: %v", method, err)
+  }
+  for {
+    m, err := readFrame(resp.Body)
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return fmt.Errorf("%v: %v", method, err)
+    }
+    if err := fn(m); err != nil {
+      return err
+    }
+  }
+  if resp.Trailer.Get("Grpc-Status") == "" {
+    return fmt.Errorf("%v: no grpc status", method)
+  }
+  if err := grpcStatus(resp.Trailer); err != nil {
+    return fmt.Errorf("%v: %v", method, err)
+  }
+  return nil
+}
+
+// grpcStatus returns the error of a gRPC status, if not OK.
+func grpcStatus(h http.Header) error {
+  status := h.Get("Grpc-Status")
+  if status == "" || status == "0" {
+    return nil
+  }
+  msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+  if err != nil {
+    msg = h.Get("Grpc-Message")
+  }
+  return fmt.Errorf("grpc status %v: %v", status, msg)
+}
+
+// readFrame reads a length-prefixed gRPC message.
+func readFrame(r io.Reader) (message, error) {
+  var prefix [5]byte
+  if _, err := io.ReadFull(r, prefix[:]); err != nil {
+    if err == io.ErrUnexpectedEOF {
+      return nil, fmt.Errorf("truncated message")
+    }
+    return nil, err
+  }
+  if prefix[0] != 0 {
+    return nil, fmt.Errorf("compressed message not supported")
+  }
+  b := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+  if _, err := io.ReadFull(r, b); err != nil {
+    return nil, fmt.Errorf("truncated message")
+  }
+  return unmarshal(b)
+}
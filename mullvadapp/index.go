@@ -3,19 +3,47 @@ package mullvadapp
 import (
   "html/template"
   "io"
+  "slices"
 )
 
-var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="UTF-8">
-  <meta name="viewport" content="width=device-width" />
-  <title>switchman</title>
-</head>
-<body>
-<p>Status</p><pre>{{.Status}}</pre>
+var indexTmpl = template.Must(template.New("").Parse(`<p>
+{{with .State}}
+  {{if eq .State "error"}}<span style="color: red;">Error: {{.Error}}</span>{{else}}Tunnel {{.State}}{{end}}{{if .Relay}}, relay {{.Relay}}{{end}}{{if .Location}} ({{.Location}}){{end}}
+{{else}}
+  <span style="color: red;">Unknown tunnel state: {{.StateError}}</span>
+{{end}}
+{{if .EventsError}}<br>Not listening to daemon events: {{.EventsError}}{{end}}
+<br>
+<a href="connect">connect</a> <a href="disconnect">disconnect</a> <a href="reconnect">reconnect</a>
+</p>
 <p>Version</p><pre>{{.Version}}</pre>
-<p>Relay options</p><pre>{{.RelayOptions}}</pre>
+<p>Settings</p>
+<table>
+  <tbody>
+    {{range .Settings}}
+    <tr>
+      <td>{{.Section}}</td>
+      <td>{{.Key}}</td>
+      <td>{{.Value}}</td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+{{if .SettingsError}}
+<p>Error reading settings: {{.SettingsError}}</p>
+{{end}}
+{{range .Settable}}
+<form action="set">
+  <input type="hidden" name="name" value="{{.Name}}">
+  {{.Name}}:
+  {{if .Values}}<select name="value">{{range .Values}}<option>{{.}}</option>{{end}}</select>
+  {{else}}<input name="value" placeholder="{{.Example}}">{{end}}
+  <input type="submit" value="set">
+</form>
+{{end}}
+{{if .RelaysError}}
+<p>Error listing relays: {{.RelaysError}}</p>
+{{end}}
 <p>
 Relays ({{len .Relays}})
 </p>
@@ -27,52 +55,92 @@ Relays ({{len .Relays}})
       <th align="left">Hostname</th>
       <th align="left">IPv4</th>
       <th align="left">IPv6</th>
+      <th align="left">Hosted by</th>
       <th align="left">Ownership</th>
+      <th align="left">Features</th>
       <th align="left">Switch</th>
     </tr>
   </thead>
   <tbody>
     {{range .Relays}}
     <tr>
-      <td>{{.Country}}</td>
-      <td>{{.City}}</td>
+      <td>{{.CountryName}} ({{.Country}})</td>
+      <td>{{if .City}}{{.CityName}} ({{.City}}){{end}}</td>
       <td>{{.Hostname}}</td>
       <td>{{.IPv4}}</td>
       <td>{{.IPv6}}</td>
+      <td>{{.HostedBy}}</td>
       <td>{{.Ownership}}</td>
+      <td>{{range $i, $e := .Features}}{{if $i}}, {{end}}{{$e}}{{end}}</td>
       <td><a href="switch?server={{.Location}}">switch</a></td>
     </tr>
     {{end}}
   </tbody>
-</table>
-</body>
-</html>`))
+</table>`))
 
-// Index writes an HTML index page to switch the Server.
+// Index writes the body of an HTML index page to switch the Server.
 func (s *Server) Index(w io.Writer) error {
-  status, err := run("mullvad", "status", "-v")
-  if err != nil {
-    return err
-  }
+  state, stateError := s.Status()
   version, err := run("mullvad", "version")
   if err != nil {
     return err
   }
-  relayOptions, err := run("mullvad", "relay", "get")
+  current, settingsError := currentSettings()
+
+  relays, relaysError := s.listRelays()
+  return indexTmpl.Execute(w, index{
+    State:         state,
+    StateError:    stateError,
+    Version:       version,
+    Settings:      current,
+    SettingsError: settingsError,
+    Settable:      settings,
+    Relays:        relays,
+    RelaysError:   relaysError,
+  })
+}
+
+// Index writes the body of an HTML index page to switch the Daemon.
+func (d *Daemon) Index(w io.Writer) error {
+  state, stateError := d.Status()
+  version, err := d.version()
   if err != nil {
     return err
   }
+  current, settingsError := d.currentSettings()
+  var settable []setting
+  for _, e := range settings {
+    if slices.Contains(daemonSettings, e.Name) {
+      settable = append(settable, e)
+    }
+  }
+  d.m.Lock()
+  eventsError := d.eventsError
+  d.m.Unlock()
 
-  relays, err := s.listRelays()
-  return indexTmpl.Execute(w, struct {
-    Status       string
-    Version      string
-    RelayOptions string
-    Relays       []*relay
-  }{
-    Status:       status,
-    Version:      version,
-    RelayOptions: relayOptions,
-    Relays:       relays,
+  relays, relaysError := d.listRelays()
+  return indexTmpl.Execute(w, index{
+    State:         state,
+    StateError:    stateError,
+    EventsError:   eventsError,
+    Version:       version,
+    Settings:      current,
+    SettingsError: settingsError,
+    Settable:      settable,
+    Relays:        relays,
+    RelaysError:   relaysError,
   })
 }
+
+// index is the data of the index page.
+type index struct {
+  State         *State
+  StateError    error
+  EventsError   error // Daemon only
+  Version       string
+  Settings      []keyValue
+  SettingsError error
+  Settable      []setting
+  Relays        []*relay
+  RelaysError   error
+}
@@ -2,8 +2,8 @@ package mullvadapp
 
 import (
   "fmt"
+  "slices"
   "sort"
-  "strings"
 )
 
 // List lists available relay locations.
@@ -20,38 +20,31 @@ func (s *Server) List() ([]string, error) {
 }
 
 func (s *Server) listRelays() ([]*relay, error) {
-  // assumed already sorted
   list, err := run("mullvad", "relay", "list")
   if err != nil {
     return nil, err
   }
+  hostnames, err := parseRelayList(list)
+  if err != nil {
+    return nil, err
+  }
+  return locations(hostnames), nil
+}
+
+// locations returns relays by hostname, grouped by country and city, with
+// entries to choose a location by country or country and city.
+func locations(hostnames []*relay) []*relay {
   var relays []*relay
   var country, city string
-  for _, line := range strings.Split(list, "\n") {
-    if !strings.HasPrefix(line, "\t\t") {
-      continue
-    }
-
-    fields := strings.Fields(line)
-    r := &relay{
-      Country:  fields[0][:2],
-      City:     fields[0][3:6],
-      Hostname: fields[0],
-      IPv4:     strings.Trim(fields[1], "(),"),
-      IPv6:     strings.Trim(fields[2], "(),"),
-      // shorten 'Mullvad-owned' into just 'owned'
-      Ownership: strings.ReplaceAll(strings.Trim(fields[7], "()"), "Mullvad-", ""),
-      HostedBy:  fields[6],
-    }
-
+  for _, r := range hostnames {
     // relay entries to choose location by country or country and city
     if country != r.Country {
       country = r.Country
-      relays = append(relays, &relay{Country: r.Country})
+      relays = append(relays, &relay{Country: r.Country, CountryName: r.CountryName})
     }
     if city != r.City {
       city = r.City
-      relays = append(relays, &relay{Country: r.Country, City: r.City})
+      relays = append(relays, &relay{Country: r.Country, CountryName: r.CountryName, City: r.City, CityName: r.CityName})
     }
 
     // relays by hostname
@@ -66,17 +59,25 @@ func (s *Server) listRelays() ([]*relay, error) {
     }
     return relays[i].Country < relays[j].Country
   })
-  return relays, nil
+  return relays
 }
 
 type relay struct {
-  Country   string
-  City      string
-  Hostname  string
-  IPv4      string
-  IPv6      string
-  Ownership string
-  HostedBy  string
+  Country     string // code, e.g. se
+  CountryName string
+  City        string // code, e.g. got
+  CityName    string
+  Hostname    string
+  IPv4        string
+  IPv6        string
+  Features    []string // e.g. WireGuard, DAITA
+  HostedBy    string
+  Ownership   string // owned or rented
+}
+
+// Bridge returns whether the relay is a bridge, not an exit.
+func (s *relay) Bridge() bool {
+  return slices.Contains(s.Features, "Bridge")
 }
 
 func (s *relay) Location() string {
@@ -3,6 +3,7 @@ package mullvadapp
 import (
   "fmt"
   "os/exec"
+  "strings"
 )
 
 // New creates a new Server to switch mullvad via app cli.
@@ -17,7 +18,22 @@ func New() (*Server, error) {
 // It implements the Switchable and Indexable interfaces.
 type Server struct{}
 
-func run(name string, arg ...string) (string, error) {
+// Device returns the network device of the tunnel, from the tunnel protocol
+// of the relay settings.
+func (s *Server) Device() (string, error) {
+  out, err := run("mullvad", "relay", "get")
+  if err != nil {
+    return "", fmt.Errorf("mullvad relay get: %v: %v", err, strings.TrimSpace(out))
+  }
+  protocol, err := parseTunnelProtocol(out)
+  if err != nil {
+    return "", err
+  }
+  return deviceOf(protocol)
+}
+
+// run runs a command and returns its combined output, replaced in tests.
+var run = func(name string, arg ...string) (string, error) {
   b, err := exec.Command(name, arg...).CombinedOutput()
   return string(b), err
 }
@@ -0,0 +1,179 @@
+package mullvadapp
+
+import (
+  "fmt"
+  "net"
+  "regexp"
+  "strings"
+)
+
+// Output of mullvad relay list, across cli versions:
+//
+//	Sweden (se)
+//		Gothenburg (got) @ 57.70887°N, 11.97456°W
+//			se-got-001 (185.213.154.66) - OpenVPN, hosted by 31173 (Mullvad-owned)
+//			se-got-wg-001 (185.213.154.68, 2a03:1b20:5:f011::a01f) - WireGuard, hosted by 31173 (Mullvad-owned)
+//			se-got-wg-002 (185.213.154.69, 2a03:1b20:5:f011::a02f) - hosted by 31173 (Mullvad-owned)
+//			se-got-wg-003 (185.213.154.70, 2a03:1b20:5:f011::a03f) - DAITA, hosted by 31173 (Mullvad-owned)
+var (
+  countryLineRE = regexp.MustCompile(`^(\S.*) \(([a-z]{2})\)$`)
+  cityLineRE    = regexp.MustCompile(`^\t(\S.*) \(([a-z]{3})\)(?: @ .*)?$`)
+  relayLineRE   = regexp.MustCompile(`^\t\t([a-z0-9-]+) \(([^)]*)\)(?: - (.*))?$`)
+  hostedByRE    = regexp.MustCompile(`^(?:(.*), )?hosted by (.+) \(([^)]*)\)$`)
+)
+
+// parseRelayList parses the output of mullvad relay list into relays by
+// hostname, skipping bridges.
+func parseRelayList(out string) ([]*relay, error) {
+  var relays []*relay
+  var country, city *relay
+  for i, line := range strings.Split(out, "\n") {
+    line = strings.TrimRight(line, "\r ")
+    if line == "" {
+      continue
+    }
+    if m := countryLineRE.FindStringSubmatch(line); m != nil {
+      country, city = &relay{Country: m[2], CountryName: m[1]}, nil
+      continue
+    }
+    if m := cityLineRE.FindStringSubmatch(line); m != nil {
+      if country == nil {
+        return nil, fmt.Errorf("relay list line %d: city outside of a country: %q", i+1, line)
+      }
+      city = &relay{Country: country.Country, CountryName: country.CountryName, City: m[2], CityName: m[1]}
+      continue
+    }
+    m := relayLineRE.FindStringSubmatch(line)
+    if m == nil {
+      return nil, fmt.Errorf("relay list line %d: unexpected %q", i+1, line)
+    }
+    if city == nil {
+      return nil, fmt.Errorf("relay list line %d: relay outside of a city: %q", i+1, line)
+    }
+    r := *city
+    r.Hostname = m[1]
+    for _, e := range strings.Split(m[2], ",") {
+      ip := net.ParseIP(strings.TrimSpace(e))
+      switch {
+      case ip == nil:
+        return nil, fmt.Errorf("relay list line %d: invalid address %q", i+1, e)
+      case ip.To4() != nil:
+        r.IPv4 = ip.String()
+      default:
+        r.IPv6 = ip.String()
+      }
+    }
+    features := m[3]
+    if h := hostedByRE.FindStringSubmatch(m[3]); h != nil {
+      features, r.HostedBy = h[1], h[2]
+      // shorten 'Mullvad-owned' into just 'owned'
+      r.Ownership = strings.TrimPrefix(h[3], "Mullvad-")
+    }
+    if features != "" {
+      r.Features = strings.Split(features, ", ")
+    }
+    if r.Bridge() {
+      continue
+    }
+    relays = append(relays, &r)
+  }
+  return relays, nil
+}
+
+// Output of mullvad relay get, across cli versions:
+//
+//	Current constraints: Location: city got, se using tunnel protocol WireGuard
+//	Location: country se
+//	Location: city got, se
+//	Location: city got, se, hostname se-got-wg-001
+//	Location: city Gothenburg (got), Sweden (se)
+//	Location: se-got-wg-001 (Gothenburg, Sweden)
+var (
+  locationRE    = regexp.MustCompile(`(?m)(?:^|\s)Location:[ \t]*(.*?)(?: using .*)?[ \t]*$`)
+  hostnameRE    = regexp.MustCompile(`\b[a-z]{2}-[a-z]{3}-(?:[a-z0-9]+-)?[0-9]+\b`)
+  codeRE        = regexp.MustCompile(`\(([a-z]{2,3})\)`)
+  countryRE     = regexp.MustCompile(`^country ([a-z]{2})$`)
+  cityCountryRE = regexp.MustCompile(`^city ([a-z]{3}), ([a-z]{2})$`)
+)
+
+// parseLocation parses the location of the output of mullvad relay get into
+// a location as listed: country, country and city, or hostname; or any.
+func parseLocation(out string) (string, error) {
+  m := locationRE.FindStringSubmatch(out)
+  if m == nil {
+    return "", fmt.Errorf("no location in relay constraints")
+  }
+  location := m[1]
+  if location == "any" {
+    return location, nil
+  }
+  if m := hostnameRE.FindString(location); m != "" {
+    return m, nil // hostname
+  }
+  if m := countryRE.FindStringSubmatch(location); m != nil {
+    return m[1], nil // country
+  }
+  if m := cityCountryRE.FindStringSubmatch(location); m != nil {
+    return fmt.Sprintf("%s %s", m[2], m[1]), nil // country city
+  }
+  switch codes := codeRE.FindAllStringSubmatch(location, -1); len(codes) {
+  case 1:
+    return codes[0][1], nil // country
+  case 2:
+    return fmt.Sprintf("%s %s", codes[1][1], codes[0][1]), nil // country city
+  }
+  return "", fmt.Errorf("could not parse relay location %q", location)
+}
+
+// A keyValue is a setting shown by the cli, in a section if indented.
+type keyValue struct {
+  Section string
+  Key     string
+  Value   string
+}
+
+// parseSettings parses settings shown by the cli as "key: value" lines,
+// indented under a section line, e.g. mullvad relay get:
+//
+//	Generic constraints
+//		Location:               country se
+//		Tunnel protocol:        any
+func parseSettings(out string) []keyValue {
+  var settings []keyValue
+  var section string
+  for _, line := range strings.Split(out, "\n") {
+    line = strings.TrimRight(line, "\r ")
+    key, value, ok := strings.Cut(line, ":")
+    indented := strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ")
+    switch {
+    case strings.TrimSpace(line) == "":
+    case !ok && !indented:
+      section = strings.TrimSpace(line)
+    case ok:
+      if !indented {
+        section = ""
+      }
+      settings = append(settings, keyValue{Section: section, Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+    }
+  }
+  return settings
+}
+
+var (
+  tunnelProtocolRE    = regexp.MustCompile(`(?m)^\s*Tunnel protocol:[ \t]*(\S+)`)
+  tunnelProtocolOldRE = regexp.MustCompile(`using tunnel protocol (\S+)`)
+)
+
+// parseTunnelProtocol parses the tunnel protocol of mullvad relay get: a line
+// of its generic constraints, or the end of the constraints before 2023:
+//
+//	Current constraints: Location: city got, se using tunnel protocol WireGuard
+func parseTunnelProtocol(out string) (string, error) {
+  if m := tunnelProtocolRE.FindStringSubmatch(out); m != nil {
+    return m[1], nil
+  }
+  if m := tunnelProtocolOldRE.FindStringSubmatch(out); m != nil {
+    return m[1], nil
+  }
+  return "", fmt.Errorf("could not parse tunnel protocol %q", out)
+}
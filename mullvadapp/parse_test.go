@@ -0,0 +1,142 @@
+package mullvadapp
+
+import (
+  "os"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func readTestdata(t *testing.T, name string) string {
+  b, err := os.ReadFile("testdata/" + name)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return string(b)
+}
+
+func TestParseRelayList(t *testing.T) {
+  for _, tt := range []struct {
+    file      string
+    hostnames []string
+    relay     relay // one of them
+  }{
+    {
+      file:      "relay-list-2021.3.txt",
+      hostnames: []string{"al-tia-001", "al-tia-wg-001", "se-got-001", "se-got-wg-001", "se-sto-wg-001"},
+      relay: relay{Country: "se", CountryName: "Sweden", City: "got", CityName: "Gothenburg", Hostname: "se-got-wg-001",
+        IPv4: "185.213.154.68", IPv6: "2a03:1b20:5:f011::a01f", Features: []string{"WireGuard"}, HostedBy: "31173", Ownership: "owned"},
+    },
+    {
+      file:      "relay-list-2023.6.txt",
+      hostnames: []string{"al-tia-ovpn-001", "al-tia-wg-003", "se-got-ovpn-001", "se-got-wg-001", "se-got-wg-002", "se-sto-wg-001", "us-nyc-wg-301"},
+      relay: relay{Country: "us", CountryName: "USA", City: "nyc", CityName: "New York, NY", Hostname: "us-nyc-wg-301",
+        IPv4: "143.244.47.65", IPv6: "2a02:6ea0:c020::a01f", Features: []string{"WireGuard"}, HostedBy: "DataPacket", Ownership: "rented"},
+    },
+    {
+      file:      "relay-list-2024.8.txt",
+      hostnames: []string{"al-tia-wg-003", "al-tia-wg-004", "se-got-wg-001", "se-got-wg-002", "se-sto-wg-001"},
+      relay: relay{Country: "se", CountryName: "Sweden", City: "got", CityName: "Gothenburg", Hostname: "se-got-wg-001",
+        IPv4: "185.213.154.68", IPv6: "2a03:1b20:5:f011::a01f", Features: []string{"DAITA"}, HostedBy: "31173", Ownership: "owned"},
+    },
+  } {
+    relays, err := parseRelayList(readTestdata(t, tt.file))
+    if err != nil {
+      t.Errorf("%v: %v", tt.file, err)
+      continue
+    }
+    var hostnames []string
+    for _, r := range relays {
+      hostnames = append(hostnames, r.Hostname)
+      if r.Hostname == tt.relay.Hostname && !reflect.DeepEqual(*r, tt.relay) {
+        t.Errorf("%v: %v = %+v; want %+v", tt.file, r.Hostname, *r, tt.relay)
+      }
+    }
+    if !reflect.DeepEqual(hostnames, tt.hostnames) {
+      t.Errorf("%v: hostnames %v; want %v", tt.file, hostnames, tt.hostnames)
+    }
+  }
+}
+
+func TestParseRelayListErrors(t *testing.T) {
+  for _, tt := range []struct {
+    out  string
+    want string
+  }{
+    {"Sweden (se)\n\tGothenburg (got)\n\t\tse-got-wg-001\n", "line 3: unexpected"},
+    {"Sweden (se)\n\tGothenburg (got)\n\t\tse-got-wg-001 (185.213.154.x) - hosted by 31173 (rented)\n", "line 3: invalid address"},
+    {"\t\tse-got-wg-001 (185.213.154.68) - hosted by 31173 (rented)\n", "line 1: relay outside of a city"},
+    {"\tGothenburg (got)\n", "line 1: city outside of a country"},
+    {"Fetching relays...\n", "line 1: unexpected"},
+  } {
+    if _, err := parseRelayList(tt.out); err == nil || !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("parseRelayList(%q) = %v; want %v", tt.out, err, tt.want)
+    }
+  }
+}
+
+func TestParseLocation(t *testing.T) {
+  for _, tt := range []struct {
+    out  string
+    want string
+  }{
+    {readTestdata(t, "relay-get-2021.3.txt"), "se got"},
+    {readTestdata(t, "relay-get-2023.6.txt"), "se-got-wg-001"},
+    {readTestdata(t, "relay-get-2024.8.txt"), "se got"},
+    {"Location: country se\n", "se"},
+    {"Location: any\n", "any"},
+    {"\tLocation:               country Sweden (se)\n", "se"},
+    {"\tLocation:               se-got-wg-001 (Gothenburg, Sweden)\n", "se-got-wg-001"},
+  } {
+    if got, err := parseLocation(tt.out); err != nil || got != tt.want {
+      t.Errorf("parseLocation(%q) = %v, %v; want %v", tt.out, got, err, tt.want)
+    }
+  }
+  for _, out := range []string{"", "Generic constraints\n", "Location: custom list nordics\n"} {
+    if got, err := parseLocation(out); err == nil {
+      t.Errorf("parseLocation(%q) = %v; want error", out, got)
+    }
+  }
+}
+
+func TestParseTunnelProtocol(t *testing.T) {
+  for _, tt := range []struct {
+    out    string
+    want   string
+    device string
+  }{
+    {readTestdata(t, "relay-get-2021.3.txt"), "WireGuard", wireGuardDevice},
+    {readTestdata(t, "relay-get-2023.6.txt"), "any", wireGuardDevice},
+    {readTestdata(t, "relay-get-2024.8.txt"), "WireGuard", wireGuardDevice},
+    {"Tunnel protocol:        OpenVPN\n", "OpenVPN", ""},
+  } {
+    got, err := parseTunnelProtocol(tt.out)
+    if err != nil || got != tt.want {
+      t.Errorf("parseTunnelProtocol(%q) = %v, %v; want %v", tt.out, got, err, tt.want)
+      continue
+    }
+    if device, err := deviceOf(got); device != tt.device || (err == nil) != (tt.device != "") {
+      t.Errorf("deviceOf(%v) = %v, %v; want %v", got, device, err, tt.device)
+    }
+  }
+  if got, err := parseTunnelProtocol("Generic constraints\n"); err == nil {
+    t.Errorf("parseTunnelProtocol() = %v; want error", got)
+  }
+}
+
+func TestParseSettings(t *testing.T) {
+  got := parseSettings(readTestdata(t, "relay-get-2024.8.txt"))
+  want := []keyValue{
+    {"Generic constraints", "Location", "city Gothenburg (got), Sweden (se)"},
+    {"Generic constraints", "Providers", "any"},
+    {"Generic constraints", "Ownership", "Mullvad-owned"},
+    {"", "Tunnel protocol", "WireGuard"},
+    {"WireGuard constraints", "Port", "any"},
+    {"WireGuard constraints", "IP protocol", "any"},
+    {"WireGuard constraints", "Multihop state", "enabled"},
+    {"WireGuard constraints", "Multihop entry", "country Switzerland (ch)"},
+  }
+  if !reflect.DeepEqual(got, want) {
+    t.Errorf("parseSettings() = %+v; want %+v", got, want)
+  }
+}
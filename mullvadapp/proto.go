@@ -0,0 +1,189 @@
+package mullvadapp
+
+import (
+  "encoding/binary"
+  "fmt"
+)
+
+// Protocol buffers wire types.
+const (
+  wireVarint  = 0
+  wireFixed64 = 1
+  wireBytes   = 2
+  wireFixed32 = 5
+)
+
+// A field is a field of a protocol buffers message, with its value as on the
+// wire: varint or fixed bytes, or the content of length-delimited bytes.
+type field struct {
+  num  int
+  wire int
+  raw  []byte
+}
+
+// A message is a protocol buffers message as a list of fields, decoded
+// without a schema. Unknown fields are kept, so a message can be changed and
+// sent back as is.
+type message []field
+
+// unmarshal decodes the fields of a protocol buffers message.
+func unmarshal(b []byte) (message, error) {
+  var m message
+  for len(b) > 0 {
+    tag, n := binary.Uvarint(b)
+    if n <= 0 {
+      return nil, fmt.Errorf("protobuf: invalid tag")
+    }
+    b = b[n:]
+    f := field{num: int(tag >> 3), wire: int(tag & 7)}
+    switch f.wire {
+    case wireVarint:
+      if _, n = binary.Uvarint(b); n <= 0 {
+        return nil, fmt.Errorf("protobuf: field %d: invalid varint", f.num)
+      }
+      f.raw, b = b[:n], b[n:]
+    case wireFixed64, wireFixed32:
+      n = 8
+      if f.wire == wireFixed32 {
+        n = 4
+      }
+      if len(b) < n {
+        return nil, fmt.Errorf("protobuf: field %d: truncated", f.num)
+      }
+      f.raw, b = b[:n], b[n:]
+    case wireBytes:
+      l, n := binary.Uvarint(b)
+      if n <= 0 || uint64(len(b)-n) < l {
+        return nil, fmt.Errorf("protobuf: field %d: truncated", f.num)
+      }
+      f.raw, b = b[n:n+int(l)], b[n+int(l):]
+    default:
+      return nil, fmt.Errorf("protobuf: field %d: unsupported wire type %d", f.num, f.wire)
+    }
+    m = append(m, f)
+  }
+  return m, nil
+}
+
+// marshal encodes the fields of the message.
+func (m message) marshal() []byte {
+  var b []byte
+  for _, f := range m {
+    b = binary.AppendUvarint(b, uint64(f.num)<<3|uint64(f.wire))
+    if f.wire == wireBytes {
+      b = binary.AppendUvarint(b, uint64(len(f.raw)))
+    }
+    b = append(b, f.raw...)
+  }
+  return b
+}
+
+// get returns the last field with the number, as the last one wins.
+func (m message) get(num int) (field, bool) {
+  for i := len(m) - 1; i >= 0; i-- {
+    if m[i].num == num {
+      return m[i], true
+    }
+  }
+  return field{}, false
+}
+
+// has returns whether the message has the field, e.g. the set one of a oneof.
+func (m message) has(num int) bool {
+  _, ok := m.get(num)
+  return ok
+}
+
+// string returns a string field, empty if not set.
+func (m message) string(num int) string {
+  f, ok := m.get(num)
+  if !ok || f.wire != wireBytes {
+    return ""
+  }
+  return string(f.raw)
+}
+
+// strings returns a repeated string field.
+func (m message) strings(num int) []string {
+  var s []string
+  for _, f := range m {
+    if f.num == num && f.wire == wireBytes {
+      s = append(s, string(f.raw))
+    }
+  }
+  return s
+}
+
+// uint returns a varint field: integer, bool or enum, 0 if not set.
+func (m message) uint(num int) uint64 {
+  f, ok := m.get(num)
+  if !ok || f.wire != wireVarint {
+    return 0
+  }
+  v, _ := binary.Uvarint(f.raw)
+  return v
+}
+
+// bool returns a bool field, false if not set.
+func (m message) bool(num int) bool {
+  return m.uint(num) != 0
+}
+
+// message returns an embedded message field, empty if not set.
+func (m message) message(num int) (message, error) {
+  f, ok := m.get(num)
+  if !ok || f.wire != wireBytes {
+    return nil, nil
+  }
+  return unmarshal(f.raw)
+}
+
+// messages returns a repeated embedded message field.
+func (m message) messages(num int) ([]message, error) {
+  var list []message
+  for _, f := range m {
+    if f.num != num || f.wire != wireBytes {
+      continue
+    }
+    e, err := unmarshal(f.raw)
+    if err != nil {
+      return nil, err
+    }
+    list = append(list, e)
+  }
+  return list, nil
+}
+
+// without returns the message without the field.
+func (m message) without(num int) message {
+  var n message
+  for _, f := range m {
+    if f.num != num {
+      n = append(n, f)
+    }
+  }
+  return n
+}
+
+// withString returns the message with a string field appended.
+func (m message) withString(num int, s string) message {
+  return append(m, field{num: num, wire: wireBytes, raw: []byte(s)})
+}
+
+// withMessage returns the message with an embedded message field appended.
+func (m message) withMessage(num int, e message) message {
+  return append(m, field{num: num, wire: wireBytes, raw: e.marshal()})
+}
+
+// withUint returns the message with a varint field appended.
+func (m message) withUint(num int, v uint64) message {
+  return append(m, field{num: num, wire: wireVarint, raw: binary.AppendUvarint(nil, v)})
+}
+
+// withBool returns the message with a bool field appended.
+func (m message) withBool(num int, v bool) message {
+  if v {
+    return m.withUint(num, 1)
+  }
+  return m.withUint(num, 0)
+}
@@ -0,0 +1,90 @@
+package mullvadapp
+
+import (
+  "errors"
+  "fmt"
+  "slices"
+  "strings"
+)
+
+// A setting is a relay or tunnel setting of the app, changed with the cli.
+type setting struct {
+  Name    string
+  Values  []string // allowed values, nil for a list of words
+  Example string   // for a list of words
+  args    func(value string) []string
+}
+
+var settings = []setting{
+  {Name: "tunnel-protocol", Values: []string{"any", "wireguard", "openvpn"}, args: func(v string) []string {
+    return []string{"relay", "set", "tunnel-protocol", v}
+  }},
+  {Name: "obfuscation", Values: []string{"auto", "off", "udp2tcp", "shadowsocks"}, args: func(v string) []string {
+    return []string{"obfuscation", "set", "mode", v}
+  }},
+  {Name: "daita", Values: []string{"on", "off"}, args: func(v string) []string {
+    return []string{"tunnel", "set", "wireguard", "--daita", v}
+  }},
+  {Name: "multihop", Values: []string{"on", "off"}, args: func(v string) []string {
+    return []string{"relay", "set", "tunnel", "wireguard", "--use-multihop", v}
+  }},
+  {Name: "entry-location", Example: "se got", args: func(v string) []string {
+    return append([]string{"relay", "set", "tunnel", "wireguard", "--entry-location"}, strings.Fields(v)...)
+  }},
+  {Name: "providers", Example: "any, or 31173 M247", args: func(v string) []string {
+    return append([]string{"relay", "set", "provider"}, strings.Fields(v)...)
+  }},
+  {Name: "ownership", Values: []string{"any", "owned", "rented"}, args: func(v string) []string {
+    return []string{"relay", "set", "ownership", v}
+  }},
+}
+
+// Set changes a setting of the app: tunnel-protocol, obfuscation, daita,
+// multihop, entry-location, providers or ownership.
+func (s *Server) Set(name, value string) error {
+  e, err := findSetting(name, value)
+  if err != nil {
+    return err
+  }
+  if out, err := run("mullvad", e.args(value)...); err != nil {
+    return fmt.Errorf("could not set %v to %v: %v: %v", name, value, err, strings.TrimSpace(out))
+  }
+  return nil
+}
+
+// findSetting returns the setting by name, validating the value.
+func findSetting(name, value string) (setting, error) {
+  i := slices.IndexFunc(settings, func(e setting) bool { return e.Name == name })
+  if i < 0 {
+    return setting{}, fmt.Errorf("unknown setting %q", name)
+  }
+  e := settings[i]
+  if e.Values != nil && !slices.Contains(e.Values, value) {
+    return setting{}, fmt.Errorf("invalid %v %q, want one of %v", name, value, strings.Join(e.Values, ", "))
+  }
+  if e.Values == nil && len(strings.Fields(value)) == 0 {
+    return setting{}, fmt.Errorf("missing %v", name)
+  }
+  return e, nil
+}
+
+// currentSettings returns the settings shown by the cli, relay constraints
+// then obfuscation and tunnel options, and the errors of commands missing in
+// older versions.
+func currentSettings() ([]keyValue, error) {
+  var current []keyValue
+  var errs []error
+  for _, args := range [][]string{
+    {"relay", "get"},
+    {"obfuscation", "get"},
+    {"tunnel", "get"},
+  } {
+    out, err := run("mullvad", args...)
+    if err != nil {
+      errs = append(errs, fmt.Errorf("mullvad %v: %v: %v", strings.Join(args, " "), err, strings.TrimSpace(out)))
+      continue
+    }
+    current = append(current, parseSettings(out)...)
+  }
+  return current, errors.Join(errs...)
+}
@@ -0,0 +1,22 @@
+package mullvadapp
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestSetInvalid(t *testing.T) {
+  s := &Server{}
+  for _, tt := range []struct {
+    name, value, want string
+  }{
+    {"bogus", "on", "unknown setting"},
+    {"daita", "maybe", "want one of on, off"},
+    {"tunnel-protocol", "ikev2", "want one of any, wireguard, openvpn"},
+    {"providers", " ", "missing providers"},
+  } {
+    if err := s.Set(tt.name, tt.value); err == nil || !strings.Contains(err.Error(), tt.want) {
+      t.Errorf("Set(%q, %q) = %v; want %v", tt.name, tt.value, err, tt.want)
+    }
+  }
+}
@@ -0,0 +1,175 @@
+package mullvadapp
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+  "time"
+)
+
+// How long to wait for the daemon to connect, and how often to check.
+var (
+  connectTimeout      = time.Minute
+  connectPollInterval = 500 * time.Millisecond
+)
+
+// A State is the connection state of the daemon.
+type State struct {
+  State    string `json:"state"`              // connected, connecting, disconnected, disconnecting or error
+  Relay    string `json:"relay,omitempty"`    // hostname, if known
+  Endpoint string `json:"endpoint,omitempty"` // IP of the relay, if known
+  Location string `json:"location,omitempty"` // visible location, if known
+  Error    string `json:"error,omitempty"`    // cause of the error state
+}
+
+// Output of mullvad status -v, across cli versions:
+//
+//	Tunnel status: Connected to WireGuard 185.213.154.68:51820 over UDP
+//	Tunnel status: Blocked: Failed to set up routing
+//	Connected to se-got-wg-001 in Gothenburg, Sweden
+//	Connected
+//	    Relay:                  se-got-wg-001
+//	    Visible location:       Sweden, Gothenburg. IPv4: 185.213.154.70
+var (
+  statusInRE       = regexp.MustCompile(` in (.+)$`)
+  statusEndpointRE = regexp.MustCompile(` ((?:\d+\.){3}\d+|\[[0-9a-fA-F:]+\]):\d+\b`)
+  statusRelayRE    = regexp.MustCompile(`(?m)^\s*Relay:\s*(\S+)`)
+  statusLocationRE = regexp.MustCompile(`(?m)^\s*(?:Visible l|L)ocation:\s*([^.\n]+)`)
+)
+
+// parseStatus parses the output of mullvad status.
+func parseStatus(out string) (*State, error) {
+  out = strings.TrimSpace(out)
+  first, _, _ := strings.Cut(out, "\n")
+  first = strings.TrimPrefix(strings.TrimSpace(first), "Tunnel status: ")
+  word, rest, _ := strings.Cut(first, " ")
+  s := &State{}
+  switch strings.ToLower(strings.TrimSuffix(strings.TrimRight(word, "."), ":")) {
+  case "connected":
+    s.State = "connected"
+  case "connecting":
+    s.State = "connecting"
+  case "disconnected":
+    s.State = "disconnected"
+  case "disconnecting":
+    s.State = "disconnecting"
+  case "blocked", "error":
+    s.State = "error"
+    s.Error = strings.TrimSpace(rest)
+  default:
+    return nil, fmt.Errorf("could not parse status %q", first)
+  }
+  if m := statusRelayRE.FindStringSubmatch(out); m != nil {
+    s.Relay = m[1]
+  } else if m := hostnameRE.FindString(first); m != "" {
+    s.Relay = m
+  }
+  if m := statusEndpointRE.FindStringSubmatch(first); m != nil {
+    s.Endpoint = strings.Trim(m[1], "[]")
+  }
+  if m := statusLocationRE.FindStringSubmatch(out); m != nil {
+    s.Location = strings.TrimSpace(m[1])
+  } else if m := statusInRE.FindStringSubmatch(first); m != nil && s.State != "error" {
+    s.Location = m[1]
+  }
+  return s, nil
+}
+
+// Status returns the connection state of the daemon.
+func (s *Server) Status() (*State, error) {
+  out, err := run("mullvad", "status", "-v")
+  if err != nil {
+    return nil, fmt.Errorf("mullvad status: %v: %v", err, strings.TrimSpace(out))
+  }
+  return parseStatus(out)
+}
+
+// Connect connects the tunnel and waits until connected.
+func (s *Server) Connect() error {
+  return s.control("connect")
+}
+
+// Disconnect disconnects the tunnel.
+func (s *Server) Disconnect() error {
+  if out, err := run("mullvad", "disconnect"); err != nil {
+    return fmt.Errorf("mullvad disconnect: %v: %v", err, strings.TrimSpace(out))
+  }
+  return nil
+}
+
+// Reconnect reconnects the tunnel, to a new relay of the location, and waits
+// until connected.
+func (s *Server) Reconnect() error {
+  return s.control("reconnect")
+}
+
+func (s *Server) control(command string) error {
+  if out, err := run("mullvad", command); err != nil {
+    return fmt.Errorf("mullvad %v: %v: %v", command, err, strings.TrimSpace(out))
+  }
+  location, err := s.Current()
+  if err != nil {
+    return err
+  }
+  // older cli versions only show the endpoint of the relay: find it by IP
+  byIP := map[string]string{}
+  if relays, err := s.listRelays(); err == nil {
+    for _, r := range relays {
+      if r.Hostname == "" {
+        continue
+      }
+      for _, ip := range []string{r.IPv4, r.IPv6} {
+        if ip != "" {
+          byIP[ip] = r.Hostname
+        }
+      }
+    }
+  }
+  status := func() (*State, error) {
+    state, err := s.Status()
+    if err == nil && state.Relay == "" {
+      state.Relay = byIP[state.Endpoint]
+    }
+    return state, err
+  }
+  return waitConnected(status, location)
+}
+
+// waitConnected waits until status reports connected to a relay in the
+// location, failing with the daemon's error or after a timeout. Without the
+// relay in the status, connected only counts after the daemon went through
+// another state, as right after a change it is still connected to the
+// previous relay.
+func waitConnected(status func() (*State, error), location string) error {
+  var last *State
+  changed := false
+  for deadline := time.Now().Add(connectTimeout); time.Now().Before(deadline); time.Sleep(connectPollInterval) {
+    state, err := status()
+    if err != nil {
+      return err
+    }
+    last = state
+    switch state.State {
+    case "error":
+      return fmt.Errorf("mullvad: %v", state.Error)
+    case "connected":
+      switch {
+      case state.Relay == "":
+        if changed {
+          return nil
+        }
+      case location == "any" || inLocation(state.Relay, location):
+        return nil
+      }
+    default:
+      changed = true
+    }
+  }
+  return fmt.Errorf("timeout connecting to %v after %v, last %v %v", location, connectTimeout, last.State, last.Relay)
+}
+
+// inLocation returns whether a relay hostname is in a location: the relay
+// itself, or a relay of the country or city.
+func inLocation(hostname, location string) bool {
+  return hostname == location || strings.HasPrefix(hostname, strings.ReplaceAll(location, " ", "-")+"-")
+}
@@ -0,0 +1,136 @@
+package mullvadapp
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestParseStatus(t *testing.T) {
+  for _, tt := range []struct {
+    out  string
+    want State
+  }{
+    {"Tunnel status: Connected to WireGuard 185.213.154.68:51820 over UDP\n", State{State: "connected", Endpoint: "185.213.154.68"}},
+    {"Tunnel status: Connected to WireGuard [2a03:1b20:5:f011::a01f]:51820 over UDP\n", State{State: "connected", Endpoint: "2a03:1b20:5:f011::a01f"}},
+    {"Tunnel status: Disconnected\n", State{State: "disconnected"}},
+    {"Tunnel status: Blocked: Failed to set up routing\n", State{State: "error", Error: "Failed to set up routing"}},
+    {"Connecting to se-got-wg-001 in Gothenburg, Sweden\n", State{State: "connecting", Relay: "se-got-wg-001", Location: "Gothenburg, Sweden"}},
+    {"Connected to se-got-wg-001 in Gothenburg, Sweden\n", State{State: "connected", Relay: "se-got-wg-001", Location: "Gothenburg, Sweden"}},
+    {"Connected\n    Relay:                  se-got-wg-002\n    Features:               Quantum Resistance\n    Visible location:       Sweden, Gothenburg. IPv4: 185.213.154.70\n",
+      State{State: "connected", Relay: "se-got-wg-002", Location: "Sweden, Gothenburg"}},
+    {"Disconnecting...\n", State{State: "disconnecting"}},
+    {"Blocked: Account is out of time\n", State{State: "error", Error: "Account is out of time"}},
+  } {
+    got, err := parseStatus(tt.out)
+    if err != nil || !reflect.DeepEqual(*got, tt.want) {
+      t.Errorf("parseStatus(%q) = %+v, %v; want %+v", tt.out, got, err, tt.want)
+    }
+  }
+  for _, out := range []string{"", "Unknown state\n"} {
+    if got, err := parseStatus(out); err == nil {
+      t.Errorf("parseStatus(%q) = %+v; want error", out, got)
+    }
+  }
+}
+
+// fakeRun replaces run with commands answered from outputs, in order for
+// repeated commands, the last one repeating.
+func fakeRun(t *testing.T, outputs map[string][]string) *[]string {
+  var commands []string
+  prev, prevTimeout, prevInterval := run, connectTimeout, connectPollInterval
+  t.Cleanup(func() { run, connectTimeout, connectPollInterval = prev, prevTimeout, prevInterval })
+  connectTimeout, connectPollInterval = 100*time.Millisecond, time.Millisecond
+  run = func(name string, arg ...string) (string, error) {
+    command := strings.Join(append([]string{name}, arg...), " ")
+    commands = append(commands, command)
+    out := outputs[command]
+    if len(out) == 0 {
+      return "", nil
+    }
+    if len(out) > 1 {
+      outputs[command] = out[1:]
+    }
+    return out[0], nil
+  }
+  return &commands
+}
+
+func TestSwitchWaits(t *testing.T) {
+  commands := fakeRun(t, map[string][]string{
+    "mullvad relay get": {"Location: country ch\n"},
+    "mullvad status -v": {
+      "Connected to se-got-wg-001 in Gothenburg, Sweden\n", // previous relay
+      "Connecting to ch-zrh-wg-001 in Zurich, Switzerland\n",
+      "Connected to ch-zrh-wg-001 in Zurich, Switzerland\n",
+    },
+  })
+  if err := (&Server{}).Switch("ch"); err != nil {
+    t.Fatal(err)
+  }
+  want := []string{"mullvad relay set location ch", "mullvad connect", "mullvad relay get", "mullvad relay list", "mullvad status -v", "mullvad status -v", "mullvad status -v"}
+  if !reflect.DeepEqual(*commands, want) {
+    t.Errorf("commands = %q; want %q", *commands, want)
+  }
+}
+
+// TestSwitchWaitsEndpoint checks that with only the endpoint in the status,
+// the previous relay is not taken for the new one.
+func TestSwitchWaitsEndpoint(t *testing.T) {
+  list := "Sweden (se)\n\tGothenburg (got)\n\t\tse-got-wg-001 (185.213.154.68) - WireGuard, hosted by 31173 (rented)\n" +
+    "Switzerland (ch)\n\tZurich (zrh)\n\t\tch-zrh-wg-001 (193.32.127.66) - WireGuard, hosted by M247 (rented)\n"
+  for _, tt := range []struct {
+    name   string
+    list   string
+    status []string
+  }{
+    {"endpoint", list, []string{
+      "Tunnel status: Connected to WireGuard 185.213.154.68:51820 over UDP\n", // previous relay
+      "Tunnel status: Connected to WireGuard 193.32.127.66:51820 over UDP\n",
+    }},
+    {"unknown endpoint", "", []string{
+      "Tunnel status: Connected to WireGuard 185.213.154.68:51820 over UDP\n", // previous relay
+      "Tunnel status: Connecting\n",
+      "Tunnel status: Connected to WireGuard 193.32.127.66:51820 over UDP\n",
+    }},
+  } {
+    commands := fakeRun(t, map[string][]string{
+      "mullvad relay get":  {"Location: country ch\n"},
+      "mullvad relay list": {tt.list},
+      "mullvad status -v":  tt.status,
+    })
+    if err := (&Server{}).Switch("ch"); err != nil {
+      t.Fatalf("%v: %v", tt.name, err)
+    }
+    var polls int
+    for _, c := range *commands {
+      if c == "mullvad status -v" {
+        polls++
+      }
+    }
+    if polls != len(tt.status) {
+      t.Errorf("%v: status polled %d times; want %d, until connected to the new relay", tt.name, polls, len(tt.status))
+    }
+  }
+}
+
+func TestSwitchError(t *testing.T) {
+  fakeRun(t, map[string][]string{
+    "mullvad relay get": {"Location: country ch\n"},
+    "mullvad status -v": {"Connecting to ch-zrh-wg-001 in Zurich, Switzerland\n", "Blocked: Account is out of time\n"},
+  })
+  if err := (&Server{}).Switch("ch"); err == nil || !strings.Contains(err.Error(), "Account is out of time") {
+    t.Errorf("Switch() = %v; want daemon error", err)
+  }
+}
+
+func TestSwitchTimeout(t *testing.T) {
+  fakeRun(t, map[string][]string{
+    "mullvad relay get": {"Location: country ch\n"},
+    "mullvad status -v": {"Connecting to ch-zrh-wg-001 in Zurich, Switzerland\n"},
+  })
+  if err := (&Server{}).Switch("ch"); err == nil || !strings.Contains(err.Error(), "timeout") {
+    t.Errorf("Switch() = %v; want timeout", err)
+  }
+}
@@ -10,6 +10,7 @@ import (
 // - country (e.g. us), 1 argument
 // - country and city (e.g. us nyc), 2 arguments
 // - hostname (e.g. us-nyc-wg-001), 1 argument
+// It waits until the daemon reports connected to the location.
 func (s *Server) Switch(location string) error {
   cmd := []string{"relay", "set", "location"}
   switch args := strings.Split(location, " "); len(args) {
@@ -21,5 +22,6 @@ func (s *Server) Switch(location string) error {
   if _, err := run("mullvad", cmd...); err != nil {
     return fmt.Errorf("could not set location to %v: %v", location, err)
   }
-  return nil
+  // connected: reconnects by itself; disconnected: needs to connect
+  return s.Connect()
 }
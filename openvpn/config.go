@@ -0,0 +1,336 @@
+package openvpn
+
+import (
+  "fmt"
+  "net"
+  "os"
+  "strconv"
+  "strings"
+)
+
+const (
+  defaultPort  = 1194
+  defaultProto = "udp"
+)
+
+// A remote is an OpenVPN server.
+type remote struct {
+  Host  string
+  Port  int
+  Proto string
+}
+
+// String returns the remote as host:port/proto, which identifies a server.
+func (r remote) String() string {
+  return fmt.Sprintf("%s/%s", net.JoinHostPort(r.Host, strconv.Itoa(r.Port)), r.Proto)
+}
+
+// A remoteEntry is a remote in a config, either a remote line or a connection
+// block, enabled or commented out.
+type remoteEntry struct {
+  remote
+  enabled bool
+  lines   []int // lines to comment out or uncomment to disable or enable
+}
+
+// A config is a parsed OpenVPN config.
+type config struct {
+  lines   []string
+  remotes []remoteEntry
+  random  int                 // line of an enabled remote-random, or -1
+  options map[string][]string // first enabled global option by name
+}
+
+func readConfig(path string) (*config, error) {
+  b, err := os.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  return parseConfig(string(b)), nil
+}
+
+// parseConfig parses the remotes of an OpenVPN config.
+// Remotes and connection blocks commented out with ; or # are also parsed.
+// Port and proto not set on a remote come from the connection block, the
+// global options, or the OpenVPN defaults.
+func parseConfig(s string) *config {
+  c := &config{lines: strings.Split(s, "\n"), random: -1, options: map[string][]string{}}
+  globalPort, globalProto := 0, ""
+  for i := 0; i < len(c.lines); i++ {
+    enabled, args := parseLine(c.lines[i])
+    if len(args) == 0 {
+      continue
+    }
+    if _, ok := c.options[args[0]]; enabled && !ok && !strings.HasPrefix(args[0], "<") {
+      c.options[args[0]] = args[1:]
+    }
+    switch name := args[0]; {
+    case name == "<connection>":
+      end := blockEnd(c.lines, i, name, enabled)
+      if e, ok := parseConnection(c.lines[i+1:end], enabled); ok {
+        for l := i; l <= end && l < len(c.lines); l++ {
+          e.lines = append(e.lines, l)
+        }
+        c.remotes = append(c.remotes, e)
+      }
+      i = end
+
+    case enabled && strings.HasPrefix(name, "<") && !strings.HasPrefix(name, "</"):
+      // inline file, e.g. <ca>
+      i = blockEnd(c.lines, i, name, enabled)
+
+    case name == "remote":
+      if r, ok := parseRemote(args); ok {
+        c.remotes = append(c.remotes, remoteEntry{remote: r, enabled: enabled, lines: []int{i}})
+      }
+
+    case !enabled:
+
+    case name == "remote-random":
+      c.random = i
+
+    case name == "port" || name == "rport":
+      if len(args) > 1 {
+        globalPort, _ = strconv.Atoi(args[1])
+      }
+
+    case name == "proto":
+      if len(args) > 1 {
+        globalProto = normalizeProto(args[1])
+      }
+    }
+  }
+  for i := range c.remotes {
+    r := &c.remotes[i].remote
+    if r.Port == 0 {
+      r.Port = globalPort
+    }
+    if r.Port == 0 {
+      r.Port = defaultPort
+    }
+    if r.Proto == "" {
+      r.Proto = globalProto
+    }
+    if r.Proto == "" {
+      r.Proto = defaultProto
+    }
+  }
+  return c
+}
+
+// parseConnection parses a connection block, returning its first enabled remote.
+func parseConnection(lines []string, enabled bool) (remoteEntry, bool) {
+  var e remoteEntry
+  var found bool
+  port, proto := 0, ""
+  for _, line := range lines {
+    if !enabled {
+      line = uncomment(line)
+    }
+    lineEnabled, args := parseLine(line)
+    if !lineEnabled || len(args) < 2 {
+      continue
+    }
+    switch args[0] {
+    case "remote":
+      if r, ok := parseRemote(args); ok && !found {
+        e.remote, found = r, true
+      }
+    case "port", "rport":
+      port, _ = strconv.Atoi(args[1])
+    case "proto":
+      proto = normalizeProto(args[1])
+    }
+  }
+  if e.Port == 0 {
+    e.Port = port
+  }
+  if e.Proto == "" {
+    e.Proto = proto
+  }
+  e.enabled = enabled
+  return e, found
+}
+
+// parseRemote parses: remote host [port] [proto]
+func parseRemote(args []string) (remote, bool) {
+  if len(args) < 2 || len(args) > 4 {
+    return remote{}, false
+  }
+  r := remote{Host: args[1]}
+  if len(args) > 2 {
+    port, err := strconv.Atoi(args[2])
+    if err != nil || port <= 0 || port > 65535 {
+      return remote{}, false
+    }
+    r.Port = port
+  }
+  if len(args) > 3 {
+    r.Proto = normalizeProto(args[3])
+    if r.Proto == "" {
+      return remote{}, false
+    }
+  }
+  return r, true
+}
+
+func normalizeProto(proto string) string {
+  switch proto {
+  case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+    return proto
+  case "tcp-client":
+    return "tcp"
+  case "tcp4-client":
+    return "tcp4"
+  case "tcp6-client":
+    return "tcp6"
+  }
+  return ""
+}
+
+// blockEnd returns the line of the end tag of the block started at line start,
+// with the same enabled state, or the last line.
+func blockEnd(lines []string, start int, tag string, enabled bool) int {
+  end := "</" + strings.TrimPrefix(tag, "<")
+  for i := start + 1; i < len(lines); i++ {
+    lineEnabled, args := parseLine(lines[i])
+    if lineEnabled == enabled && len(args) > 0 && args[0] == end {
+      return i
+    }
+  }
+  return len(lines) - 1
+}
+
+// parseLine returns whether the line is enabled, i.e. not commented out,
+// and its tokens, uncommented if needed.
+func parseLine(line string) (bool, []string) {
+  t := strings.TrimLeft(line, " \t")
+  if strings.HasPrefix(t, ";") || strings.HasPrefix(t, "#") {
+    return false, tokenize(t[1:])
+  }
+  return true, tokenize(t)
+}
+
+// tokenize splits a line into tokens like OpenVPN does: separated by spaces or
+// tabs, grouped by double or single quotes, with backslash escapes except in
+// single quotes, until a comment starting with ; or # at the start of a token.
+func tokenize(line string) []string {
+  var tokens []string
+  var token strings.Builder
+  inToken := false
+  var quote rune
+  escape := false
+  for _, c := range strings.TrimRight(line, "\r") {
+    switch {
+    case escape:
+      token.WriteRune(c)
+      escape = false
+    case c == '\\' && quote != '\'':
+      escape, inToken = true, true
+    case quote != 0:
+      if c == quote {
+        quote = 0
+      } else {
+        token.WriteRune(c)
+      }
+    case c == '"' || c == '\'':
+      quote, inToken = c, true
+    case c == ' ' || c == '\t':
+      if inToken {
+        tokens = append(tokens, token.String())
+        token.Reset()
+        inToken = false
+      }
+    case (c == ';' || c == '#') && !inToken:
+      return tokens
+    default:
+      token.WriteRune(c)
+      inToken = true
+    }
+  }
+  if inToken {
+    tokens = append(tokens, token.String())
+  }
+  return tokens
+}
+
+// comment comments out a line with ;.
+func comment(line string) string {
+  return ";" + line
+}
+
+// uncomment removes one level of comment from a line, keeping indentation.
+func uncomment(line string) string {
+  t := strings.TrimLeft(line, " \t")
+  if !strings.HasPrefix(t, ";") && !strings.HasPrefix(t, "#") {
+    return line
+  }
+  return line[:len(line)-len(t)] + t[1:]
+}
+
+// current returns the remote that would be connected to: the first enabled.
+// It returns false if there is none, or if remote-random picks among several.
+func (c *config) current() (remote, bool) {
+  var enabled []remote
+  for _, e := range c.remotes {
+    if e.enabled {
+      enabled = append(enabled, e.remote)
+    }
+  }
+  if len(enabled) == 0 || (len(enabled) > 1 && c.random >= 0) {
+    return remote{}, false
+  }
+  return enabled[0], true
+}
+
+// option returns the arguments of a global option, or empty if not set.
+func (c *config) option(name string) string {
+  return strings.Join(c.options[name], " ")
+}
+
+// list returns all remotes, enabled or not, without duplicates.
+func (c *config) list() []string {
+  var servers []string
+  seen := map[string]bool{}
+  for _, e := range c.remotes {
+    if seen[e.String()] {
+      continue
+    }
+    seen[e.String()] = true
+    servers = append(servers, e.String())
+  }
+  return servers
+}
+
+// enable enables only the specified server and disables remote-random,
+// returning the updated config.
+func (c *config) enable(server string) (string, error) {
+  found := false
+  for _, e := range c.remotes {
+    if e.String() == server {
+      found = true
+      break
+    }
+  }
+  if !found {
+    return "", fmt.Errorf("server %v not found", server)
+  }
+  lines := append([]string(nil), c.lines...)
+  for _, e := range c.remotes {
+    want := e.String() == server
+    if e.enabled == want {
+      continue
+    }
+    for _, l := range e.lines {
+      if want {
+        lines[l] = uncomment(lines[l])
+      } else {
+        lines[l] = comment(lines[l])
+      }
+    }
+  }
+  if c.random >= 0 {
+    lines[c.random] = comment(lines[c.random])
+  }
+  return strings.Join(lines, "\n"), nil
+}
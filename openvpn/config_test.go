@@ -0,0 +1,134 @@
+package openvpn
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestTokenize(t *testing.T) {
+  for _, tt := range []struct {
+    line string
+    want []string
+  }{
+    {"remote host 1194 udp", []string{"remote", "host", "1194", "udp"}},
+    {"remote\thost  443\ttcp\r", []string{"remote", "host", "443", "tcp"}},
+    {"remote host 1194 # primary", []string{"remote", "host", "1194"}},
+    {"remote host 1194 ; primary", []string{"remote", "host", "1194"}},
+    {`auth-user-pass "/etc/openvpn/my pass.txt"`, []string{"auth-user-pass", "/etc/openvpn/my pass.txt"}},
+    {`setenv NAME 'a\b'`, []string{"setenv", "NAME", `a\b`}},
+    {`setenv NAME a\ b`, []string{"setenv", "NAME", "a b"}},
+    {"# a comment", nil},
+  } {
+    if got := tokenize(tt.line); !reflect.DeepEqual(got, tt.want) {
+      t.Errorf("tokenize(%q) = %q; want %q", tt.line, got, tt.want)
+    }
+  }
+}
+
+const testConfig = `client
+dev tun
+proto udp
+remote-random
+remote a.example.com 1194
+remote	a.example.com 443 tcp # fallback
+;remote b.example.com
+# remote c.example.com 1195 udp6
+# remote servers are listed above
+<connection>
+remote d.example.com 443
+proto tcp-client
+</connection>
+;<connection>
+;remote e.example.com
+;</connection>
+<ca>
+remote not.a.remote 1194
+</ca>
+`
+
+func TestParseConfig(t *testing.T) {
+  c := parseConfig(testConfig)
+  want := []string{
+    "a.example.com:1194/udp",
+    "a.example.com:443/tcp",
+    "b.example.com:1194/udp",
+    "c.example.com:1195/udp6",
+    "d.example.com:443/tcp",
+    "e.example.com:1194/udp",
+  }
+  if got := c.list(); !reflect.DeepEqual(got, want) {
+    t.Errorf("list() = %q; want %q", got, want)
+  }
+  if _, ok := c.current(); ok {
+    t.Error("current() with remote-random: got ok, want not ok")
+  }
+}
+
+func TestEnable(t *testing.T) {
+  for _, tt := range []struct {
+    server string
+    want   string
+  }{
+    {
+      server: "b.example.com:1194/udp",
+      want: `client
+dev tun
+proto udp
+;remote-random
+;remote a.example.com 1194
+;remote	a.example.com 443 tcp # fallback
+remote b.example.com
+# remote c.example.com 1195 udp6
+# remote servers are listed above
+;<connection>
+;remote d.example.com 443
+;proto tcp-client
+;</connection>
+;<connection>
+;remote e.example.com
+;</connection>
+<ca>
+remote not.a.remote 1194
+</ca>
+`,
+    },
+    {
+      server: "e.example.com:1194/udp",
+      want: `client
+dev tun
+proto udp
+;remote-random
+;remote a.example.com 1194
+;remote	a.example.com 443 tcp # fallback
+;remote b.example.com
+# remote c.example.com 1195 udp6
+# remote servers are listed above
+;<connection>
+;remote d.example.com 443
+;proto tcp-client
+;</connection>
+<connection>
+remote e.example.com
+</connection>
+<ca>
+remote not.a.remote 1194
+</ca>
+`,
+    },
+  } {
+    got, err := parseConfig(testConfig).enable(tt.server)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got != tt.want {
+      t.Errorf("enable(%v) = %v; want %v", tt.server, got, tt.want)
+    }
+    c := parseConfig(got)
+    if current, ok := c.current(); !ok || current.String() != tt.server {
+      t.Errorf("current() after enable(%v) = %v, %v", tt.server, current, ok)
+    }
+  }
+  if _, err := parseConfig(testConfig).enable("x.example.com:1194/udp"); err == nil {
+    t.Error("enable(unknown): got nil error, want error")
+  }
+}
@@ -1,31 +1,32 @@
 package openvpn
 
-import (
-  "bufio"
-  "os"
-  "strings"
-)
+import "github.com/StalkR/switchman/profiledir"
 
 // Current returns the current server.
+// With the management interface, it is the remote actually connected to,
+// otherwise it is the first remote enabled in the config, or empty if
+// remote-random picks among several.
+// In profiles mode, it is the name of the profile in place.
 func (s *Server) Current() (string, error) {
-  f, err := os.Open(s.config)
+  if s.profiles != "" {
+    return profiledir.Current(s.config)
+  }
+  c, err := readConfig(s.config)
   if err != nil {
     return "", err
   }
-  defer f.Close()
-
-  var current string
-  scanner := bufio.NewScanner(f)
-  for scanner.Scan() {
-    f := strings.Split(scanner.Text(), " ")
-    if len(f) < 3 || f[0] != "remote" {
-      continue
+  if s.management != nil {
+    if st, err := s.Status(); err == nil && st.RemoteIP != "" {
+      for _, e := range c.remotes {
+        if e.Host == st.RemoteIP && e.Port == st.RemotePort {
+          return e.String(), nil
+        }
+      }
     }
-    current = f[1]
   }
-
-  if err := scanner.Err(); err != nil {
-    return "", err
+  current, ok := c.current()
+  if !ok {
+    return "", nil
   }
-  return current, nil
+  return current.String(), nil
 }
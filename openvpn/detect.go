@@ -0,0 +1,64 @@
+package openvpn
+
+import (
+  "path/filepath"
+
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for OpenVPN: a directory of profiles if configured, or a
+// single config, and its tunnel and management interface.
+func Detect(options ...Option) *detect.Result {
+  s := &Server{}
+  for _, option := range options {
+    option(s)
+  }
+  r := detect.New("openvpn")
+  r.Binary("openvpn")
+  tunnel := r.Interface(device)
+  if s.management != nil {
+    if _, err := s.management.command("version"); err == nil {
+      r.Found = append(r.Found, "management "+s.management.address)
+    } else {
+      r.Missing = append(r.Missing, "management "+s.management.address)
+    }
+  }
+
+  if s.profiles != "" {
+    if !r.File(s.profiles) {
+      return r.Score(0, "no profiles directory %v", s.profiles)
+    }
+    s.config = activeConfig
+    profiles, err := s.listProfiles()
+    if err != nil {
+      return r.Score(0, "cannot list profiles in %v: %v", s.profiles, err)
+    }
+    if len(profiles) == 0 {
+      return r.Score(0, "no .conf or .ovpn files found in %v", s.profiles)
+    }
+    return r.Score(80, "%d profiles in %v", len(profiles), s.profiles)
+  }
+
+  const configPattern = "/etc/openvpn/*.conf"
+  matches, err := filepath.Glob(configPattern)
+  if err != nil {
+    return r.Score(0, "%v", err)
+  }
+  for _, e := range matches {
+    r.Found = append(r.Found, "file "+e)
+  }
+  if len(matches) != 1 {
+    return r.Score(0, "found %v %v files; want 1", len(matches), configPattern)
+  }
+  c, err := readConfig(matches[0])
+  if err != nil {
+    return r.Score(0, "cannot read %v: %v", matches[0], err)
+  }
+  if len(c.remotes) == 0 {
+    return r.Score(10, "no remote in %v", matches[0])
+  }
+  if tunnel {
+    return r.Score(80, "%d remotes in %v, %v up", len(c.remotes), matches[0], device)
+  }
+  return r.Score(60, "%d remotes in %v, %v down", len(c.remotes), matches[0], device)
+}
@@ -0,0 +1,93 @@
+package openvpn
+
+import (
+  "html/template"
+  "io"
+  "sort"
+)
+
+var indexTmpl = template.Must(template.New("").Parse(`<p>Current server: {{.Current}}</p>
+{{with .Status}}
+<ul>
+  <li>state: {{if eq .State "CONNECTED"}}{{.State}}{{else}}<span style="color: red;">{{.State}}</span>{{end}} since {{.Since.Format "2006-01-02 15:04:05"}}</li>
+  <li>remote: {{.RemoteIP}}{{if .RemotePort}} port {{.RemotePort}}{{end}}</li>
+  <li>local: {{.LocalIP}}</li>
+  <li>traffic: {{.BytesIn}} bytes in, {{.BytesOut}} bytes out</li>
+</ul>
+{{end}}
+{{if .StatusError}}
+<p>Error reading management interface: {{.StatusError}}</p>
+{{end}}
+{{if .Profiles}}
+<p>
+Profiles ({{len .Profiles}})
+</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Name</th>
+      <th align="left">Remotes</th>
+      <th align="left">Proto</th>
+      <th align="left">Dev</th>
+      <th align="left">Cipher</th>
+      <th align="left">Switch</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Profiles}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{range $i, $e := .Remotes}}{{if $i}}, {{end}}{{$e}}{{end}}</td>
+      <td>{{.Proto}}</td>
+      <td>{{.Dev}}</td>
+      <td>{{.Cipher}}</td>
+      <td><a href="switch?server={{.Name}}">switch</a></td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+{{else}}
+<p>
+Servers ({{len .Servers}})
+</p>
+<ul>
+{{range .Servers}}<li><a href="switch?server={{.}}">{{.}}</a></li>{{end}}
+</ul>
+{{end}}`))
+
+// Index writes the body of an HTML index page to switch the Server.
+func (s *Server) Index(w io.Writer) error {
+  current, err := s.Current()
+  if err != nil {
+    return err
+  }
+  servers, err := s.List()
+  if err != nil {
+    return err
+  }
+  sort.Strings(servers)
+  var profiles []*profile
+  if s.profiles != "" {
+    if profiles, err = s.listProfiles(); err != nil {
+      return err
+    }
+  }
+  var status *Status
+  var statusError error
+  if s.management != nil {
+    status, statusError = s.Status()
+  }
+  return indexTmpl.Execute(w, struct {
+    Current     string
+    Servers     []string
+    Profiles    []*profile
+    Status      *Status
+    StatusError error
+  }{
+    Current:     current,
+    Servers:     servers,
+    Profiles:    profiles,
+    Status:      status,
+    StatusError: statusError,
+  })
+}
@@ -1,32 +1,22 @@
 package openvpn
 
-import (
-  "bufio"
-  "os"
-  "strings"
-)
-
-// List lists available servers.
+// List lists available servers, as host:port/proto.
+// In profiles mode, it lists profile names.
 func (s *Server) List() ([]string, error) {
-  f, err := os.Open(s.config)
-  if err != nil {
-    return nil, err
-  }
-  defer f.Close()
-
-  var servers []string
-  scanner := bufio.NewScanner(f)
-  for scanner.Scan() {
-    t := strings.TrimPrefix(scanner.Text(), ";")
-    f := strings.Split(t, " ")
-    if len(f) < 3 || f[0] != "remote" {
-      continue
+  if s.profiles != "" {
+    profiles, err := s.listProfiles()
+    if err != nil {
+      return nil, err
+    }
+    var servers []string
+    for _, p := range profiles {
+      servers = append(servers, p.Name)
     }
-    servers = append(servers, f[1])
+    return servers, nil
   }
-
-  if err := scanner.Err(); err != nil {
+  c, err := readConfig(s.config)
+  if err != nil {
     return nil, err
   }
-  return servers, nil
+  return c.list(), nil
 }
@@ -0,0 +1,173 @@
+package openvpn
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "net"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// https://openvpn.net/community-resources/management-interface/
+const managementTimeout = 5 * time.Second
+
+// ErrNoManagement is returned by what needs the management interface when it
+// is not configured.
+var ErrNoManagement = errors.New("openvpn management interface not configured")
+
+// management is a client for the OpenVPN management interface.
+type management struct {
+  network string
+  address string
+}
+
+// newManagement creates a management client for addr, which is either a
+// host:port or a unix socket path.
+func newManagement(addr string) *management {
+  if strings.HasPrefix(addr, "/") {
+    return &management{network: "unix", address: addr}
+  }
+  return &management{network: "tcp", address: addr}
+}
+
+// command sends a command and returns its response lines.
+// Single-line responses (SUCCESS:) are returned without the prefix,
+// multi-line responses without the final END.
+func (m *management) command(cmd string) ([]string, error) {
+  conn, err := net.DialTimeout(m.network, m.address, managementTimeout)
+  if err != nil {
+    return nil, err
+  }
+  defer conn.Close()
+  if err := conn.SetDeadline(time.Now().Add(managementTimeout)); err != nil {
+    return nil, err
+  }
+  if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+    return nil, err
+  }
+
+  var lines []string
+  scanner := bufio.NewScanner(conn)
+  for scanner.Scan() {
+    line := strings.TrimRight(scanner.Text(), "\r")
+    // real-time notifications, including the greeting
+    if strings.HasPrefix(line, ">") {
+      continue
+    }
+    if len(lines) == 0 {
+      if strings.HasPrefix(line, "SUCCESS:") {
+        return []string{strings.TrimSpace(strings.TrimPrefix(line, "SUCCESS:"))}, nil
+      }
+      if strings.HasPrefix(line, "ERROR:") {
+        return nil, fmt.Errorf("openvpn management: %v: %v", cmd, strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+      }
+    }
+    if line == "END" {
+      return lines, nil
+    }
+    lines = append(lines, line)
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+  return nil, fmt.Errorf("openvpn management: %v: unexpected end of response", cmd)
+}
+
+// Status is the state of the connection as reported by the management interface.
+type Status struct {
+  State      string    `json:"state"` // e.g. CONNECTED, RECONNECTING, WAIT
+  Since      time.Time `json:"since"`
+  LocalIP    string    `json:"local_ip"`
+  RemoteIP   string    `json:"remote_ip"`
+  RemotePort int       `json:"remote_port"`
+  BytesIn    int64     `json:"bytes_in"`
+  BytesOut   int64     `json:"bytes_out"`
+}
+
+// state returns the current state, from e.g.
+// 1700000000,CONNECTED,SUCCESS,10.8.0.6,198.51.100.1,1194,,
+func (m *management) state(st *Status) error {
+  lines, err := m.command("state")
+  if err != nil {
+    return err
+  }
+  if len(lines) == 0 {
+    return fmt.Errorf("openvpn management: empty state")
+  }
+  f := strings.Split(lines[len(lines)-1], ",")
+  if len(f) < 2 {
+    return fmt.Errorf("openvpn management: invalid state %q", lines[len(lines)-1])
+  }
+  if ts, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+    st.Since = time.Unix(ts, 0)
+  }
+  st.State = f[1]
+  if len(f) > 3 {
+    st.LocalIP = f[3]
+  }
+  if len(f) > 4 {
+    st.RemoteIP = f[4]
+  }
+  if len(f) > 5 {
+    st.RemotePort, _ = strconv.Atoi(f[5])
+  }
+  return nil
+}
+
+// loadStats returns byte counts, from e.g.
+// SUCCESS: nclients=0,bytesin=1234,bytesout=5678
+func (m *management) loadStats(st *Status) error {
+  lines, err := m.command("load-stats")
+  if err != nil {
+    return err
+  }
+  if len(lines) != 1 {
+    return fmt.Errorf("openvpn management: invalid load-stats response")
+  }
+  for _, kv := range strings.Split(lines[0], ",") {
+    k, v, _ := strings.Cut(kv, "=")
+    n, err := strconv.ParseInt(v, 10, 64)
+    if err != nil {
+      continue
+    }
+    switch k {
+    case "bytesin":
+      st.BytesIn = n
+    case "bytesout":
+      st.BytesOut = n
+    }
+  }
+  return nil
+}
+
+// signal sends a signal to the daemon: SIGHUP re-reads the config and
+// restarts the connection, SIGUSR1 reconnects with the same config.
+func (m *management) signal(sig string) error {
+  _, err := m.command("signal " + sig)
+  return err
+}
+
+// Status returns the connection state from the management interface.
+func (s *Server) Status() (*Status, error) {
+  if s.management == nil {
+    return nil, ErrNoManagement
+  }
+  var st Status
+  if err := s.management.state(&st); err != nil {
+    return nil, err
+  }
+  if err := s.management.loadStats(&st); err != nil {
+    return nil, err
+  }
+  return &st, nil
+}
+
+// Reconnect reconnects to the current server without restarting the service.
+func (s *Server) Reconnect() error {
+  if s.management == nil {
+    return ErrNoManagement
+  }
+  return s.management.signal("SIGUSR1")
+}
@@ -0,0 +1,140 @@
+package openvpn
+
+import (
+  "bufio"
+  "fmt"
+  "net"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+)
+
+// fakeManagement is a fake OpenVPN management interface.
+type fakeManagement struct {
+  ln net.Listener
+
+  m        sync.Mutex // protects below
+  state    string
+  commands []string
+}
+
+func newFakeManagement(t *testing.T) *fakeManagement {
+  ln, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatal(err)
+  }
+  f := &fakeManagement{
+    ln:    ln,
+    state: "1700000000,CONNECTED,SUCCESS,10.8.0.6,198.51.100.1,1194,,",
+  }
+  t.Cleanup(func() { ln.Close() })
+  go f.serve()
+  return f
+}
+
+func (f *fakeManagement) serve() {
+  for {
+    conn, err := f.ln.Accept()
+    if err != nil {
+      return
+    }
+    go f.handle(conn)
+  }
+}
+
+func (f *fakeManagement) handle(conn net.Conn) {
+  defer conn.Close()
+  fmt.Fprintf(conn, ">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info\r\n")
+  scanner := bufio.NewScanner(conn)
+  for scanner.Scan() {
+    cmd := scanner.Text()
+    f.m.Lock()
+    f.commands = append(f.commands, cmd)
+    state := f.state
+    f.m.Unlock()
+    // notifications can be interleaved with responses
+    fmt.Fprintf(conn, ">BYTECOUNT:1,2\r\n")
+    switch {
+    case cmd == "state":
+      fmt.Fprintf(conn, "%s\r\nEND\r\n", state)
+    case cmd == "load-stats":
+      fmt.Fprintf(conn, "SUCCESS: nclients=0,bytesin=1234,bytesout=5678\r\n")
+    case strings.HasPrefix(cmd, "signal "):
+      fmt.Fprintf(conn, "SUCCESS: %s thrown\r\n", strings.TrimPrefix(cmd, "signal "))
+    default:
+      fmt.Fprintf(conn, "ERROR: unknown command, enter 'help' for more options\r\n")
+    }
+  }
+}
+
+func (f *fakeManagement) lastCommand() string {
+  f.m.Lock()
+  defer f.m.Unlock()
+  if len(f.commands) == 0 {
+    return ""
+  }
+  return f.commands[len(f.commands)-1]
+}
+
+func TestManagementStatus(t *testing.T) {
+  f := newFakeManagement(t)
+  s := &Server{management: newManagement(f.ln.Addr().String())}
+  got, err := s.Status()
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := Status{
+    State:      "CONNECTED",
+    Since:      time.Unix(1700000000, 0),
+    LocalIP:    "10.8.0.6",
+    RemoteIP:   "198.51.100.1",
+    RemotePort: 1194,
+    BytesIn:    1234,
+    BytesOut:   5678,
+  }
+  if *got != want {
+    t.Errorf("Status() = %+v; want %+v", *got, want)
+  }
+}
+
+func TestManagementError(t *testing.T) {
+  f := newFakeManagement(t)
+  m := newManagement(f.ln.Addr().String())
+  if _, err := m.command("bogus"); err == nil {
+    t.Error("command(bogus): got nil error, want error")
+  }
+}
+
+func TestManagementSwitch(t *testing.T) {
+  f := newFakeManagement(t)
+  config := filepath.Join(t.TempDir(), "client.conf")
+  if err := os.WriteFile(config, []byte("client\nremote 198.51.100.1 1194 udp\n;remote 198.51.100.2 1194 udp\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  s := &Server{config: config, management: newManagement(f.ln.Addr().String())}
+
+  current, err := s.Current()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := "198.51.100.1:1194/udp"; current != want {
+    t.Errorf("Current() = %v; want %v", current, want)
+  }
+
+  if err := s.Switch("198.51.100.2:1194/udp"); err != nil {
+    t.Fatal(err)
+  }
+  if got := f.lastCommand(); got != "signal SIGHUP" {
+    t.Errorf("last command = %q; want signal SIGHUP", got)
+  }
+  b, err := os.ReadFile(config)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := "client\n;remote 198.51.100.1 1194 udp\nremote 198.51.100.2 1194 udp\n"; string(b) != want {
+    t.Errorf("config = %q; want %q", b, want)
+  }
+}
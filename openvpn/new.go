@@ -2,11 +2,32 @@ package openvpn
 
 import (
   "fmt"
+  "os"
   "path/filepath"
 )
 
 // New creates a new Server to switch an OpenVPN server.
-func New() (*Server, error) {
+func New(options ...Option) (*Server, error) {
+  s := &Server{}
+  for _, option := range options {
+    option(s)
+  }
+
+  if s.profiles != "" {
+    if _, err := os.Stat(s.profiles); err != nil {
+      return nil, err
+    }
+    s.config = activeConfig
+    profiles, err := s.listProfiles()
+    if err != nil {
+      return nil, err
+    }
+    if len(profiles) == 0 {
+      return nil, fmt.Errorf("no .conf or .ovpn files found in %v", s.profiles)
+    }
+    return s, nil
+  }
+
   const configPattern = "/etc/openvpn/*.conf"
   matches, err := filepath.Glob(configPattern)
   if err != nil {
@@ -15,13 +36,35 @@ func New() (*Server, error) {
   if len(matches) == 0 || len(matches) > 1 {
     return nil, fmt.Errorf("found %v %v files; want 1", len(matches), configPattern)
   }
-  return &Server{
-    config: matches[0],
-  }, nil
+  s.config = matches[0]
+  return s, nil
+}
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithManagement uses the OpenVPN management interface at addr, either
+// host:port or a unix socket path, to read the connection state and to
+// reconnect without restarting the service.
+func WithManagement(addr string) Option {
+  return func(s *Server) {
+    s.management = newManagement(addr)
+  }
+}
+
+// WithProfiles switches between the configs in dir (.conf and .ovpn, including
+// subdirectories) instead of the remotes of a single config: each config is
+// a server, copied into place as /etc/openvpn/switchman.conf when switching.
+func WithProfiles(dir string) Option {
+  return func(s *Server) {
+    s.profiles = dir
+  }
 }
 
 // A Server implements the ability to switch an OpenVPN server.
-// It implements the Switchable interface.
+// It implements the Switchable and Indexable interfaces.
 type Server struct {
-  config string
+  config     string
+  management *management // optional
+  profiles   string      // optional directory of configs
 }
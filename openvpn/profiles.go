@@ -0,0 +1,101 @@
+package openvpn
+
+import (
+  "fmt"
+  "io/fs"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/StalkR/switchman/profiledir"
+)
+
+// In profiles mode, each config in a directory is a server, and switching
+// copies it into place as the active config, with a marker line to identify
+// it and a cd directive so its relative paths still resolve.
+const activeConfig = "/etc/openvpn/switchman.conf"
+
+// A profile is an OpenVPN config in the profiles directory.
+type profile struct {
+  Name    string // path relative to the directory, without extension
+  Path    string
+  Remotes []string
+  Dev     string
+  Proto   string
+  Cipher  string
+}
+
+// listProfiles finds .conf and .ovpn files in the profiles directory,
+// including subdirectories such as client/, and parses their metadata.
+func (s *Server) listProfiles() ([]*profile, error) {
+  var profiles []*profile
+  seen := map[string]bool{}
+  err := filepath.WalkDir(s.profiles, func(path string, d fs.DirEntry, err error) error {
+    if err != nil {
+      return err
+    }
+    ext := filepath.Ext(path)
+    if d.IsDir() || (ext != ".conf" && ext != ".ovpn") || path == s.config {
+      return nil
+    }
+    rel, err := filepath.Rel(s.profiles, path)
+    if err != nil {
+      return err
+    }
+    name := strings.TrimSuffix(rel, ext)
+    if seen[name] {
+      return nil
+    }
+    seen[name] = true
+    c, err := readConfig(path)
+    if err != nil {
+      return err
+    }
+    cipher := c.option("data-ciphers")
+    if cipher == "" {
+      cipher = c.option("cipher")
+    }
+    p := &profile{
+      Name:    name,
+      Path:    path,
+      Remotes: c.list(),
+      Dev:     c.option("dev"),
+      Proto:   c.option("proto"),
+      Cipher:  cipher,
+    }
+    profiles = append(profiles, p)
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  return profiles, nil
+}
+
+// switchProfile copies the profile into place as the active config, after
+// backing up a config not put in place by a switch.
+func (s *Server) switchProfile(name string) error {
+  profiles, err := s.listProfiles()
+  if err != nil {
+    return err
+  }
+  var p *profile
+  for _, e := range profiles {
+    if e.Name == name {
+      p = e
+      break
+    }
+  }
+  if p == nil {
+    return fmt.Errorf("profile %v not found", name)
+  }
+  b, err := os.ReadFile(p.Path)
+  if err != nil {
+    return err
+  }
+  dir, err := filepath.Abs(filepath.Dir(p.Path))
+  if err != nil {
+    return err
+  }
+  return profiledir.Install(s.config, p.Name, append([]byte(fmt.Sprintf("cd %q\n", dir)), b...))
+}
@@ -0,0 +1,92 @@
+package openvpn
+
+import (
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestProfiles(t *testing.T) {
+  dir := t.TempDir()
+  for name, content := range map[string]string{
+    "se-got.conf":        "client\ndev tun\nproto udp\nremote se-got.example.com 1194\ncipher AES-256-GCM\n",
+    "client/us-nyc.ovpn": "client\ndev tun0\nremote us-nyc.example.com 443 tcp\n",
+    "README.txt":         "not a config\n",
+  } {
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+      t.Fatal(err)
+    }
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  s := &Server{profiles: dir, config: filepath.Join(dir, "active.conf")}
+
+  servers, err := s.List()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := []string{"client/us-nyc", "se-got"}; !reflect.DeepEqual(servers, want) {
+    t.Errorf("List() = %q; want %q", servers, want)
+  }
+  profiles, err := s.listProfiles()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if p := profiles[1]; p.Cipher != "AES-256-GCM" || p.Proto != "udp" || !reflect.DeepEqual(p.Remotes, []string{"se-got.example.com:1194/udp"}) {
+    t.Errorf("profile se-got = %+v", p)
+  }
+
+  current, err := s.Current()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if current != "" {
+    t.Errorf("Current() before switch = %q; want empty", current)
+  }
+  if err := s.switchProfile("client/us-nyc"); err != nil {
+    t.Fatal(err)
+  }
+  current, err = s.Current()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if current != "client/us-nyc" {
+    t.Errorf("Current() = %q; want client/us-nyc", current)
+  }
+  b, err := os.ReadFile(s.config)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := "cd \"" + filepath.Join(dir, "client") + "\"\nclient\n"; !strings.Contains(string(b), want) {
+    t.Errorf("active config = %q; want it to contain %q", b, want)
+  }
+  servers, err = s.List()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(servers) != 2 {
+    t.Errorf("List() after switch = %q; want active config excluded", servers)
+  }
+
+  // a hand-maintained active config is backed up, but never a second one
+  manual := "client\nremote 198.51.100.9\n"
+  if err := os.WriteFile(s.config, []byte(manual), 0600); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.switchProfile("client/us-nyc"); err != nil {
+    t.Fatal(err)
+  }
+  if b, err := os.ReadFile(s.config + ".orig"); err != nil || string(b) != manual {
+    t.Errorf("active.conf.orig = %q, %v; want %q", b, err, manual)
+  }
+  if err := os.WriteFile(s.config, []byte(manual), 0600); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.switchProfile("client/us-nyc"); err == nil {
+    t.Errorf("switchProfile() over a config without marker and a backup = nil; want error")
+  }
+}
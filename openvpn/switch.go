@@ -5,29 +5,14 @@ import (
   "os"
   "os/exec"
   "path/filepath"
-  "regexp"
   "strings"
   "time"
 )
 
-var disableRemoteRE = regexp.MustCompile("(?m)^(remote .*)$")
-
-// Switch switches to the specified server.
+// Switch switches to the specified server, as host:port/proto.
+// It enables its remote line or connection block and disables the others.
+// In profiles mode, server is a profile name and its config is put in place.
 func (s *Server) Switch(server string) error {
-  found := false
-  list, err := s.List()
-  if err != nil {
-    return err
-  }
-  for _, n := range list {
-    if n == server {
-      found = true
-      break
-    }
-  }
-  if !found {
-    return fmt.Errorf("server %v not found", server)
-  }
   current, err := s.Current()
   if err != nil {
     return err
@@ -36,25 +21,56 @@ func (s *Server) Switch(server string) error {
     return nil // not an error, just nothing to do
   }
 
-  b, err := os.ReadFile(s.config)
-  if err != nil {
-    return err
-  }
-  b = disableRemoteRE.ReplaceAll(b, []byte(";$1"))
-  enableRE, err := regexp.Compile("(?m)^;(remote " + regexp.QuoteMeta(server) + " .*)$")
-  if err != nil {
-    return err
-  }
-  b = enableRE.ReplaceAll(b, []byte("$1"))
-  if err := os.WriteFile(s.config, b, 0644); err != nil {
-    return err
+  if s.profiles != "" {
+    if err := s.switchProfile(server); err != nil {
+      return err
+    }
+  } else {
+    c, err := readConfig(s.config)
+    if err != nil {
+      return err
+    }
+    b, err := c.enable(server)
+    if err != nil {
+      return err
+    }
+    if err := os.WriteFile(s.config, []byte(b), 0644); err != nil {
+      return err
+    }
   }
 
+  if s.management != nil {
+    // re-reads the config and restarts the connection, not the service
+    return s.management.signal("SIGHUP")
+  }
   return restartOpenVPN(s.config)
 }
 
 const device = "tun0"
 
+// Device returns the network device of the tunnel.
+func (s *Server) Device() (string, error) {
+  return device, nil
+}
+
+// Endpoints returns the endpoints of a server: the server itself, or the
+// remotes of the profile in profiles mode.
+func (s *Server) Endpoints(server string) ([]string, error) {
+  if s.profiles == "" {
+    return []string{server}, nil
+  }
+  profiles, err := s.listProfiles()
+  if err != nil {
+    return nil, err
+  }
+  for _, p := range profiles {
+    if p.Name == server {
+      return p.Remotes, nil
+    }
+  }
+  return nil, fmt.Errorf("profile %v not found", server)
+}
+
 func restartOpenVPN(config string) error {
   if out, err := exec.Command("invoke-rc.d", "openvpn", "stop").CombinedOutput(); err != nil {
     return fmt.Errorf("could not stop openvpn: %v - %v", err, string(out))
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID returns the uid of the process at the other end of a unix socket
+// connection, from its credentials (SO_PEERCRED).
+func peerUID(c *net.UnixConn) (int, bool) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
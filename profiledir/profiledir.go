@@ -0,0 +1,80 @@
+// Package profiledir puts a config of a profiles directory into place as the
+// active config of a backend, with a marker line to identify it, without
+// destroying a hand-maintained config nor leaving a partial one.
+package profiledir
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Marker starts the first line of a config put into place, followed by the
+// name of its profile.
+const Marker = "# switchman profile: "
+
+// Current returns the name of the profile of the active config, from its
+// marker, empty if it has none or does not exist.
+func Current(config string) (string, error) {
+	f, err := os.Open(config)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() && strings.HasPrefix(scanner.Text(), Marker) {
+		return strings.TrimPrefix(scanner.Text(), Marker), nil
+	}
+	return "", scanner.Err()
+}
+
+// Install puts the content of a profile into place as the active config,
+// after its marker and backing up a config not put into place by Install.
+func Install(config, name string, b []byte) error {
+	if err := backup(config); err != nil {
+		return err
+	}
+	return writeFile(config, append([]byte(Marker+name+"\n"), b...), 0600)
+}
+
+// backup copies the active config to .orig if it has no marker, so the first
+// switch does not destroy a hand-maintained config. It refuses to overwrite
+// a previous backup.
+func backup(config string) error {
+	current, err := Current(config)
+	if err != nil || current != "" {
+		return err
+	}
+	b, err := os.ReadFile(config)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(config+".orig", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%v is not a profile and %v.orig exists, move one of them away", config, config)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFile writes then renames to never leave a partial file.
+func writeFile(path string, b []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,47 @@
+package profiledir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstall(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "wg0.conf")
+	if current, err := Current(config); err != nil || current != "" {
+		t.Errorf("Current(missing) = %q, %v; want empty", current, err)
+	}
+	if err := Install(config, "se", []byte("[Interface]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(config + ".orig"); !os.IsNotExist(err) {
+		t.Errorf("backup of missing config: %v; want none", err)
+	}
+	if b, err := os.ReadFile(config); err != nil || string(b) != Marker+"se\n[Interface]\n" {
+		t.Errorf("config = %q, %v; want marker then profile", b, err)
+	}
+	if current, err := Current(config); err != nil || current != "se" {
+		t.Errorf("Current() = %q, %v; want se", current, err)
+	}
+
+	// a hand-maintained config is backed up once
+	manual := "[Interface]\n# by hand\n"
+	if err := os.WriteFile(config, []byte(manual), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(config, "us", nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(config + ".orig"); err != nil || string(b) != manual {
+		t.Errorf("backup = %q, %v; want %q", b, err, manual)
+	}
+	if err := os.WriteFile(config, []byte(manual), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(config, "us", nil); err == nil {
+		t.Errorf("Install() over a config without marker and a backup = nil; want error")
+	}
+	if _, err := os.Stat(config + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
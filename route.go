@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/switchman/routing"
+)
+
+// routingTableBase is the first routing table, and mark, used for tunnels.
+const routingTableBase = 1000
+
+// A router routes LAN clients through the tunnel of their choice, and
+// switches the server of each tunnel with its own backend.
+type router struct {
+	tunnels  []routing.Tunnel
+	backends map[string]Switchable // by tunnel name, nil if it cannot be switched
+	kinds    map[string]string     // backend requested for each tunnel, by name
+	defaults map[string]string     // configured clients to tunnel
+	state    *stateFile            // clients which chose their tunnel
+
+	m sync.Mutex // serializes applying
+}
+
+// A tunnelBackend creates the backend switching the tunnel of a device, of
+// a kind (mullvad, wireguard) or the default if empty, nil if none.
+type tunnelBackend func(device, kind string) (Switchable, error)
+
+// newRouter creates a router from tunnels as name=device or
+// name=device/backend and clients as client=tunnel, with client an IP or MAC.
+func newRouter(tunnels, clients []string, st *stateFile, backend tunnelBackend) (*router, error) {
+	r := &router{
+		backends: map[string]Switchable{},
+		kinds:    map[string]string{},
+		defaults: map[string]string{},
+		state:    st,
+	}
+	names := map[string]bool{}
+	for i, e := range tunnels {
+		name, device, ok := strings.Cut(e, "=")
+		device, kind, _ := strings.Cut(device, "/")
+		if !ok || name == "" || device == "" {
+			return nil, fmt.Errorf("invalid tunnel %q, want name=device or name=device/backend", e)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate tunnel %v", name)
+		}
+		names[name] = true
+		b, err := backend(device, kind)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel %v: %v", name, err)
+		}
+		r.tunnels = append(r.tunnels, routing.Tunnel{Name: name, Device: device, Table: routingTableBase + i})
+		r.backends[name] = b
+		r.kinds[name] = kind
+	}
+	for _, e := range clients {
+		client, tunnel, ok := strings.Cut(e, "=")
+		if !ok || !routing.ValidClient(client) {
+			return nil, fmt.Errorf("invalid client %q, want ip=tunnel or mac=tunnel", e)
+		}
+		if !names[tunnel] {
+			return nil, fmt.Errorf("client %v: unknown tunnel %v", client, tunnel)
+		}
+		r.defaults[normalizeClient(client)] = tunnel
+	}
+	return r, nil
+}
+
+// normalizeClient returns the canonical form of a client IP or MAC.
+func normalizeClient(client string) string {
+	if mac, err := net.ParseMAC(client); err == nil {
+		return mac.String()
+	}
+	if ip := net.ParseIP(client); ip != nil {
+		return ip.String()
+	}
+	return client
+}
+
+// clients returns the tunnel of each client: configured, unless it chose.
+func (r *router) clients() map[string]string {
+	clients := map[string]string{}
+	for client, tunnel := range r.defaults {
+		clients[client] = tunnel
+	}
+	r.state.get(func(st *state) {
+		for client, tunnel := range st.Clients {
+			if tunnel == "" {
+				delete(clients, client) // chose the default route
+				continue
+			}
+			clients[client] = tunnel
+		}
+	})
+	return clients
+}
+
+// applyRouting applies routing, replaced in tests.
+var applyRouting = routing.Apply
+
+func (r *router) apply() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return applyRouting(r.tunnels, r.clients())
+}
+
+// periodicallyApply applies routing again in case tunnels were recreated,
+// until ctx is done.
+func (r *router) periodicallyApply(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := r.apply(); err != nil {
+			log.Printf("routing: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// set routes a client through a tunnel, or the default route if empty.
+func (r *router) set(client, tunnel string) error {
+	if tunnel != "" && r.tunnel(tunnel) == nil {
+		return fmt.Errorf("unknown tunnel %v", tunnel)
+	}
+	if err := r.state.update(func(st *state) {
+		if st.Clients == nil {
+			st.Clients = map[string]string{}
+		}
+		st.Clients[client] = tunnel
+	}); err != nil {
+		return err
+	}
+	return r.apply()
+}
+
+// backend returns the backend of a tunnel of a device and kind, nil if none,
+// to keep it on reload.
+func (r *router) backend(device, kind string) Switchable {
+	for _, t := range r.tunnels {
+		if t.Device == device && r.kinds[t.Name] == kind {
+			return r.backends[t.Name]
+		}
+	}
+	return nil
+}
+
+func (r *router) tunnel(name string) *routing.Tunnel {
+	for i := range r.tunnels {
+		if r.tunnels[i].Name == name {
+			return &r.tunnels[i]
+		}
+	}
+	return nil
+}
+
+// identify returns the client making the request, by MAC if known as it
+// survives address changes, otherwise by IP, and its tunnel.
+func (r *router) identify(req *http.Request) (ip, mac, client, tunnel string) {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	ip = normalizeClient(ip)
+	mac = routing.Neighbor(ip)
+	if mac != "" {
+		mac = normalizeClient(mac)
+	}
+	clients := r.clients()
+	switch {
+	case mac != "" && clients[mac] != "":
+		return ip, mac, mac, clients[mac]
+	case clients[ip] != "":
+		return ip, mac, ip, clients[ip]
+	case mac != "":
+		return ip, mac, mac, ""
+	}
+	return ip, mac, ip, ""
+}
+
+// routeAudit describes a client routed through a tunnel for the audit log.
+func routeAudit(client, tunnel string) string {
+	if tunnel == "" {
+		tunnel = "default route"
+	}
+	return fmt.Sprintf("%s via %s", client, tunnel)
+}
+
+var routeTmpl = template.Must(template.New("").Parse(`<p>Your address: {{.IP}}{{if .MAC}} ({{.MAC}}){{end}}</p>
+<p>Your exit: {{if .Tunnel}}{{.Tunnel}}{{else}}default route{{end}}</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Tunnel</th>
+      <th align="left">Device</th>
+      <th align="left">Server</th>
+      <th align="left">Use</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Tunnels}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Device}}</td>
+      <td>
+        {{if .Error}}<span style="color: red;">{{.Error}}</span>
+        {{else if .Servers}}
+        <form action="route">
+          <input type="hidden" name="switch" value="{{.Name}}">
+          <select name="server">
+            {{$current := .Current}}
+            {{range .Servers}}<option{{if eq . $current}} selected{{end}}>{{.}}</option>{{end}}
+          </select>
+          <input type="submit" value="switch">
+        </form>
+        {{end}}
+      </td>
+      <td>{{if eq .Name $.Tunnel}}in use{{else}}<a href="route?tunnel={{.Name}}">use</a>{{end}}</td>
+    </tr>
+    {{end}}
+    <tr>
+      <td>default route</td>
+      <td></td>
+      <td></td>
+      <td>{{if not .Tunnel}}in use{{else}}<a href="route?tunnel=">use</a>{{end}}</td>
+    </tr>
+  </tbody>
+</table>`))
+
+// note: no xsrf protection
+func (s *server) handleRoute(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/route" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.route == nil {
+		http.Error(w, "routing not enabled", http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Has("switch") {
+		if err := s.switchTunnel(r, r.URL.Query().Get("switch"), r.URL.Query().Get("server")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		done(w, r)
+		return
+	}
+	ip, mac, client, tunnel := s.route.identify(r)
+	if r.URL.Query().Has("tunnel") {
+		start := time.Now()
+		to := r.URL.Query().Get("tunnel")
+		err := s.route.set(client, to)
+		if s.audit != nil {
+			// the client may be identified by MAC rather than the remote address
+			s.audit.record(newChange(s.requestOrigin(r, "route"), "routing", routeAudit(client, tunnel), routeAudit(client, to), time.Since(start), err))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		done(w, r)
+		return
+	}
+
+	type tunnelView struct {
+		routing.Tunnel
+		Current string
+		Servers []string
+		Error   error
+	}
+	var tunnels []tunnelView
+	for _, t := range s.route.tunnels {
+		v := tunnelView{Tunnel: t}
+		if b := s.route.backends[t.Name]; b != nil {
+			if v.Current, v.Error = b.Current(); v.Error == nil {
+				v.Servers, v.Error = b.List()
+				sort.Strings(v.Servers)
+			}
+		}
+		tunnels = append(tunnels, v)
+	}
+	var content bytes.Buffer
+	if err := routeTmpl.Execute(&content, struct {
+		IP      string
+		MAC     string
+		Tunnel  string
+		Tunnels []tunnelView
+	}{
+		IP:      ip,
+		MAC:     mac,
+		Tunnel:  tunnel,
+		Tunnels: tunnels,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	if err := page(w, s, content.String()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// switchTunnel switches the server of a tunnel with its backend, like from
+// the index with its hooks, events and metrics, which also applies routing
+// again as the device was recreated. Only the tunnel of the backend of the
+// server has its exit and leaks checked.
+func (s *server) switchTunnel(r *http.Request, name, server string) error {
+	if s.route.tunnel(name) == nil {
+		return fmt.Errorf("unknown tunnel %v", name)
+	}
+	b := s.route.backends[name]
+	if b == nil {
+		return fmt.Errorf("tunnel %v cannot be switched", name)
+	}
+	if b == s.Switchable {
+		return s.switchServer(s.requestOrigin(r, "switch"), server)
+	}
+	return s.switchBackend(s.requestOrigin(r, "tunnel"), b, server)
+}
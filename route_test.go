@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StalkR/switchman/routing"
+)
+
+// noBackend creates no backend for tunnels, and fails for unknown kinds.
+func noBackend(device, kind string) (Switchable, error) {
+	if kind != "" {
+		return nil, fmt.Errorf("unknown backend %v", kind)
+	}
+	return nil, nil
+}
+
+// fakeTunneled is a Switchable reporting its device.
+type fakeTunneled struct {
+	fakeSwitchable
+	device string
+}
+
+func (f *fakeTunneled) Device() (string, error) { return f.device, nil }
+
+func TestCheckTunnels(t *testing.T) {
+	s := &fakeTunneled{device: "wg0"}
+	if err := checkTunnels(s, []routing.Tunnel{{Name: "se", Device: "wg0"}}); err != nil {
+		t.Errorf("checkTunnels(wg0) = %v; want nil", err)
+	}
+	if err := checkTunnels(s, []routing.Tunnel{{Name: "se", Device: "wg0"}, {Name: "us", Device: "wg1"}}); err == nil || !strings.Contains(err.Error(), "tunnel us through wg1") {
+		t.Errorf("checkTunnels(wg0, wg1) = %v; want error of tunnel us", err)
+	}
+}
+
+func TestRouterClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRouter([]string{"se=wg0", "us=wg1"}, []string{"192.168.1.10=se", "AA:BB:CC:DD:EE:FF=us"}, st, noBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.update(func(st *state) {
+		st.Clients = map[string]string{"192.168.1.10": "", "192.168.1.11": "us"}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"aa:bb:cc:dd:ee:ff": "us", "192.168.1.11": "us"}
+	if got := r.clients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("clients() = %v; want %v", got, want)
+	}
+
+	// persisted
+	st, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	st.get(func(st *state) { got = st.Clients })
+	if want := map[string]string{"192.168.1.10": "", "192.168.1.11": "us"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded clients = %v; want %v", got, want)
+	}
+
+	for _, tt := range []struct {
+		tunnels, clients []string
+	}{
+		{[]string{"se"}, nil},
+		{[]string{"se=wg0", "se=wg1"}, nil},
+		{[]string{"se=wg0"}, []string{"192.168.1.10=us"}},
+		{[]string{"se=wg0"}, []string{"nope=se"}},
+		{[]string{"se=wg0/nope"}, nil},
+	} {
+		if _, err := newRouter(tt.tunnels, tt.clients, st, noBackend); err == nil {
+			t.Errorf("newRouter(%q, %q): got nil error, want error", tt.tunnels, tt.clients)
+		}
+	}
+}
+
+func TestRouteSwitch(t *testing.T) {
+	var applied int
+	prev := applyRouting
+	defer func() { applyRouting = prev }()
+	applyRouting = func([]routing.Tunnel, map[string]string) error {
+		applied++
+		return nil
+	}
+
+	st, err := loadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := &fakeSwitchable{current: "se1", servers: []string{"se1", "se2"}}
+	us := &fakeSwitchable{current: "us1", servers: []string{"us1", "us2"}}
+	s := newServer(main)
+	s.route, err = newRouter([]string{"se=wg0", "us=wg1/wireguard", "vpn=tun0"}, nil, st, func(device, kind string) (Switchable, error) {
+		switch device {
+		case "wg0":
+			return main, nil
+		case "wg1":
+			return us, nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.handler()
+
+	for _, tt := range []struct {
+		query string
+		code  int
+	}{
+		{"switch=us&server=us2", http.StatusOK},
+		{"switch=se&server=se2", http.StatusOK},
+		{"switch=us&server=nope", http.StatusInternalServerError},
+		{"switch=vpn&server=x", http.StatusInternalServerError},
+		{"switch=nope&server=x", http.StatusInternalServerError},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/route?"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("/route?%v: code %v; want %v", tt.query, w.Code, tt.code)
+		}
+	}
+	if us.current != "us2" || main.current != "se2" {
+		t.Errorf("current = %v, %v; want us2, se2", us.current, main.current)
+	}
+	if applied != 2 {
+		t.Errorf("routing applied %d times; want 2, after each switch", applied)
+	}
+	// switches of other tunnels are counted like those of the server
+	if want := map[string]int{"success": 2, "failure": 1}; !reflect.DeepEqual(s.metrics.switches, want) {
+		t.Errorf("switches = %v; want %v", s.metrics.switches, want)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/route", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<option selected>us2</option>") || strings.Count(body, `name="switch"`) != 2 {
+		t.Errorf("/route = %v; want a switch form for se and us, us2 selected", body)
+	}
+}
@@ -0,0 +1,185 @@
+// Package routing routes LAN clients of a gateway through different tunnels
+// with policy routing: clients, identified by source IP or MAC, are marked
+// with nftables, and each mark is routed through its tunnel with ip rules and
+// a routing table per tunnel.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Table is the nftables table marking clients.
+const Table = "inet switchman-routing"
+
+// A Tunnel is a named tunnel clients can be routed through.
+type Tunnel struct {
+	Name   string `json:"name"`
+	Device string `json:"device"`
+	// Table is the routing table of the tunnel, also used as mark.
+	Table int `json:"table"`
+}
+
+// Ruleset returns the nftables ruleset marking clients, a map of client (IP
+// or MAC) to tunnel name, and masquerading what goes out through tunnels.
+// Like the kill switch, it replaces the table atomically.
+func Ruleset(tunnels []Tunnel, clients map[string]string) (string, error) {
+	byName := map[string]Tunnel{}
+	for _, t := range tunnels {
+		byName[t.Name] = t
+	}
+	var ids []string
+	for id := range clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s\n", Table)
+	fmt.Fprintf(&b, "delete table %s\n", Table)
+	fmt.Fprintf(&b, "table %s {\n", Table)
+	b.WriteString("\tchain prerouting {\n")
+	b.WriteString("\t\ttype filter hook prerouting priority mangle; policy accept;\n")
+	for _, id := range ids {
+		t, ok := byName[clients[id]]
+		if !ok {
+			return "", fmt.Errorf("client %v: unknown tunnel %v", id, clients[id])
+		}
+		match, err := matchClient(id)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\t\t%s meta mark set %#x\n", match, t.Table)
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain postrouting {\n")
+	b.WriteString("\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+	for _, t := range tunnels {
+		fmt.Fprintf(&b, "\t\tmeta mark %#x oifname %q masquerade\n", t.Table, t.Device)
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// matchClient returns the nftables match for a client IP or MAC.
+func matchClient(id string) (string, error) {
+	if mac, err := net.ParseMAC(id); err == nil {
+		return fmt.Sprintf("ether saddr %s", mac), nil
+	}
+	addr, err := netip.ParseAddr(id)
+	if err != nil {
+		return "", fmt.Errorf("client %v: not an IP or MAC address", id)
+	}
+	if addr.Is4() {
+		return fmt.Sprintf("ip saddr %s", addr), nil
+	}
+	return fmt.Sprintf("ip6 saddr %s", addr), nil
+}
+
+// ValidClient returns whether a client is an IP or MAC address.
+func ValidClient(id string) bool {
+	_, err := matchClient(id)
+	return err == nil
+}
+
+// Apply marks clients and sets up routing through the tunnels.
+// It must be applied again when a tunnel device is recreated, as its routes
+// are removed with it. Each tunnel is set up independently: one failing, e.g.
+// its device being down, does not prevent the others from being applied, and
+// its errors are returned together. Clients of a failed tunnel are still
+// marked, so their traffic is blackholed by its table rather than leaking out
+// the main route.
+func Apply(tunnels []Tunnel, clients map[string]string) error {
+	// validate everything first, to not apply a partial config
+	ruleset, err := Ruleset(tunnels, clients)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range tunnels {
+		if err := setupTunnel(t); err != nil {
+			errs = append(errs, fmt.Errorf("tunnel %v: %v", t.Name, err))
+		}
+	}
+	if err := nft(ruleset); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// nft applies a ruleset, replaced in tests.
+var nft = func(ruleset string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(ruleset)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v - %v", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ip runs an ip command, replaced in tests.
+var ip = func(args ...string) error {
+	if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %v: %v - %v", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setupTunnel sets up the routing of a tunnel, replaced in tests.
+var setupTunnel = setup
+
+// unreachableMetric is the metric of the unreachable default route of tunnel
+// tables, above the route through the device so it is only used without it.
+const unreachableMetric = "4096"
+
+// setup routes the mark of a tunnel through its table, and the table through
+// its device, for IPv4 and IPv6. The table is first given an unreachable
+// default route, so that when the device is down, or removed with its routes,
+// the traffic of the tunnel is dropped instead of going out the main route.
+func setup(t Tunnel) error {
+	table := fmt.Sprint(t.Table)
+	for _, family := range []string{"-4", "-6"} {
+		if err := ip(family, "route", "replace", "unreachable", "default", "metric", unreachableMetric, "table", table); err != nil {
+			return err
+		}
+		rule := []string{family, "rule", "del", "fwmark", table, "lookup", table, "priority", table}
+		for ip(rule...) == nil {
+			// remove duplicates
+		}
+		rule[2] = "add"
+		if err := ip(rule...); err != nil {
+			return err
+		}
+		if err := ip(family, "route", "replace", "default", "dev", t.Device, "table", table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Neighbor returns the MAC address of a neighbor IP, or empty if unknown.
+func Neighbor(ip string) string {
+	out, err := exec.Command("ip", "neigh", "show", ip).Output()
+	if err != nil {
+		return ""
+	}
+	return parseNeighbor(string(out))
+}
+
+// parseNeighbor parses the MAC from `ip neigh show <ip>`, e.g.
+// 192.168.1.10 dev eth0 lladdr aa:bb:cc:dd:ee:ff REACHABLE
+func parseNeighbor(out string) string {
+	fields := strings.Fields(out)
+	for i, f := range fields {
+		if f == "lladdr" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
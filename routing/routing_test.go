@@ -0,0 +1,151 @@
+package routing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRuleset(t *testing.T) {
+	tunnels := []Tunnel{
+		{Name: "se", Device: "wg0", Table: 1000},
+		{Name: "us", Device: "wg1", Table: 1001},
+	}
+	got, err := Ruleset(tunnels, map[string]string{
+		"192.168.1.10":      "us",
+		"AA:BB:CC:DD:EE:FF": "se",
+		"fd00::10":          "se",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `table inet switchman-routing
+delete table inet switchman-routing
+table inet switchman-routing {
+	chain prerouting {
+		type filter hook prerouting priority mangle; policy accept;
+		ip saddr 192.168.1.10 meta mark set 0x3e9
+		ether saddr aa:bb:cc:dd:ee:ff meta mark set 0x3e8
+		ip6 saddr fd00::10 meta mark set 0x3e8
+	}
+	chain postrouting {
+		type nat hook postrouting priority srcnat; policy accept;
+		meta mark 0x3e8 oifname "wg0" masquerade
+		meta mark 0x3e9 oifname "wg1" masquerade
+	}
+}
+`
+	if got != want {
+		t.Errorf("Ruleset() = %v; want %v", got, want)
+	}
+
+	for _, clients := range []map[string]string{
+		{"192.168.1.10": "nope"},
+		{"not-a-client": "se"},
+	} {
+		if _, err := Ruleset(tunnels, clients); err == nil {
+			t.Errorf("Ruleset(%v): got nil error, want error", clients)
+		}
+	}
+}
+
+func TestApplyTunnelDown(t *testing.T) {
+	prevSetup, prevNFT := setupTunnel, nft
+	defer func() { setupTunnel, nft = prevSetup, prevNFT }()
+	setupTunnel = func(t Tunnel) error {
+		if t.Device == "wg1" {
+			return errors.New("Cannot find device \"wg1\"")
+		}
+		return nil
+	}
+	var applied string
+	nft = func(ruleset string) error {
+		applied = ruleset
+		return nil
+	}
+
+	tunnels := []Tunnel{
+		{Name: "se", Device: "wg0", Table: 1000},
+		{Name: "us", Device: "wg1", Table: 1001},
+	}
+	err := Apply(tunnels, map[string]string{"192.168.1.10": "se", "192.168.1.11": "us"})
+	if err == nil || !strings.Contains(err.Error(), "tunnel us:") {
+		t.Errorf("Apply() = %v; want error of tunnel us", err)
+	}
+	// the healthy tunnel is still applied, and clients of the failed one are
+	// still marked to be blackholed by its table
+	for _, want := range []string{
+		"ip saddr 192.168.1.10 meta mark set 0x3e8",
+		"ip saddr 192.168.1.11 meta mark set 0x3e9",
+	} {
+		if !strings.Contains(applied, want) {
+			t.Errorf("applied ruleset = %v; want %v", applied, want)
+		}
+	}
+
+	applied = ""
+	if err := Apply(tunnels, map[string]string{"192.168.1.10": "nope"}); err == nil || applied != "" {
+		t.Errorf("Apply(unknown tunnel) = %v, applied %q; want error, nothing applied", err, applied)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	prev := ip
+	defer func() { ip = prev }()
+	var cmds []string
+	ip = func(args ...string) error {
+		cmd := strings.Join(args, " ")
+		if strings.Contains(cmd, "rule del") {
+			return errors.New("No such file or directory")
+		}
+		cmds = append(cmds, cmd)
+		if strings.Contains(cmd, "dev wg1") {
+			return errors.New("Cannot find device \"wg1\"")
+		}
+		return nil
+	}
+
+	if err := setup(Tunnel{Name: "se", Device: "wg0", Table: 1000}); err != nil {
+		t.Fatalf("setup() = %v", err)
+	}
+	want := []string{
+		"-4 route replace unreachable default metric 4096 table 1000",
+		"-4 rule add fwmark 1000 lookup 1000 priority 1000",
+		"-4 route replace default dev wg0 table 1000",
+		"-6 route replace unreachable default metric 4096 table 1000",
+		"-6 rule add fwmark 1000 lookup 1000 priority 1000",
+		"-6 route replace default dev wg0 table 1000",
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("setup() ran %q; want %q", cmds, want)
+	}
+
+	// a down device still leaves the mark routed to the unreachable route
+	cmds = nil
+	if err := setup(Tunnel{Name: "us", Device: "wg1", Table: 1001}); err == nil {
+		t.Errorf("setup(down) = nil; want error")
+	}
+	want = []string{
+		"-4 route replace unreachable default metric 4096 table 1001",
+		"-4 rule add fwmark 1001 lookup 1001 priority 1001",
+		"-4 route replace default dev wg1 table 1001",
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("setup(down) ran %q; want %q", cmds, want)
+	}
+}
+
+func TestParseNeighbor(t *testing.T) {
+	for _, tt := range []struct {
+		out  string
+		want string
+	}{
+		{"192.168.1.10 dev eth0 lladdr aa:bb:cc:dd:ee:ff REACHABLE\n", "aa:bb:cc:dd:ee:ff"},
+		{"192.168.1.11 dev eth0  FAILED\n", ""},
+		{"", ""},
+	} {
+		if got := parseNeighbor(tt.out); got != tt.want {
+			t.Errorf("parseNeighbor(%q) = %q; want %q", tt.out, got, tt.want)
+		}
+	}
+}
@@ -1,24 +1,107 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StalkR/switchman/leakcheck"
 )
 
-func serve(s Switchable, listen string) error {
-	srv := &server{s}
-	http.HandleFunc("/", srv.handleIndex)
-	http.HandleFunc("/switch", srv.handleSwitch)
-	http.HandleFunc("/next", srv.handleNext)
-	return http.ListenAndServe(listen, nil)
+// serve serves HTTP on the listen address and, if set, a unix socket
+// restricted to its owner and group.
+func serve(h http.Handler, listen, socket string) error {
+	if socket != "" {
+		os.Remove(socket) // left by a previous run
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(socket, 0660); err != nil {
+			return err
+		}
+		go func() { log.Fatal(unixServer(h).Serve(l)) }()
+	}
+	return http.ListenAndServe(listen, h)
+}
+
+// unixServer returns an HTTP server for the unix socket, recording the user
+// of clients from their credentials.
+func unixServer(h http.Handler) *http.Server {
+	return &http.Server{Handler: h, ConnContext: peerContext}
+}
+
+// handler returns the HTTP handler of the server.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/switch", s.handleSwitch)
+	mux.HandleFunc("/next", s.handleNext)
+	mux.HandleFunc("/set", s.handleSet)
+	mux.HandleFunc("/connect", s.handleControl)
+	mux.HandleFunc("/disconnect", s.handleControl)
+	mux.HandleFunc("/reconnect", s.handleControl)
+	mux.HandleFunc("/check", s.handleCheck)
+	mux.HandleFunc("/route", s.handleRoute)
+	mux.HandleFunc("/api/status", s.handleAPIStatus)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/audit", s.handleAudit)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/favorites", s.handleFavorites)
+	mux.HandleFunc("/diagnostics", s.handleDiagnostics)
+	return mux
+}
+
+// A reloadable serves HTTP with the current server, replaced on reload
+// without dropping the listener.
+type reloadable struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (h *reloadable) set(s *server) {
+	handler := s.handler()
+	h.handler.Store(&handler)
+}
+
+func (h *reloadable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.handler.Load()).ServeHTTP(w, r)
 }
 
 type server struct {
 	Switchable
+	exits *exitChecker // optional
+	leaks *leakChecker // optional
+	kill  *killSwitch  // optional
+	route *router      // optional
+	audit *auditLog    // optional
+	hooks *hooks       // optional
+	state *stateFile   // optional, favorites and groups
+
+	proxies []netip.Prefix // trusted reverse proxies, for the user of requests
+
+	failover *failover // optional
+
+	// kept across reloads
+	metrics   *metrics
+	events    *broker
+	switching *sync.Mutex // serializes switches, also with the previous server
+}
+
+func newServer(s Switchable) *server {
+	return &server{Switchable: s, metrics: &metrics{}, events: &broker{}, switching: &sync.Mutex{}}
 }
 
 func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -33,7 +116,7 @@ func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+var pageTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
 <html lang="en">
 <head>
   <meta charset="UTF-8">
@@ -41,24 +124,151 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
   <title>switchman</title>
 </head>
 <body>
-Current server: {{.Current}}
+{{if .ExitCheck}}
+<p>
+{{with .Exit}}
+Exit checked {{.Time.Format "2006-01-02 15:04:05"}}:
+{{range .Exits}}{{.IP}}{{if .Country}} ({{.Country}}{{if .City}}, {{.City}}{{end}}{{if .Hostname}}, {{.Hostname}}{{end}}){{end}} {{end}}
+{{if eq .Verdict "mismatch"}}<span style="color: red;">mismatch: {{.Reason}}</span>{{else if eq .Verdict "match"}}matches {{.Server}}{{else}}{{.Reason}}{{end}}
+{{range .Errors}}<br><span style="color: red;">{{.}}</span>{{end}}
+{{else}}
+Exit not checked yet.
+{{end}}
+<a href="check">check</a>
+</p>
+{{end}}
+{{if .LeakCheck}}
+<p>
+{{with .Leak}}
+Leak check {{.Time.Format "2006-01-02 15:04:05"}} for {{.Device}}:
+{{if .Leak}}<span style="color: red;">leak detected</span>{{else}}no leak detected{{end}}
+(DNS:{{range .DNS}} {{.Dest}} via {{.Device}}{{else}} none{{end}};
+IPv6: {{with .IPv6}}via {{.Device}}{{else}}no route{{end}})
+{{range .Leaks}}<br><span style="color: red;">{{.}}</span>{{end}}
+{{range .Errors}}<br>{{.}}{{end}}
+{{else}}
+Leaks not checked yet.
+{{end}}
+<a href="check">check</a>
+</p>
+{{end}}
+{{with .Failover}}
+<p>
+Failover: {{if .Failures}}<span style="color: red;">{{.Failures}} consecutive failed check(s): {{.Reason}}</span>{{else}}healthy{{end}}
+{{range .History}}<br>{{.Time.Format "2006-01-02 15:04:05"}}: {{.Message}}{{end}}
+</p>
+{{end}}
+<form action="switch">
+<input name="server" placeholder="server, e.g. got 3 or @favorite">
+<input type="submit" value="switch">
+</form>
+<p id="progress" hidden></p>
+{{.Content}}
+<script>
+// live updates: show switch progress and reload when done or health changes
+(function() {
+  if (!window.EventSource) return;
+  const elProgress = document.getElementById('progress');
+  let timer = null;
+  const show = (text, color) => {
+    elProgress.hidden = false;
+    elProgress.style.color = color || '';
+    elProgress.textContent = text;
+  };
+  const events = new EventSource('events');
+  events.addEventListener('switch-started', (e) => {
+    const d = JSON.parse(e.data);
+    const start = Date.now();
+    const tick = () => show('Switching from ' + d.from + ' to ' + d.to + '... ' + Math.round((Date.now() - start) / 1000) + 's');
+    clearInterval(timer);
+    tick();
+    timer = setInterval(tick, 1000);
+  });
+  events.addEventListener('switch-finished', (e) => {
+    const d = JSON.parse(e.data);
+    clearInterval(timer);
+    timer = null;
+    if (d.error) {
+      show('Switch to ' + d.to + ' failed: ' + d.error, 'red');
+      return;
+    }
+    window.location.reload();
+  });
+  for (const type of ['health-changed', 'relay-list-refreshed']) {
+    events.addEventListener(type, () => { if (timer === null) window.location.reload(); });
+  }
+  // switch in the background to stay on the page and see progress
+  document.addEventListener('click', (e) => {
+    const a = e.target.closest('a');
+    if (!a || !/\/(switch|next)$/.test(new URL(a.href).pathname)) return;
+    e.preventDefault();
+    fetch(a.href).then((r) => r.ok ? null : r.text().then((text) => show(text, 'red')));
+  });
+})();
+</script>
+</body>
+</html>`))
+
+var indexTmpl = template.Must(template.New("").Parse(`Current server: {{.Current}}
 <br>
 Servers ({{len .Servers}}):
 <br>
 <ul>
 {{range .Servers}}<li><a href="switch?server={{.}}">{{.}}</a></li>{{end}}
-</ul>
-</body>
-</html>`))
+</ul>`))
 
 // Indexable allows implementations to provide a custom index page instead of
 // the default showing a list of servers.
 type Indexable interface {
-	// Index produces an HTML index.
+	// Index produces the body of an HTML index.
 	Index(w io.Writer) error
 }
 
 func index(w io.Writer, s *server) error {
+	var content bytes.Buffer
+	if s.state != nil {
+		if err := pinned(&content, s); err != nil {
+			return err
+		}
+	}
+	if err := indexContent(&content, s); err != nil {
+		return err
+	}
+	return page(w, s, content.String())
+}
+
+// page writes an HTML page with the content in the body, after the checks.
+func page(w io.Writer, s *server, content string) error {
+	var exit *exitCheck
+	if s.exits != nil {
+		exit = s.exits.Last()
+	}
+	var leak *leakcheck.Result
+	if s.leaks != nil {
+		leak = s.leaks.Last()
+	}
+	var failover *failoverReport
+	if s.failover != nil {
+		failover = s.failover.report()
+	}
+	return pageTmpl.Execute(w, struct {
+		ExitCheck bool
+		Exit      *exitCheck
+		LeakCheck bool
+		Leak      *leakcheck.Result
+		Failover  *failoverReport
+		Content   template.HTML
+	}{
+		ExitCheck: s.exits != nil,
+		Exit:      exit,
+		LeakCheck: s.leaks != nil,
+		Leak:      leak,
+		Failover:  failover,
+		Content:   template.HTML(content),
+	})
+}
+
+func indexContent(w io.Writer, s *server) error {
 	if i, ok := s.Switchable.(Indexable); ok {
 		return i.Index(w)
 	}
@@ -80,22 +290,106 @@ func index(w io.Writer, s *server) error {
 	})
 }
 
+// switchServer switches to the server, then checks the exit in the background
+// and checks for leaks. The kill switch allows the new server during the switch.
+// The pre-switch hook can veto it. It is recorded in the audit log as requested
+// by the origin, and only if attempted, in metrics and notified to post-switch
+// hooks. Switches are serialized.
+func (s *server) switchServer(o origin, server string) error {
+	return s.switchBackend(o, s.Switchable, server)
+}
+
+// switchBackend switches the server of a backend: the one of the server, or
+// of another tunnel routing clients, whose switches are serialized, vetoed,
+// recorded and published the same way. The kill switch and exit and leak
+// checks are only of the backend of the server, as they are of its device.
+func (s *server) switchBackend(o origin, b Switchable, server string) (err error) {
+	s.switching.Lock()
+	defer s.switching.Unlock()
+	own := b == s.Switchable
+	start := time.Now()
+	previous, _ := b.Current()
+	s.events.publish("switch-started", switchStart{Action: o.Action, From: previous, To: server})
+	var attempted, vetoed bool
+	defer func() {
+		d := time.Since(start)
+		c := newChange(o, backendName(b), previous, server, d, err)
+		c.Vetoed = vetoed
+		s.events.publish("switch-finished", c)
+		if s.audit != nil {
+			s.audit.record(c)
+		}
+		if !attempted {
+			return
+		}
+		s.metrics.observe(d, err)
+		if s.hooks != nil {
+			s.hooks.after(c)
+		}
+	}()
+	if s.hooks != nil {
+		if err := s.hooks.before(newChange(o, backendName(b), previous, server, 0, nil)); err != nil {
+			vetoed = true
+			return err
+		}
+	}
+	if own && s.kill != nil {
+		if err := s.kill.begin(b, server); err != nil {
+			// back to only allowing the current server
+			if kerr := s.kill.end(b, false); kerr != nil {
+				log.Printf("kill switch: %v", kerr)
+			}
+			return err
+		}
+	}
+	attempted = true
+	err = b.Switch(server)
+	if own && s.kill != nil {
+		if kerr := s.kill.end(b, err == nil); kerr != nil && err == nil {
+			err = kerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if own && s.exits != nil {
+		go s.exits.Check(b)
+	}
+	if s.route != nil {
+		// the tunnel device may have been recreated, and its routes removed
+		if err := s.route.apply(); err != nil {
+			if !own {
+				return err
+			}
+			log.Printf("routing: %v", err)
+		}
+	}
+	if own && s.leaks != nil {
+		return s.leaks.checkAfterSwitch(b)
+	}
+	return nil
+}
+
 // note: no xsrf protection
 func (s *server) handleSwitch(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/switch" {
 		http.NotFound(w, r)
 		return
 	}
-	if err := s.Switch(r.URL.Query().Get("server")); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	server, err := s.match(r.URL.Query().Get("server"))
+	var ambiguous *ambiguousError
+	if errors.As(err, &ambiguous) {
+		candidates(w, r, s, ambiguous)
 		return
 	}
-	if !acceptsHTML(r) {
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "ok\n")
+	if err == nil {
+		err = s.switchServer(s.requestOrigin(r, "switch"), server)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprint(w, "<script>window.location=document.referrer;</script>")
+	done(w, r)
 }
 
 // note: no xsrf protection
@@ -104,10 +398,134 @@ func (s *server) handleNext(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	if err := next(s); err != nil {
+	var server string
+	var err error
+	if group := r.URL.Query().Get("group"); group != "" {
+		server, err = nextInGroup(s, group)
+	} else {
+		server, err = next(s)
+	}
+	if err == nil {
+		err = s.switchServer(s.requestOrigin(r, "next"), server)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	done(w, r)
+}
+
+// Settable allows implementations to change settings of the VPN from the
+// index, e.g. the tunnel protocol.
+type Settable interface {
+	// Set changes a setting.
+	Set(name, value string) error
+}
+
+// note: no xsrf protection
+func (s *server) handleSet(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/set" {
+		http.NotFound(w, r)
+		return
+	}
+	v, ok := s.Switchable.(Settable)
+	if !ok {
+		http.Error(w, "backend has no settings", http.StatusNotFound)
+		return
+	}
+	name, value := r.URL.Query().Get("name"), r.URL.Query().Get("value")
+	start := time.Now()
+	err := v.Set(name, value)
+	if s.audit != nil {
+		s.audit.record(newChange(s.requestOrigin(r, "set"), backendName(s.Switchable), "", fmt.Sprintf("%v = %v", name, value), time.Since(start), err))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	done(w, r)
+}
+
+// Controllable allows implementations to connect and disconnect the tunnel
+// from the index.
+type Controllable interface {
+	// Connect connects the tunnel.
+	Connect() error
+	// Disconnect disconnects the tunnel.
+	Disconnect() error
+	// Reconnect reconnects the tunnel.
+	Reconnect() error
+}
+
+// handleControl handles /connect, /disconnect and /reconnect.
+// note: no xsrf protection
+func (s *server) handleControl(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.Switchable.(Controllable)
+	if !ok {
+		http.Error(w, "backend cannot connect or disconnect", http.StatusNotFound)
+		return
+	}
+	action := strings.TrimPrefix(r.URL.Path, "/")
+	control := map[string]func() error{
+		"connect":    c.Connect,
+		"disconnect": c.Disconnect,
+		"reconnect":  c.Reconnect,
+	}[action]
+	if control == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.control(s.requestOrigin(r, action), control); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	done(w, r)
+}
+
+// control connects, disconnects or reconnects the tunnel. Like a switch, it
+// is serialized with switches, published on /events, recorded in the audit
+// log as requested by the origin and in metrics.
+func (s *server) control(o origin, control func() error) (err error) {
+	s.switching.Lock()
+	defer s.switching.Unlock()
+	start := time.Now()
+	current, _ := s.Current()
+	s.events.publish("switch-started", switchStart{Action: o.Action, From: current, To: current})
+	defer func() {
+		d := time.Since(start)
+		c := newChange(o, backendName(s.Switchable), current, current, d, err)
+		s.events.publish("switch-finished", c)
+		if s.audit != nil {
+			s.audit.record(c)
+		}
+		s.metrics.observe(d, err)
+	}()
+	return control()
+}
+
+func (s *server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/check" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.exits == nil && s.leaks == nil {
+		http.Error(w, "no check enabled", http.StatusNotFound)
+		return
+	}
+	if s.exits != nil {
+		s.exits.Check(s.Switchable)
+	}
+	if s.leaks != nil {
+		if _, err := s.leaks.Check(s.Switchable); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	done(w, r)
+}
+
+// done responds to a successful action: ok, or back to the page for browsers.
+func done(w http.ResponseWriter, r *http.Request) {
 	if !acceptsHTML(r) {
 		w.Header().Set("Content-Type", "text/plain")
 		fmt.Fprintf(w, "ok\n")
@@ -116,15 +534,46 @@ func (s *server) handleNext(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "<script>window.location=document.referrer;</script>")
 }
 
-func next(s Switchable) error {
+// next returns the server after the current one, or the first if the current
+// server is not in the list.
+func next(s Switchable) (string, error) {
 	current, err := s.Current()
 	if err != nil {
-		return err
+		return "", err
 	}
 	servers, err := s.List()
 	if err != nil {
-		return err
+		return "", err
+	}
+	// none in use, e.g. no Tailscale exit node, or not one of the list
+	if !slices.Contains(servers, current) && len(servers) > 0 {
+		return servers[0], nil
 	}
+	return after(current, servers)
+}
+
+// nextInGroup returns the server of the group after the current one, or the
+// first of the group if the current server is not in it.
+func nextInGroup(s *server, group string) (string, error) {
+	current, err := s.Current()
+	if err != nil {
+		return "", err
+	}
+	servers, err := s.group(group)
+	if err != nil {
+		return "", err
+	}
+	if len(servers) == 0 {
+		return "", fmt.Errorf("group %v is empty", group)
+	}
+	if !slices.Contains(servers, current) {
+		return servers[0], nil
+	}
+	return after(current, servers)
+}
+
+// after returns the server after the current one in servers.
+func after(current string, servers []string) (string, error) {
 	var next string
 	for i, e := range servers {
 		if e == current {
@@ -133,9 +582,9 @@ func next(s Switchable) error {
 		}
 	}
 	if next == "" {
-		return fmt.Errorf("could not find next server")
+		return "", fmt.Errorf("could not find next server")
 	}
-	return s.Switch(next)
+	return next, nil
 }
 
 func acceptsHTML(r *http.Request) bool {
@@ -1,7 +1,239 @@
 package main
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StalkR/switchman/leakcheck"
+)
 
 func TestInitializers(t *testing.T) {
 	// have at least a test so it can fail on initializers, e.g. template parsing
 }
+
+// fakeSwitchable is a Switchable for tests.
+type fakeSwitchable struct {
+	current string
+	servers []string
+}
+
+func (f *fakeSwitchable) Current() (string, error) { return f.current, nil }
+func (f *fakeSwitchable) List() ([]string, error)  { return f.servers, nil }
+
+func (f *fakeSwitchable) Switch(server string) error {
+	for _, e := range f.servers {
+		if e == server {
+			f.current = server
+			return nil
+		}
+	}
+	return fmt.Errorf("server %v not found", server)
+}
+
+func TestAPIStatus(t *testing.T) {
+	s := newServer(&fakeSwitchable{current: "b", servers: []string{"c", "a", "b"}})
+	w := httptest.NewRecorder()
+	s.handleAPIStatus(w, httptest.NewRequest("GET", "/api/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %v; want %v", w.Code, http.StatusOK)
+	}
+	var got apiStatus
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := apiStatus{Backend: "*main.fakeSwitchable", Current: "b", Servers: []string{"a", "b", "c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/api/status = %+v; want %+v", got, want)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s := &server{
+		Switchable: &fakeSwitchable{current: "b", servers: []string{"a", "b"}},
+		exits:      newExitChecker(),
+		leaks:      &leakChecker{},
+	}
+	for _, exit := range []*exitCheck{nil, {Server: "b", Verdict: "mismatch", Reason: "bad exit"}} {
+		s.exits.last = exit
+		var b strings.Builder
+		if err := index(&b, s); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), `<a href="switch?server=a">a</a>`) {
+			t.Errorf("index does not link to server a: %v", b.String())
+		}
+		if exit != nil && !strings.Contains(b.String(), "mismatch: bad exit") {
+			t.Errorf("index does not show exit mismatch: %v", b.String())
+		}
+	}
+
+	s.leaks.last = &leakcheck.Result{Device: "wg0", Leaks: []string{"IPv6 goes through eth0, not wg0"}}
+	var b strings.Builder
+	if err := index(&b, s); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "IPv6 goes through eth0, not wg0") {
+		t.Errorf("index does not show leak: %v", b.String())
+	}
+}
+
+func TestNext(t *testing.T) {
+	for _, tt := range []struct {
+		current, want string
+	}{
+		{"a", "b"},
+		{"c", "a"},
+		{"", "a"},  // none in use
+		{"z", "a"}, // not in the list
+	} {
+		if got, err := next(&fakeSwitchable{current: tt.current, servers: []string{"a", "b", "c"}}); err != nil || got != tt.want {
+			t.Errorf("next() from %q = %v, %v; want %v", tt.current, got, err, tt.want)
+		}
+	}
+	if _, err := next(&fakeSwitchable{}); err == nil {
+		t.Errorf("next() without servers = nil; want error")
+	}
+}
+
+type fakeSettable struct {
+	fakeSwitchable
+	settings map[string]string
+}
+
+func (f *fakeSettable) Set(name, value string) error {
+	if name != "protocol" {
+		return fmt.Errorf("unknown setting %v", name)
+	}
+	f.settings[name] = value
+	return nil
+}
+
+func TestHandleSet(t *testing.T) {
+	f := &fakeSettable{settings: map[string]string{}}
+	s := newServer(f)
+	w := httptest.NewRecorder()
+	s.handleSet(w, httptest.NewRequest("GET", "/set?name=protocol&value=wireguard", nil))
+	if w.Code != http.StatusOK || f.settings["protocol"] != "wireguard" {
+		t.Errorf("set protocol: code %v, settings %v; want %v, protocol=wireguard", w.Code, f.settings, http.StatusOK)
+	}
+	w = httptest.NewRecorder()
+	s.handleSet(w, httptest.NewRequest("GET", "/set?name=bogus&value=1", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("set bogus: code %v; want %v", w.Code, http.StatusInternalServerError)
+	}
+	w = httptest.NewRecorder()
+	newServer(&fakeSwitchable{}).handleSet(w, httptest.NewRequest("GET", "/set?name=protocol&value=wireguard", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("set without settings: code %v; want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+type fakeControllable struct {
+	fakeSwitchable
+	connected bool
+}
+
+func (f *fakeControllable) Connect() error    { f.connected = true; return nil }
+func (f *fakeControllable) Disconnect() error { f.connected = false; return nil }
+func (f *fakeControllable) Reconnect() error  { return fmt.Errorf("no relay") }
+
+func TestHandleControl(t *testing.T) {
+	f := &fakeControllable{}
+	s := newServer(f)
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+	h := s.handler()
+	for _, tt := range []struct {
+		path      string
+		code      int
+		connected bool
+	}{
+		{"/connect", http.StatusOK, true},
+		{"/reconnect", http.StatusInternalServerError, true},
+		{"/disconnect", http.StatusOK, false},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || f.connected != tt.connected {
+			t.Errorf("%v: code %v, connected %v; want %v, %v", tt.path, w.Code, f.connected, tt.code, tt.connected)
+		}
+	}
+	// published and counted like switches
+	var events []string
+	for len(ch) > 0 {
+		e := <-ch
+		events = append(events, e.Type)
+	}
+	if len(events) != 6 || events[0] != "switch-started" || events[1] != "switch-finished" {
+		t.Errorf("events = %v; want started and finished for each", events)
+	}
+	if want := map[string]int{"success": 2, "failure": 1}; !reflect.DeepEqual(s.metrics.switches, want) {
+		t.Errorf("switches = %v; want %v", s.metrics.switches, want)
+	}
+	w := httptest.NewRecorder()
+	newServer(&fakeSwitchable{}).handler().ServeHTTP(w, httptest.NewRequest("GET", "/connect", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/connect without control: code %v; want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+// slowSwitchable is a Switchable whose switches wait to be released.
+type slowSwitchable struct {
+	fakeSwitchable
+	started, release chan struct{}
+	m                sync.Mutex
+	switching        int // in progress
+	overlapped       bool
+}
+
+func (f *slowSwitchable) Switch(server string) error {
+	f.m.Lock()
+	f.switching++
+	f.overlapped = f.overlapped || f.switching > 1
+	f.m.Unlock()
+	f.started <- struct{}{}
+	<-f.release
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.switching--
+	return f.fakeSwitchable.Switch(server)
+}
+
+func TestSwitchServerAcrossReload(t *testing.T) {
+	f := &slowSwitchable{
+		fakeSwitchable: fakeSwitchable{current: "a", servers: []string{"a", "b", "c"}},
+		started:        make(chan struct{}, 2),
+		release:        make(chan struct{}),
+	}
+	prev := newServer(f)
+	// reloaded while prev is switching
+	srv := newServer(f)
+	srv.metrics, srv.events, srv.switching = prev.metrics, prev.events, prev.switching
+	errs := make(chan error, 2)
+	go func() { errs <- prev.switchServer(origin{Action: "switch"}, "b") }()
+	<-f.started
+	go func() { errs <- srv.switchServer(origin{Action: "switch"}, "c") }()
+	select {
+	case <-f.started:
+		t.Fatal("switch on the reloaded server started during the switch of the previous one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	f.release <- struct{}{}
+	<-f.started
+	f.release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if f.overlapped || f.current != "c" {
+		t.Errorf("overlapped %v, current %v; want serialized switches to c", f.overlapped, f.current)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// state is what switchman persists across restarts.
+type state struct {
+	// Clients maps a client, IP or MAC, to the tunnel it chose.
+	Clients map[string]string `json:"clients,omitempty"`
+	// Favorites are servers saved with a friendly name.
+	Favorites []favorite `json:"favorites,omitempty"`
+	// Groups maps a group name to its servers or favorite aliases.
+	Groups map[string][]string `json:"groups,omitempty"`
+}
+
+// A stateFile persists state as JSON.
+type stateFile struct {
+	path string
+
+	m     sync.Mutex // protects below
+	state state
+}
+
+// loadState loads the state from path, empty if it does not exist yet.
+func loadState(path string) (*stateFile, error) {
+	f := &stateFile{path: path}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.state); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// get calls fn with the state, which must not be modified.
+func (f *stateFile) get(fn func(*state)) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	fn(&f.state)
+}
+
+// update calls fn to modify the state then saves it.
+func (f *stateFile) update(fn func(*state)) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	fn(&f.state)
+	b, err := json.MarshalIndent(f.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	// write then rename to never leave a partial file
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
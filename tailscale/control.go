@@ -0,0 +1,58 @@
+package tailscale
+
+import (
+  "fmt"
+)
+
+// Disconnect stops using an exit node, remembering it to connect again.
+func (s *Server) Disconnect() error {
+  st, err := s.status()
+  if err != nil {
+    return err
+  }
+  n := st.current()
+  if n == nil {
+    return nil // not an error, just nothing to do
+  }
+  if err := s.setExitNode(nil); err != nil {
+    return fmt.Errorf("could not stop using exit node %v: %v", n.Name(), err)
+  }
+  s.m.Lock()
+  defer s.m.Unlock()
+  s.last = n.Name()
+  return nil
+}
+
+// Connect uses again the exit node used before disconnecting.
+func (s *Server) Connect() error {
+  st, err := s.status()
+  if err != nil {
+    return err
+  }
+  if st.current() != nil {
+    return nil // not an error, just nothing to do
+  }
+  s.m.Lock()
+  last := s.last
+  s.m.Unlock()
+  if last == "" {
+    return fmt.Errorf("no exit node used before, switch to one")
+  }
+  return s.Switch(last)
+}
+
+// Reconnect sets the exit node in use again.
+func (s *Server) Reconnect() error {
+  st, err := s.status()
+  if err != nil {
+    return err
+  }
+  n := st.current()
+  if n == nil {
+    return fmt.Errorf("no exit node in use")
+  }
+  if err := s.setExitNode(nil); err != nil {
+    return err
+  }
+  return s.setExitNode(n)
+}
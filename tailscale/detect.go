@@ -0,0 +1,38 @@
+package tailscale
+
+import (
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for Tailscale: its cli, daemon socket, tunnel and exit nodes.
+func Detect(options ...Option) *detect.Result {
+  r := detect.New("tailscale")
+  s := &Server{}
+  for _, option := range options {
+    option(s)
+  }
+  if s.localAPI == nil && !r.Binary("tailscale") {
+    return r.Score(0, "tailscale binary not found in PATH")
+  }
+  socket := DefaultSocket
+  if s.localAPI != nil {
+    socket = s.localAPI.socket
+  }
+  if !r.File(socket) {
+    return r.Score(0, "tailscaled not running")
+  }
+  r.Interface(device)
+  st, err := s.status()
+  if err != nil {
+    return r.Score(0, "cannot get tailscale status: %v", err)
+  }
+  nodes := len(st.exitNodes())
+  switch {
+  case nodes == 0:
+    return r.Score(0, "no exit node in the tailnet")
+  case st.current() != nil:
+    return r.Score(80, "%d exit nodes, using %v", nodes, st.current().Name())
+  }
+  // tailscale often runs alongside a VPN: score lower unless an exit node is used
+  return r.Score(40, "%d exit nodes, none used", nodes)
+}
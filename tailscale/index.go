@@ -0,0 +1,62 @@
+package tailscale
+
+import (
+  "html/template"
+  "io"
+)
+
+var indexTmpl = template.Must(template.New("").Parse(`<p>
+Tailscale {{.Status.BackendState}}{{with .Status.CurrentTailnet}}, tailnet {{.Name}}{{end}}{{with .Status.Self}}, this node {{.Name}}{{end}}
+</p>
+<p>Current exit node: {{with .Current}}{{.Name}} ({{if .Online}}online{{else}}<span style="color: red;">offline</span>{{end}}) <a href="disconnect">stop using</a>{{else}}none{{with $.Last}} <a href="connect">use {{.}} again</a>{{end}}{{end}}</p>
+<p>
+Exit nodes ({{len .Nodes}})
+</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Name</th>
+      <th align="left">DNS name</th>
+      <th align="left">OS</th>
+      <th align="left">Location</th>
+      <th align="left">Addresses</th>
+      <th align="left">Online</th>
+      <th align="left">Switch</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Nodes}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.DNSName}}</td>
+      <td>{{.OS}}</td>
+      <td>{{.Place}}</td>
+      <td>{{range $i, $e := .TailscaleIPs}}{{if $i}}, {{end}}{{$e}}{{end}}</td>
+      <td>{{if .Online}}online{{else}}<span style="color: red;">offline</span>{{if not .LastSeen.IsZero}}, last seen {{.LastSeen.Format "2006-01-02 15:04"}}{{end}}{{end}}</td>
+      <td><a href="switch?server={{.Name}}">switch</a></td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>`))
+
+// Index writes the body of an HTML index page to switch the Server.
+func (s *Server) Index(w io.Writer) error {
+  st, err := s.status()
+  if err != nil {
+    return err
+  }
+  s.m.Lock()
+  last := s.last
+  s.m.Unlock()
+  return indexTmpl.Execute(w, struct {
+    Status  *status
+    Current *node
+    Last    string
+    Nodes   []*node
+  }{
+    Status:  st,
+    Current: st.current(),
+    Last:    last,
+    Nodes:   st.exitNodes(),
+  })
+}
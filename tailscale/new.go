@@ -0,0 +1,119 @@
+package tailscale
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "io"
+  "net"
+  "net/http"
+  "os/exec"
+  "strings"
+  "sync"
+)
+
+const (
+  device = "tailscale0"
+  // DefaultSocket is the local API socket of tailscaled on Linux.
+  DefaultSocket = "/var/run/tailscale/tailscaled.sock"
+)
+
+// New creates a new Server to switch the Tailscale exit node, of a tailnet
+// coordinated by Tailscale or Headscale.
+func New(options ...Option) (*Server, error) {
+  s := &Server{}
+  for _, option := range options {
+    option(s)
+  }
+  if s.localAPI == nil {
+    if _, err := exec.LookPath("tailscale"); err != nil {
+      return nil, fmt.Errorf("tailscale binary not found in PATH")
+    }
+  }
+  if _, err := s.status(); err != nil {
+    return nil, err
+  }
+  return s, nil
+}
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithLocalAPI uses the local API of tailscaled at the unix socket path to
+// read the status and set the exit node, instead of the tailscale cli.
+func WithLocalAPI(socket string) Option {
+  return func(s *Server) {
+    s.localAPI = newLocalAPI(socket)
+  }
+}
+
+// A Server implements the ability to switch the Tailscale exit node.
+// It implements the Switchable, Indexable and Controllable interfaces.
+type Server struct {
+  localAPI *localAPI // optional, instead of the cli
+
+  m    sync.Mutex // protects below
+  last string     // exit node used before disconnecting
+}
+
+// Device returns the network device of the tunnel.
+func (s *Server) Device() (string, error) {
+  return device, nil
+}
+
+// run runs a command and returns its output, with its error output in the
+// error, replaced in tests.
+var run = func(name string, arg ...string) (string, error) {
+  b, err := exec.Command(name, arg...).Output()
+  if err != nil {
+    var stderr string
+    if e, ok := err.(*exec.ExitError); ok {
+      stderr = ": " + strings.TrimSpace(string(e.Stderr))
+    }
+    return string(b), fmt.Errorf("%v %v: %v%v", name, strings.Join(arg, " "), err, stderr)
+  }
+  return string(b), nil
+}
+
+// A localAPI is a client of the tailscaled local API over its unix socket.
+type localAPI struct {
+  socket string
+  client *http.Client
+}
+
+func newLocalAPI(socket string) *localAPI {
+  return &localAPI{
+    socket: socket,
+    client: &http.Client{Transport: &http.Transport{
+      DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+        var d net.Dialer
+        return d.DialContext(ctx, "unix", socket)
+      },
+    }},
+  }
+}
+
+// call calls a method of the local API and returns the response body.
+func (l *localAPI) call(method, path string, body []byte) ([]byte, error) {
+  // the host is not used over the socket, this is the one of tailscale clients
+  r, err := http.NewRequest(method, "http://local-tailscaled.sock/localapi/v0/"+path, bytes.NewReader(body))
+  if err != nil {
+    return nil, err
+  }
+  if body != nil {
+    r.Header.Set("Content-Type", "application/json")
+  }
+  resp, err := l.client.Do(r)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  b, err := io.ReadAll(resp.Body)
+  if err != nil {
+    return nil, err
+  }
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("local API %v %v: %v: %v", method, path, resp.Status, strings.TrimSpace(string(b)))
+  }
+  return b, nil
+}
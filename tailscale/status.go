@@ -0,0 +1,109 @@
+package tailscale
+
+import (
+  "encoding/json"
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+)
+
+// status is the output of tailscale status --json, also returned by the
+// local API, with the fields used.
+type status struct {
+  BackendState   string // e.g. Running, Stopped, NeedsLogin
+  Self           *node
+  ExitNodeStatus *struct {
+    ID     string
+    Online bool
+  }
+  CurrentTailnet *struct {
+    Name string
+  }
+  Peer map[string]*node // by node key
+}
+
+// A node is a device of the tailnet.
+type node struct {
+  ID             string
+  HostName       string
+  DNSName        string // MagicDNS name, e.g. se-got-wg-001.mullvad.ts.net.
+  OS             string
+  TailscaleIPs   []string
+  Online         bool
+  ExitNode       bool // currently used as exit node
+  ExitNodeOption bool // can be used as exit node
+  Location       *struct {
+    Country     string
+    CountryCode string
+    City        string
+    CityCode    string
+  }
+  LastSeen time.Time
+}
+
+// Name returns the name of the node as a server: its MagicDNS name without
+// the tailnet domain, or its hostname.
+func (n *node) Name() string {
+  if name, _, _ := strings.Cut(n.DNSName, "."); name != "" {
+    return name
+  }
+  return n.HostName
+}
+
+// Place returns the location of the node, if known, e.g. Gothenburg, Sweden.
+func (n *node) Place() string {
+  switch {
+  case n.Location == nil:
+    return ""
+  case n.Location.City != "":
+    return n.Location.City + ", " + n.Location.Country
+  }
+  return n.Location.Country
+}
+
+func parseStatus(b []byte) (*status, error) {
+  var st status
+  if err := json.Unmarshal(b, &st); err != nil {
+    return nil, fmt.Errorf("tailscale status: %v", err)
+  }
+  return &st, nil
+}
+
+// status returns the status of tailscaled, from the local API or the cli.
+func (s *Server) status() (*status, error) {
+  if s.localAPI != nil {
+    b, err := s.localAPI.call("GET", "status", nil)
+    if err != nil {
+      return nil, err
+    }
+    return parseStatus(b)
+  }
+  out, err := run("tailscale", "status", "--json")
+  if err != nil {
+    return nil, err
+  }
+  return parseStatus([]byte(out))
+}
+
+// exitNodes returns the nodes which can be used as exit node, by name.
+func (st *status) exitNodes() []*node {
+  var nodes []*node
+  for _, n := range st.Peer {
+    if n.ExitNodeOption {
+      nodes = append(nodes, n)
+    }
+  }
+  sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name() < nodes[j].Name() })
+  return nodes
+}
+
+// current returns the exit node in use, nil if none.
+func (st *status) current() *node {
+  for _, n := range st.Peer {
+    if n.ExitNode || (st.ExitNodeStatus != nil && n.ID == st.ExitNodeStatus.ID) {
+      return n
+    }
+  }
+  return nil
+}
@@ -0,0 +1,205 @@
+package tailscale
+
+import (
+  "encoding/json"
+  "fmt"
+  "net"
+  "net/http"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "sync"
+  "testing"
+)
+
+func readStatus(t *testing.T) []byte {
+  b, err := os.ReadFile("testdata/status.json")
+  if err != nil {
+    t.Fatal(err)
+  }
+  return b
+}
+
+func TestParseStatus(t *testing.T) {
+  st, err := parseStatus(readStatus(t))
+  if err != nil {
+    t.Fatal(err)
+  }
+  var names, places []string
+  for _, n := range st.exitNodes() {
+    names = append(names, n.Name())
+    places = append(places, n.Place())
+  }
+  if want := []string{"ch-zrh-wg-001", "home-pi", "se-got-wg-001"}; !reflect.DeepEqual(names, want) {
+    t.Errorf("exit nodes = %v; want %v", names, want)
+  }
+  if want := []string{"Zurich, Switzerland", "", "Gothenburg, Sweden"}; !reflect.DeepEqual(places, want) {
+    t.Errorf("places = %q; want %q", places, want)
+  }
+  if n := st.current(); n == nil || n.Name() != "ch-zrh-wg-001" {
+    t.Errorf("current() = %+v; want ch-zrh-wg-001", n)
+  }
+  if n := (&node{HostName: "pi"}); n.Name() != "pi" {
+    t.Errorf("Name() without DNS name = %v; want pi", n.Name())
+  }
+  if _, err := parseStatus([]byte("tailscale is stopped")); err == nil {
+    t.Errorf("parseStatus(invalid) = nil; want error")
+  }
+}
+
+// fakeRun replaces run with answers to tailscale status, recording commands.
+func fakeRun(t *testing.T, status []byte) *[]string {
+  var commands []string
+  prev := run
+  t.Cleanup(func() { run = prev })
+  run = func(name string, arg ...string) (string, error) {
+    command := strings.Join(append([]string{name}, arg...), " ")
+    commands = append(commands, command)
+    if command == "tailscale status --json" {
+      return string(status), nil
+    }
+    return "", nil
+  }
+  return &commands
+}
+
+func TestSwitchCLI(t *testing.T) {
+  commands := fakeRun(t, readStatus(t))
+  s := &Server{}
+  if got, err := s.Current(); err != nil || got != "ch-zrh-wg-001" {
+    t.Errorf("Current() = %v, %v; want ch-zrh-wg-001", got, err)
+  }
+  if err := s.Switch("se-got-wg-001"); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.Switch("ch-zrh-wg-001"); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.Switch("laptop"); err == nil {
+    t.Errorf("Switch(not an exit node) = nil; want error")
+  }
+  var sets []string
+  for _, c := range *commands {
+    if strings.HasPrefix(c, "tailscale set") {
+      sets = append(sets, c)
+    }
+  }
+  if want := []string{"tailscale set --exit-node=100.80.1.1"}; !reflect.DeepEqual(sets, want) {
+    t.Errorf("commands = %q; want %q", sets, want)
+  }
+  if active, err := s.Active("home-pi"); err != nil || active {
+    t.Errorf("Active(offline) = %v, %v; want false", active, err)
+  }
+  var b strings.Builder
+  if err := s.Index(&b); err != nil {
+    t.Fatal(err)
+  }
+  for _, want := range []string{"tailnet example.com", "Current exit node: ch-zrh-wg-001 (online)", "Gothenburg, Sweden", "last seen 2026-10-01 12:00"} {
+    if !strings.Contains(b.String(), want) {
+      t.Errorf("Index() does not contain %q", want)
+    }
+  }
+}
+
+func TestControlCLI(t *testing.T) {
+  var st map[string]any
+  if err := json.Unmarshal(readStatus(t), &st); err != nil {
+    t.Fatal(err)
+  }
+  var commands []string
+  prev := run
+  t.Cleanup(func() { run = prev })
+  run = func(name string, arg ...string) (string, error) {
+    command := strings.Join(append([]string{name}, arg...), " ")
+    if command == "tailscale status --json" {
+      b, err := json.Marshal(st)
+      return string(b), err
+    }
+    commands = append(commands, command)
+    return "", nil
+  }
+  s := &Server{}
+  if err := s.Connect(); err != nil || len(commands) != 0 {
+    t.Errorf("Connect() in use = %v, ran %q; want nothing done", err, commands)
+  }
+  if err := s.Disconnect(); err != nil {
+    t.Fatal(err)
+  }
+
+  // no exit node in use
+  delete(st, "ExitNodeStatus")
+  for _, n := range st["Peer"].(map[string]any) {
+    n.(map[string]any)["ExitNode"] = false
+  }
+  var b strings.Builder
+  if err := s.Index(&b); err != nil {
+    t.Fatal(err)
+  }
+  if want := `none <a href="connect">use ch-zrh-wg-001 again</a>`; !strings.Contains(b.String(), want) {
+    t.Errorf("Index() = %v; want %q", b.String(), want)
+  }
+  if err := s.Connect(); err != nil {
+    t.Fatal(err)
+  }
+  if want := []string{"tailscale set --exit-node=", "tailscale set --exit-node=100.80.1.2"}; !reflect.DeepEqual(commands, want) {
+    t.Errorf("commands = %q; want %q", commands, want)
+  }
+  if err := s.Reconnect(); err == nil {
+    t.Errorf("Reconnect() without exit node = nil; want error")
+  }
+}
+
+func TestSwitchLocalAPI(t *testing.T) {
+  status := readStatus(t)
+  var m sync.Mutex
+  var prefs []string
+  mux := http.NewServeMux()
+  mux.HandleFunc("GET /localapi/v0/status", func(w http.ResponseWriter, r *http.Request) {
+    w.Write(status)
+  })
+  mux.HandleFunc("PATCH /localapi/v0/prefs", func(w http.ResponseWriter, r *http.Request) {
+    var p map[string]any
+    if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+    m.Lock()
+    prefs = append(prefs, fmt.Sprintf("%v %v %v", p["ExitNodeID"], p["ExitNodeIP"], p["ExitNodeIPSet"]))
+    m.Unlock()
+    w.Write([]byte("{}"))
+  })
+  socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+  l, err := net.Listen("unix", socket)
+  if err != nil {
+    t.Fatal(err)
+  }
+  srv := &http.Server{Handler: mux}
+  go srv.Serve(l)
+  defer srv.Close()
+
+  fakeRun(t, nil) // not used
+  s, err := New(WithLocalAPI(socket))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got, err := s.List(); err != nil || len(got) != 3 {
+    t.Errorf("List() = %v, %v; want 3 exit nodes", got, err)
+  }
+  if err := s.Switch("home-pi"); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.Disconnect(); err != nil {
+    t.Fatal(err)
+  }
+  m.Lock()
+  defer m.Unlock()
+  // the exit node set by address is cleared
+  if want := []string{"nHome3CNTRL  true", "  true"}; !reflect.DeepEqual(prefs, want) {
+    t.Errorf("prefs ExitNodeID, ExitNodeIP, ExitNodeIPSet = %q; want %q", prefs, want)
+  }
+
+  if _, err := New(WithLocalAPI(filepath.Join(t.TempDir(), "missing.sock"))); err == nil {
+    t.Errorf("New(missing socket) = nil; want error")
+  }
+}
@@ -0,0 +1,104 @@
+package tailscale
+
+import (
+  "encoding/json"
+  "fmt"
+)
+
+// List lists the nodes which can be used as exit node.
+func (s *Server) List() ([]string, error) {
+  st, err := s.status()
+  if err != nil {
+    return nil, err
+  }
+  var servers []string
+  for _, n := range st.exitNodes() {
+    servers = append(servers, n.Name())
+  }
+  return servers, nil
+}
+
+// Current returns the exit node in use, empty if none.
+func (s *Server) Current() (string, error) {
+  st, err := s.status()
+  if err != nil {
+    return "", err
+  }
+  if n := st.current(); n != nil {
+    return n.Name(), nil
+  }
+  return "", nil
+}
+
+// find finds an exit node by name.
+func (st *status) find(server string) (*node, error) {
+  for _, n := range st.exitNodes() {
+    if n.Name() == server {
+      return n, nil
+    }
+  }
+  return nil, fmt.Errorf("exit node %v not found", server)
+}
+
+// Active returns whether the exit node is online.
+func (s *Server) Active(server string) (bool, error) {
+  st, err := s.status()
+  if err != nil {
+    return false, err
+  }
+  n, err := st.find(server)
+  if err != nil {
+    return false, err
+  }
+  return n.Online, nil
+}
+
+// Switch switches to the specified exit node.
+func (s *Server) Switch(server string) error {
+  st, err := s.status()
+  if err != nil {
+    return err
+  }
+  n, err := st.find(server)
+  if err != nil {
+    return err
+  }
+  if n == st.current() {
+    return nil // not an error, just nothing to do
+  }
+  if err := s.setExitNode(n); err != nil {
+    return fmt.Errorf("could not set exit node to %v: %v", server, err)
+  }
+  return nil
+}
+
+// setExitNode sets the exit node, none if nil: by ID with the local API,
+// clearing the one set by address, otherwise by address with the cli.
+func (s *Server) setExitNode(n *node) error {
+  if s.localAPI != nil {
+    var id string
+    if n != nil {
+      id = n.ID
+    }
+    b, err := json.Marshal(struct {
+      ExitNodeID    string
+      ExitNodeIDSet bool
+      ExitNodeIP    string
+      ExitNodeIPSet bool
+    }{id, true, "", true})
+    if err != nil {
+      return err
+    }
+    _, err = s.localAPI.call("PATCH", "prefs", b)
+    return err
+  }
+  var addr string
+  if n != nil {
+    if len(n.TailscaleIPs) == 0 {
+      return fmt.Errorf("exit node %v has no address", n.Name())
+    }
+    addr = n.TailscaleIPs[0]
+  }
+  _, err := run("tailscale", "set", "--exit-node="+addr)
+  return err
+}
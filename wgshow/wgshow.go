@@ -0,0 +1,98 @@
+// Package wgshow reads the live state of a WireGuard interface from
+// `wg show <device> dump`.
+package wgshow
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Device is the state of a WireGuard interface.
+type Device struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`
+	ListenPort int    `json:"listen_port"`
+	Peers      []Peer `json:"peers"`
+}
+
+// A Peer is the state of a peer of a WireGuard interface.
+type Peer struct {
+	PublicKey           string    `json:"public_key"`
+	Endpoint            string    `json:"endpoint"`
+	AllowedIPs          []string  `json:"allowed_ips"`
+	LatestHandshake     time.Time `json:"latest_handshake"` // zero if none
+	RxBytes             int64     `json:"rx_bytes"`
+	TxBytes             int64     `json:"tx_bytes"`
+	PersistentKeepalive int       `json:"persistent_keepalive"` // seconds, 0 if off
+}
+
+// StaleHandshake is the handshake age after which a peer is considered
+// stale: WireGuard renews handshakes every 2 minutes while there is traffic.
+const StaleHandshake = 3 * time.Minute
+
+// Stale returns whether the peer has no handshake or an old one.
+func (p Peer) Stale() bool {
+	return p.LatestHandshake.IsZero() || time.Since(p.LatestHandshake) > StaleHandshake
+}
+
+// HandshakeAge returns the time since the latest handshake, rounded to the
+// second, or 0 if there was none.
+func (p Peer) HandshakeAge() time.Duration {
+	if p.LatestHandshake.IsZero() {
+		return 0
+	}
+	return time.Since(p.LatestHandshake).Round(time.Second)
+}
+
+// Show returns the state of a WireGuard interface.
+func Show(device string) (*Device, error) {
+	out, err := exec.Command("wg", "show", device, "dump").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("wg show %v: %v - %v", device, err, strings.TrimSpace(string(out)))
+	}
+	return Parse(device, string(out))
+}
+
+// Parse parses the output of `wg show <device> dump`: a first line for the
+// interface then a line per peer, with tab-separated fields.
+func Parse(device, dump string) (*Device, error) {
+	lines := strings.Split(strings.TrimSpace(dump), "\n")
+	f := strings.Split(lines[0], "\t")
+	if len(f) != 4 {
+		return nil, fmt.Errorf("wg show %v: invalid interface line", device)
+	}
+	d := &Device{Name: device, PublicKey: f[1]}
+	d.ListenPort, _ = strconv.Atoi(f[2])
+	for _, line := range lines[1:] {
+		f := strings.Split(line, "\t")
+		if len(f) != 8 {
+			return nil, fmt.Errorf("wg show %v: invalid peer line", device)
+		}
+		p := Peer{PublicKey: f[0]}
+		if f[2] != "(none)" {
+			p.Endpoint = f[2]
+		}
+		if f[3] != "(none)" {
+			p.AllowedIPs = strings.Split(f[3], ",")
+		}
+		handshake, err := strconv.ParseInt(f[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wg show %v: invalid latest handshake: %v", device, err)
+		}
+		if handshake != 0 {
+			p.LatestHandshake = time.Unix(handshake, 0)
+		}
+		if p.RxBytes, err = strconv.ParseInt(f[5], 10, 64); err != nil {
+			return nil, fmt.Errorf("wg show %v: invalid transfer rx: %v", device, err)
+		}
+		if p.TxBytes, err = strconv.ParseInt(f[6], 10, 64); err != nil {
+			return nil, fmt.Errorf("wg show %v: invalid transfer tx: %v", device, err)
+		}
+		p.PersistentKeepalive, _ = strconv.Atoi(f[7]) // "off" is 0
+		d.Peers = append(d.Peers, p)
+	}
+	return d, nil
+}
@@ -0,0 +1,47 @@
+package wgshow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	const dump = "cHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n" +
+		"cGVlcjE=\t(none)\t198.51.100.1:51820\t0.0.0.0/0,::/0\t1700000000\t1234\t5678\t25\n" +
+		"cGVlcjI=\t(none)\t(none)\t10.0.0.0/8\t0\t0\t0\toff\n"
+	got, err := Parse("wg0", dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Device{
+		Name:       "wg0",
+		PublicKey:  "cHVibGlj",
+		ListenPort: 51820,
+		Peers: []Peer{
+			{
+				PublicKey:           "cGVlcjE=",
+				Endpoint:            "198.51.100.1:51820",
+				AllowedIPs:          []string{"0.0.0.0/0", "::/0"},
+				LatestHandshake:     time.Unix(1700000000, 0),
+				RxBytes:             1234,
+				TxBytes:             5678,
+				PersistentKeepalive: 25,
+			},
+			{
+				PublicKey:  "cGVlcjI=",
+				AllowedIPs: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v; want %+v", got, want)
+	}
+	if age := got.Peers[1].HandshakeAge(); age != 0 {
+		t.Errorf("HandshakeAge() without handshake = %v; want 0", age)
+	}
+
+	if _, err := Parse("wg0", "garbage"); err == nil {
+		t.Error("Parse(garbage): got nil error, want error")
+	}
+}
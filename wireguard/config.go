@@ -0,0 +1,71 @@
+package wireguard
+
+import (
+  "bufio"
+  "os"
+  "strings"
+)
+
+// A config is a parsed WireGuard config, with the options used for display.
+type config struct {
+  Address    string
+  DNS        string
+  PublicKey  string // of the first peer
+  Endpoint   string // of the first peer
+  AllowedIPs string // of the first peer
+}
+
+// readConfig parses a WireGuard config, an INI-like format with
+// [Interface] and [Peer] sections.
+func readConfig(path string) (*config, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  var c config
+  var section string
+  peers := 0
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    line, _, _ := strings.Cut(scanner.Text(), "#")
+    line = strings.TrimSpace(line)
+    if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+      section = strings.ToLower(line[1 : len(line)-1])
+      if section == "peer" {
+        peers++
+      }
+      continue
+    }
+    key, value, ok := strings.Cut(line, "=")
+    if !ok {
+      continue
+    }
+    key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+    switch {
+    case section == "interface" && key == "address":
+      c.Address = value
+    case section == "interface" && key == "dns":
+      c.DNS = value
+    case section == "peer" && peers == 1 && key == "publickey":
+      c.PublicKey = value
+    case section == "peer" && peers == 1 && key == "endpoint":
+      c.Endpoint = value
+    case section == "peer" && peers == 1 && key == "allowedips":
+      c.AllowedIPs = value
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+  return &c, nil
+}
+
+// Fingerprint returns a short form of the peer public key to tell keys apart.
+func (c *config) Fingerprint() string {
+  if len(c.PublicKey) <= 8 {
+    return c.PublicKey
+  }
+  return c.PublicKey[:8] + "…"
+}
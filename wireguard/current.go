@@ -4,10 +4,16 @@ import (
   "bufio"
   "os"
   "strings"
+
+  "github.com/StalkR/switchman/profiledir"
 )
 
 // Current returns the current server.
+// In profiles mode, it is the name of the profile in place.
 func (s *Server) Current() (string, error) {
+  if s.profiles != "" {
+    return profiledir.Current(s.config)
+  }
   f, err := os.Open(s.config)
   if err != nil {
     return "", err
@@ -0,0 +1,38 @@
+package wireguard
+
+import (
+  "github.com/StalkR/switchman/detect"
+)
+
+// Detect probes for WireGuard: a directory of profiles if configured, or
+// the config of the device, and its tunnel. A generic config is less specific than a Mullvad
+// one, so it scores lower than the mullvad backend on the same host.
+func Detect(options ...Option) *detect.Result {
+  s := &Server{device: defaultDevice}
+  for _, option := range options {
+    option(s)
+  }
+  s.config = configPath(s.device)
+  r := detect.New("wireguard")
+  r.Binary("wg-quick")
+  tunnel := r.Interface(s.device)
+
+  if s.profiles != "" {
+    profiles, err := s.listProfiles()
+    if err != nil {
+      return r.Score(0, "cannot list profiles in %v: %v", s.profiles, err)
+    }
+    if len(profiles) == 0 {
+      return r.Score(0, "no .conf files found in %v", s.profiles)
+    }
+    return r.Score(80, "%d profiles in %v", len(profiles), s.profiles)
+  }
+
+  if !r.File(s.config) {
+    return r.Score(0, "no %v", s.config)
+  }
+  if tunnel {
+    return r.Score(60, "%v, %v up", s.config, s.device)
+  }
+  return r.Score(40, "%v, %v down", s.config, s.device)
+}
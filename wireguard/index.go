@@ -0,0 +1,96 @@
+package wireguard
+
+import (
+  "html/template"
+  "io"
+  "sort"
+
+  "github.com/StalkR/switchman/wgshow"
+)
+
+var indexTmpl = template.Must(template.New("").Parse(`<p>Current server: {{.Current}}</p>
+{{with .Status}}
+<p>Interface {{.Name}}{{if .ListenPort}} (listen port {{.ListenPort}}){{end}}</p>
+<ul>
+  {{range .Peers}}
+  <li>
+    peer {{.Endpoint}}:
+    {{if .LatestHandshake.IsZero}}<span style="color: red;">no handshake</span>{{else}}latest handshake
+      {{if .Stale}}<span style="color: red;">{{.HandshakeAge}} ago</span>{{else}}{{.HandshakeAge}} ago{{end}}{{end}},
+    {{.RxBytes}} bytes received, {{.TxBytes}} bytes sent
+  </li>
+  {{end}}
+</ul>
+{{end}}
+{{if .StatusError}}
+<p>Interface down: {{.StatusError}}</p>
+{{end}}
+{{if .Profiles}}
+<p>
+Profiles ({{len .Profiles}})
+</p>
+<table>
+  <thead>
+    <tr>
+      <th align="left">Name</th>
+      <th align="left">Endpoint</th>
+      <th align="left">Key</th>
+      <th align="left">Address</th>
+      <th align="left">AllowedIPs</th>
+      <th align="left">Switch</th>
+    </tr>
+  </thead>
+  <tbody>
+    {{range .Profiles}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Endpoint}}</td>
+      <td title="{{.PublicKey}}">{{.Fingerprint}}</td>
+      <td>{{.Address}}</td>
+      <td>{{.AllowedIPs}}</td>
+      <td><a href="switch?server={{.Name}}">switch</a></td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+{{else}}
+<p>
+Servers ({{len .Servers}})
+</p>
+<ul>
+{{range .Servers}}<li><a href="switch?server={{.}}">{{.}}</a></li>{{end}}
+</ul>
+{{end}}`))
+
+// Index writes the body of an HTML index page to switch the Server.
+func (s *Server) Index(w io.Writer) error {
+  current, err := s.Current()
+  if err != nil {
+    return err
+  }
+  servers, err := s.List()
+  if err != nil {
+    return err
+  }
+  sort.Strings(servers)
+  var profiles []*profile
+  if s.profiles != "" {
+    if profiles, err = s.listProfiles(); err != nil {
+      return err
+    }
+  }
+  status, statusError := s.Status()
+  return indexTmpl.Execute(w, struct {
+    Current     string
+    Servers     []string
+    Profiles    []*profile
+    Status      *wgshow.Device
+    StatusError error
+  }{
+    Current:     current,
+    Servers:     servers,
+    Profiles:    profiles,
+    Status:      status,
+    StatusError: statusError,
+  })
+}
@@ -7,7 +7,19 @@ import (
 )
 
 // List lists available servers.
+// In profiles mode, it lists profile names.
 func (s *Server) List() ([]string, error) {
+  if s.profiles != "" {
+    profiles, err := s.listProfiles()
+    if err != nil {
+      return nil, err
+    }
+    var servers []string
+    for _, p := range profiles {
+      servers = append(servers, p.Name)
+    }
+    return servers, nil
+  }
   f, err := os.Open(s.config)
   if err != nil {
     return nil, err
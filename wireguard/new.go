@@ -1,22 +1,67 @@
 package wireguard
 
 import (
+	"fmt"
 	"os"
 )
 
 // New creates a new Server to switch a WireGuard server.
-func New() (*Server, error) {
-	const config = "/etc/wireguard/wg0.conf"
-	if _, err := os.Stat(config); err != nil {
+func New(options ...Option) (*Server, error) {
+	s := &Server{device: defaultDevice}
+	for _, option := range options {
+		option(s)
+	}
+	s.config = configPath(s.device)
+
+	if s.profiles != "" {
+		profiles, err := s.listProfiles()
+		if err != nil {
+			return nil, err
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("no .conf files found in %v", s.profiles)
+		}
+		return s, nil
+	}
+
+	if _, err := os.Stat(s.config); err != nil {
 		return nil, err
 	}
-	return &Server{
-		config: config,
-	}, nil
+	return s, nil
+}
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithProfiles switches between the configs in dir (*.conf) instead of the
+// endpoints of a single config: each config is a server, copied into place as
+// wg0.conf when switching.
+func WithProfiles(dir string) Option {
+	return func(s *Server) {
+		s.profiles = dir
+	}
+}
+
+// WithDevice switches the tunnel of device, with its config in
+// /etc/wireguard, instead of wg0.
+func WithDevice(device string) Option {
+	return func(s *Server) {
+		s.device = device
+	}
+}
+
+// defaultDevice is the device switched unless WithDevice.
+const defaultDevice = "wg0"
+
+// configPath returns the path of the config of a device.
+func configPath(device string) string {
+	return "/etc/wireguard/" + device + ".conf"
 }
 
 // A Server implements the ability to switch a WireGuard server.
-// It implements the Switchable interface.
+// It implements the Switchable and Indexable interfaces.
 type Server struct {
-	config string
+	device   string
+	config   string
+	profiles string // optional directory of configs
 }
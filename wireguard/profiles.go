@@ -0,0 +1,65 @@
+package wireguard
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  "github.com/StalkR/switchman/profiledir"
+)
+
+// A profile is a WireGuard config in the profiles directory. In profiles
+// mode, each is a server, and switching copies it into place as wg0.conf,
+// with a marker line to identify it.
+type profile struct {
+  Name string // file name without extension
+  Path string
+  *config
+}
+
+// listProfiles finds .conf files in the profiles directory and parses them.
+func (s *Server) listProfiles() ([]*profile, error) {
+  matches, err := filepath.Glob(filepath.Join(s.profiles, "*.conf"))
+  if err != nil {
+    return nil, err
+  }
+  sort.Strings(matches)
+  var profiles []*profile
+  for _, path := range matches {
+    if path == s.config {
+      continue
+    }
+    c, err := readConfig(path)
+    if err != nil {
+      return nil, err
+    }
+    profiles = append(profiles, &profile{
+      Name:   strings.TrimSuffix(filepath.Base(path), ".conf"),
+      Path:   path,
+      config: c,
+    })
+  }
+  return profiles, nil
+}
+
+// switchProfile copies the profile into place as wg0.conf, after backing up
+// a config not put in place by a switch.
+func (s *Server) switchProfile(name string) error {
+  profiles, err := s.listProfiles()
+  if err != nil {
+    return err
+  }
+  for _, p := range profiles {
+    if p.Name != name {
+      continue
+    }
+    b, err := os.ReadFile(p.Path)
+    if err != nil {
+      return err
+    }
+    return profiledir.Install(s.config, p.Name, b)
+  }
+  return fmt.Errorf("profile %v not found", name)
+}
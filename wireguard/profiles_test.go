@@ -0,0 +1,97 @@
+package wireguard
+
+import (
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestProfiles(t *testing.T) {
+  dir := t.TempDir()
+  for name, content := range map[string]string{
+    "se-got.conf": "[Interface]\nPrivateKey = x\nAddress = 10.0.0.2/32\n\n[Peer]\nPublicKey = AAAAAAAAbbbbbbbbCCCCCCCCddddddddEEEEEEEEfff=\nAllowedIPs = 0.0.0.0/0\nEndpoint = 198.51.100.1:51820 # se-got\n",
+    "us-nyc.conf": "[Interface]\nPrivateKey = y\nAddress = 10.0.0.3/32\n\n[Peer]\nPublicKey = ZZZZZZZZ\nEndpoint = 198.51.100.2:51820\n",
+    "notes.txt":   "not a config\n",
+  } {
+    if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  s := &Server{profiles: dir, config: filepath.Join(dir, "wg0.conf")}
+  // a hand-maintained config in place is backed up by the first switch
+  manual := "[Interface]\nPrivateKey = z\n"
+  if err := os.WriteFile(s.config, []byte(manual), 0600); err != nil {
+    t.Fatal(err)
+  }
+
+  servers, err := s.List()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := []string{"se-got", "us-nyc"}; !reflect.DeepEqual(servers, want) {
+    t.Errorf("List() = %q; want %q", servers, want)
+  }
+  profiles, err := s.listProfiles()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if p := profiles[0]; p.Endpoint != "198.51.100.1:51820" || p.Address != "10.0.0.2/32" || p.Fingerprint() != "AAAAAAAA…" {
+    t.Errorf("profile se-got = %+v", p.config)
+  }
+
+  if err := s.switchProfile("us-nyc"); err != nil {
+    t.Fatal(err)
+  }
+  current, err := s.Current()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if current != "us-nyc" {
+    t.Errorf("Current() = %q; want us-nyc", current)
+  }
+  b, err := os.ReadFile(s.config)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !strings.HasSuffix(string(b), "Endpoint = 198.51.100.2:51820\n") {
+    t.Errorf("wg0.conf = %q; want us-nyc config", b)
+  }
+  if servers, err := s.List(); err != nil || len(servers) != 2 {
+    t.Errorf("List() after switch = %q, %v; want wg0.conf excluded", servers, err)
+  }
+  if b, err := os.ReadFile(s.config + ".orig"); err != nil || string(b) != manual {
+    t.Errorf("wg0.conf.orig = %q, %v; want %q", b, err, manual)
+  }
+  if err := s.switchProfile("se-got"); err != nil {
+    t.Fatal(err)
+  }
+  if b, err := os.ReadFile(s.config + ".orig"); err != nil || string(b) != manual {
+    t.Errorf("wg0.conf.orig after second switch = %q, %v; want %q", b, err, manual)
+  }
+
+  // a second hand-maintained config is not overwritten, nor the backup
+  if err := os.WriteFile(s.config, []byte(manual), 0600); err != nil {
+    t.Fatal(err)
+  }
+  if err := s.switchProfile("us-nyc"); err == nil {
+    t.Errorf("switchProfile() over a config without marker and a backup = nil; want error")
+  }
+  if b, err := os.ReadFile(s.config); err != nil || string(b) != manual {
+    t.Errorf("wg0.conf = %q, %v; want kept %q", b, err, manual)
+  }
+}
+
+func TestDetectProfiles(t *testing.T) {
+  dir := t.TempDir()
+  if r := Detect(WithProfiles(dir)); r.Confidence != 0 {
+    t.Errorf("Detect(empty dir) = %+v; want confidence 0", r)
+  }
+  if err := os.WriteFile(filepath.Join(dir, "se-got.conf"), []byte("[Peer]\nEndpoint = 198.51.100.1:51820\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  if r := Detect(WithProfiles(dir)); r.Confidence != 80 || !strings.HasPrefix(r.Reason, "1 profiles") {
+    t.Errorf("Detect() = %+v; want confidence 80", r)
+  }
+}
@@ -0,0 +1,35 @@
+package wireguard
+
+import (
+  "fmt"
+
+  "github.com/StalkR/switchman/wgshow"
+)
+
+// Status returns the live state of the WireGuard interface.
+func (s *Server) Status() (*wgshow.Device, error) {
+  return wgshow.Show(s.device)
+}
+
+// Device returns the network device of the tunnel.
+func (s *Server) Device() (string, error) {
+  return s.device, nil
+}
+
+// Endpoints returns the endpoints of a server: the server itself, or the
+// endpoint of the profile in profiles mode.
+func (s *Server) Endpoints(server string) ([]string, error) {
+  if s.profiles == "" {
+    return []string{server}, nil
+  }
+  profiles, err := s.listProfiles()
+  if err != nil {
+    return nil, err
+  }
+  for _, p := range profiles {
+    if p.Name == server {
+      return []string{p.Endpoint}, nil
+    }
+  }
+  return nil, fmt.Errorf("profile %v not found", server)
+}
@@ -11,6 +11,7 @@ import (
 var endpointRE = regexp.MustCompile("(?m)^(Endpoint = .*)$")
 
 // Switch switches to the specified server.
+// In profiles mode, server is a profile name and its config is put in place.
 func (s *Server) Switch(server string) error {
   found := false
   list, err := s.List()
@@ -34,6 +35,13 @@ func (s *Server) Switch(server string) error {
     return nil // not an error, just nothing to do
   }
 
+  if s.profiles != "" {
+    if err := s.switchProfile(server); err != nil {
+      return err
+    }
+    return restart(s.device)
+  }
+
   b, err := os.ReadFile(s.config)
   if err != nil {
     return err
@@ -48,11 +56,10 @@ func (s *Server) Switch(server string) error {
     return err
   }
 
-  return restart()
+  return restart(s.device)
 }
 
-func restart() error {
-  const device = "wg0"
+func restart(device string) error {
   // check if running before stop or it will fail
   if err := exec.Command("wg", "show", device).Run(); err == nil {
     if out, err := exec.Command("wg-quick", "down", device).CombinedOutput(); err != nil {